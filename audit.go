@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"regexp"
+	"time"
+
+	"encoding/json"
+
+	"github.com/caTUstrophy/backend/db"
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"github.com/satori/go.uuid"
+)
+
+// Variables
+
+// Request IDs supplied by clients or proxies are only
+// accepted if they can't mess up our logs.
+var requestIDPattern = regexp.MustCompile("^[A-Za-z0-9._-]{1,64}$")
+
+// Contact details, names, descriptions and locations never enter our
+// append-only audit trail, as they could not be removed anymore once
+// a user deletes the account. Changes to these fields are recorded
+// without their values.
+var auditRedactedFields = map[string]bool{
+	"Mail":          true,
+	"PhoneNumbers":  true,
+	"Name":          true,
+	"PreferredName": true,
+	"Description":   true,
+	"Location":      true,
+}
+
+const auditRedactedValue = "[redacted]"
+
+// Functions
+
+// Middleware that assigns every request an ID, so that audit
+// entries can be correlated with logs. Keeps an ID supplied in
+// header X-Request-ID, e.g. by a proxy, and generates one otherwise.
+func RequestID() gin.HandlerFunc {
+
+	return func(c *gin.Context) {
+
+		requestID := c.Request.Header.Get("X-Request-ID")
+		if !requestIDPattern.MatchString(requestID) {
+			requestID = fmt.Sprintf("%s", uuid.NewV4())
+		}
+
+		c.Set("RequestID", requestID)
+		c.Header("X-Request-ID", requestID)
+
+		c.Next()
+	}
+}
+
+// Appends an entry to our audit trail. Before and after are the
+// states of the target as exposed through our API, e.g. results of
+// CopyNestedModel, of which only differing fields are stored. Pass
+// nil as before for created targets. Pass a transaction as database
+// if the audited change is part of one, so that both are either
+// stored together or not at all.
+func (app *App) audit(database *gorm.DB, c *gin.Context, actor *db.User, action string, targetType string, targetID string, regionID string, before interface{}, after interface{}) {
+
+	requestID := ""
+	if value, exists := c.Get("RequestID"); exists {
+		requestID = value.(string)
+	}
+
+	AuditEntry := db.AuditEntry{
+		ID:         fmt.Sprintf("%s", uuid.NewV4()),
+		CreatedAt:  time.Now(),
+		RequestID:  requestID,
+		ActorID:    actor.ID,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		RegionID:   regionID,
+		Changes:    diffStates(before, after),
+	}
+
+	if err := database.Create(&AuditEntry).Error; err != nil {
+		log.Printf("[audit] Could not store audit entry for %s by %s: %s\n", action, actor.ID, err)
+	}
+}
+
+// Converts supplied state into a map of its JSON fields.
+func stateFields(state interface{}) map[string]interface{} {
+
+	fields := make(map[string]interface{})
+
+	if state == nil {
+		return fields
+	}
+
+	raw, err := json.Marshal(state)
+	if err != nil {
+		log.Printf("[stateFields] Could not marshal state for audit trail: %s\n", err)
+		return fields
+	}
+
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		log.Printf("[stateFields] Audited state is no JSON object: %s\n", err)
+	}
+
+	return fields
+}
+
+// Replaces values of contact fields anywhere in supplied
+// state, e.g. also in nested users, by a placeholder.
+func redactState(state interface{}) interface{} {
+
+	switch value := state.(type) {
+
+	case map[string]interface{}:
+
+		redacted := make(map[string]interface{}, len(value))
+
+		for name, field := range value {
+
+			if auditRedactedFields[name] && field != nil {
+				redacted[name] = auditRedactedValue
+			} else {
+				redacted[name] = redactState(field)
+			}
+		}
+
+		return redacted
+
+	case []interface{}:
+
+		redacted := make([]interface{}, len(value))
+
+		for i, element := range value {
+			redacted[i] = redactState(element)
+		}
+
+		return redacted
+	}
+
+	return state
+}
+
+// Compares two states field by field and returns all
+// fields that were added, removed or changed. Values of
+// contact fields are redacted after comparing them.
+func diffStates(before interface{}, after interface{}) db.AuditChanges {
+
+	beforeFields := stateFields(before)
+	afterFields := stateFields(after)
+
+	redactedBefore := redactState(beforeFields).(map[string]interface{})
+	redactedAfter := redactState(afterFields).(map[string]interface{})
+
+	changes := make(db.AuditChanges)
+
+	for name, value := range beforeFields {
+
+		if !reflect.DeepEqual(value, afterFields[name]) {
+			changes[name] = db.AuditChange{Before: redactedBefore[name], After: redactedAfter[name]}
+		}
+	}
+
+	for name, value := range afterFields {
+
+		if _, exists := beforeFields[name]; !exists && value != nil {
+			changes[name] = db.AuditChange{Before: nil, After: redactedAfter[name]}
+		}
+	}
+
+	return changes
+}
@@ -5,12 +5,15 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/caTUstrophy/backend/db"
+	"github.com/caTUstrophy/backend/mail"
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator"
 	"github.com/joho/godotenv"
+	"github.com/nyaruka/phonenumbers"
 )
 
 func InitAndConfig() *App {
@@ -43,11 +46,83 @@ func InitAndConfig() *App {
 		db.AddDefaultData(app.DB)
 	}
 
+	// Bring permissions and roles up to date.
+	db.Migrate(app.DB)
+
 	// Set cost factor of bcrypt password hashing to the one loaded from environment.
-	app.HashCost, err = strconv.Atoi(os.Getenv("PASSWORD_HASHING_COST"))
+	hashCost, err := strconv.Atoi(os.Getenv("PASSWORD_HASHING_COST"))
 	if err != nil {
 		log.Fatal("[InitAndConfig] Could not load PASSWORD_HASHING_COST from .env file. Missing or not an integer?")
 	}
+	bcryptHasher := BcryptHasher{Cost: hashCost}
+
+	// Hash new passwords with the algorithm loaded from environment. Existing
+	// hashes of the other algorithm keep working and get upgraded on login.
+	switch os.Getenv("PASSWORD_HASHING_ALGORITHM") {
+	case "bcrypt":
+		app.Passwords = NewPasswordHashing(bcryptHasher, Argon2idHasher{})
+	case "argon2id":
+
+		argonMemory, err := strconv.ParseUint(os.Getenv("PASSWORD_ARGON2_MEMORY"), 10, 32)
+		if err != nil {
+			log.Fatal("[InitAndConfig] Could not load PASSWORD_ARGON2_MEMORY from .env file. Missing or not an integer?")
+		}
+
+		argonTime, err := strconv.ParseUint(os.Getenv("PASSWORD_ARGON2_TIME"), 10, 32)
+		if err != nil {
+			log.Fatal("[InitAndConfig] Could not load PASSWORD_ARGON2_TIME from .env file. Missing or not an integer?")
+		}
+
+		argonThreads, err := strconv.ParseUint(os.Getenv("PASSWORD_ARGON2_THREADS"), 10, 8)
+		if err != nil || argonThreads == 0 {
+			log.Fatal("[InitAndConfig] Could not load PASSWORD_ARGON2_THREADS from .env file. Missing or not an integer between 1 and 255?")
+		}
+
+		app.Passwords = NewPasswordHashing(Argon2idHasher{
+			Memory:  uint32(argonMemory),
+			Time:    uint32(argonTime),
+			Threads: uint8(argonThreads),
+			SaltLen: 16,
+			KeyLen:  32,
+		}, bcryptHasher)
+	default:
+		log.Fatal("[InitAndConfig] Could not load PASSWORD_HASHING_ALGORITHM from .env file. Missing or neither 'bcrypt' nor 'argon2id'?")
+	}
+
+	// Build policy new passwords have to comply with from environment.
+	app.PasswordPolicy = new(PasswordPolicy)
+
+	app.PasswordPolicy.MinLength, err = strconv.Atoi(os.Getenv("PASSWORD_MIN_LENGTH"))
+	if err != nil {
+		log.Fatal("[InitAndConfig] Could not load PASSWORD_MIN_LENGTH from .env file. Missing or not an integer?")
+	}
+
+	for _, class := range strings.Split(os.Getenv("PASSWORD_CHARACTER_CLASSES"), ",") {
+
+		switch strings.TrimSpace(class) {
+		case "":
+		case "lower":
+			app.PasswordPolicy.RequireLower = true
+		case "upper":
+			app.PasswordPolicy.RequireUpper = true
+		case "digit":
+			app.PasswordPolicy.RequireDigit = true
+		case "special":
+			app.PasswordPolicy.RequireSpecial = true
+		default:
+			log.Fatalf("[InitAndConfig] Could not load PASSWORD_CHARACTER_CLASSES from .env file. Unknown character class '%s'.", class)
+		}
+	}
+
+	// Checking for breached passwords is optional.
+	if breachedList := os.Getenv("PASSWORD_BREACHED_LIST"); breachedList != "" {
+
+		if _, err := os.Stat(breachedList); err != nil {
+			log.Fatalf("[InitAndConfig] Could not open PASSWORD_BREACHED_LIST from .env file: %s", err)
+		}
+
+		app.PasswordPolicy.Breached = &BreachedPasswords{Path: breachedList}
+	}
 
 	// Set JWT session token validity to the duration in minutes loaded from environment.
 	validFor, err := strconv.Atoi(os.Getenv("JWT_VALID_FOR"))
@@ -56,6 +131,141 @@ func InitAndConfig() *App {
 	}
 	app.SessionValidFor = time.Duration(validFor) * time.Minute
 
+	// Read issuer and audience of our JWTs from environment.
+	app.JWTIssuer = os.Getenv("JWT_ISSUER")
+	app.JWTAudience = os.Getenv("JWT_AUDIENCE")
+
+	if app.JWTIssuer == "" || app.JWTAudience == "" {
+		log.Fatal("[InitAndConfig] Could not load JWT_ISSUER and JWT_AUDIENCE from .env file. Missing?")
+	}
+
+	// Determine if groups of a user should be embedded into JWTs.
+	app.JWTEmbedScopes, err = strconv.ParseBool(os.Getenv("JWT_EMBED_SCOPES"))
+	if err != nil {
+		log.Fatal("[InitAndConfig] Could not load JWT_EMBED_SCOPES from .env file. Missing or not a boolean?")
+	}
+
+	// Rotate JWT signing key after the duration in hours loaded from environment.
+	keyRotation, err := strconv.Atoi(os.Getenv("JWT_KEY_ROTATION"))
+	if err != nil {
+		log.Fatal("[InitAndConfig] Could not load JWT_KEY_ROTATION from .env file. Missing or not an integer?")
+	}
+
+	// Retired keys have to verify JWTs as long as these are valid.
+	// One extra minute covers the not-before offset of our JWTs.
+	app.Keyring = NewKeyring(app.DB, (time.Duration(keyRotation) * time.Hour), (app.SessionValidFor + time.Minute))
+
+	// Load existing signing keys or create the first one.
+	app.Keyring.Load()
+	if kid, _ := app.Keyring.Current(); kid == "" {
+		app.Keyring.Rotate()
+	}
+
+	keysSleepOffset, err := strconv.Atoi(os.Getenv("JWT_KEYS_SLEEP_OFFSET"))
+	if err != nil {
+		log.Fatal("[InitAndConfig] Could not load JWT_KEYS_SLEEP_OFFSET from .env file. Missing or not an integer?")
+	}
+	app.KeysSleepOffset = time.Duration(keysSleepOffset) * time.Minute
+
+	// Set refresh token validity to the duration in days loaded from environment.
+	refreshValidFor, err := strconv.Atoi(os.Getenv("REFRESH_TOKEN_VALID_FOR"))
+	if err != nil {
+		log.Fatal("[InitAndConfig] Could not load REFRESH_TOKEN_VALID_FOR from .env file. Missing or not an integer?")
+	}
+	app.RefreshValidFor = time.Duration(refreshValidFor) * (time.Hour * 24)
+
+	// Create the configured sender for mails to our users.
+	app.Mailer = mail.InitSender()
+
+	// Read base URL of frontend from environment. Used to build links in mails.
+	app.FrontendURL = os.Getenv("FRONTEND_URL")
+
+	// Phone numbers without country code are taken to be of this region.
+	app.PhoneRegion = strings.ToUpper(os.Getenv("PHONE_DEFAULT_REGION"))
+	if phonenumbers.GetCountryCodeForRegion(app.PhoneRegion) == 0 {
+		log.Fatal("[InitAndConfig] Could not load PHONE_DEFAULT_REGION from .env file. Missing or not a two-letter region code?")
+	}
+
+	// Bring phone numbers stored before labels existed into E.164 format.
+	db.MigratePhoneNumbers(app.DB, app.PhoneRegion)
+
+	// Set validity of mail verification tokens to the duration in hours loaded from environment.
+	verifyValidFor, err := strconv.Atoi(os.Getenv("MAIL_VERIFICATION_VALID_FOR"))
+	if err != nil {
+		log.Fatal("[InitAndConfig] Could not load MAIL_VERIFICATION_VALID_FOR from .env file. Missing or not an integer?")
+	}
+	app.VerifyValidFor = time.Duration(verifyValidFor) * time.Hour
+
+	// Set validity of password reset tokens to the duration in minutes loaded from environment.
+	resetValidFor, err := strconv.Atoi(os.Getenv("PASSWORD_RESET_VALID_FOR"))
+	if err != nil {
+		log.Fatal("[InitAndConfig] Could not load PASSWORD_RESET_VALID_FOR from .env file. Missing or not an integer?")
+	}
+	app.ResetValidFor = time.Duration(resetValidFor) * time.Minute
+
+	// Set validity of invitation links to the duration in hours loaded from environment.
+	inviteValidFor, err := strconv.Atoi(os.Getenv("INVITATION_VALID_FOR"))
+	if err != nil {
+		log.Fatal("[InitAndConfig] Could not load INVITATION_VALID_FOR from .env file. Missing or not an integer?")
+	}
+	app.InviteValidFor = time.Duration(inviteValidFor) * time.Hour
+
+	// Load limits for failed login attempts per mail address and per client IP.
+	maxMailFails, err := strconv.Atoi(os.Getenv("LOGIN_MAX_ATTEMPTS_MAIL"))
+	if err != nil {
+		log.Fatal("[InitAndConfig] Could not load LOGIN_MAX_ATTEMPTS_MAIL from .env file. Missing or not an integer?")
+	}
+
+	maxIPFails, err := strconv.Atoi(os.Getenv("LOGIN_MAX_ATTEMPTS_IP"))
+	if err != nil {
+		log.Fatal("[InitAndConfig] Could not load LOGIN_MAX_ATTEMPTS_IP from .env file. Missing or not an integer?")
+	}
+
+	// Failed attempts older than this window in minutes are not counted anymore.
+	attemptsWindow, err := strconv.Atoi(os.Getenv("LOGIN_ATTEMPTS_WINDOW"))
+	if err != nil {
+		log.Fatal("[InitAndConfig] Could not load LOGIN_ATTEMPTS_WINDOW from .env file. Missing or not an integer?")
+	}
+
+	// First lockout lasts this many seconds and doubles with every further lockout.
+	baseLockout, err := strconv.Atoi(os.Getenv("LOGIN_LOCKOUT_BASE"))
+	if err != nil {
+		log.Fatal("[InitAndConfig] Could not load LOGIN_LOCKOUT_BASE from .env file. Missing or not an integer?")
+	}
+
+	// But a lockout never lasts longer than this many minutes.
+	maxLockout, err := strconv.Atoi(os.Getenv("LOGIN_LOCKOUT_MAX"))
+	if err != nil {
+		log.Fatal("[InitAndConfig] Could not load LOGIN_LOCKOUT_MAX from .env file. Missing or not an integer?")
+	}
+
+	app.LoginThrottle = NewLoginThrottle(maxMailFails, maxIPFails, (time.Duration(attemptsWindow) * time.Minute), (time.Duration(baseLockout) * time.Second), (time.Duration(maxLockout) * time.Minute))
+
+	// Set up cache of authorized users with its size and TTL in seconds loaded from environment.
+	cacheSize, err := strconv.Atoi(os.Getenv("PRINCIPAL_CACHE_SIZE"))
+	if err != nil {
+		log.Fatal("[InitAndConfig] Could not load PRINCIPAL_CACHE_SIZE from .env file. Missing or not an integer?")
+	}
+
+	cacheTTL, err := strconv.Atoi(os.Getenv("PRINCIPAL_CACHE_TTL"))
+	if err != nil {
+		log.Fatal("[InitAndConfig] Could not load PRINCIPAL_CACHE_TTL from .env file. Missing or not an integer?")
+	}
+
+	app.Principals = NewPrincipalCache(cacheSize, (time.Duration(cacheTTL) * time.Second))
+
+	// Determine if admins have to use two-factor authentication for privileged endpoints.
+	app.Require2FAForAdmins, err = strconv.ParseBool(os.Getenv("REQUIRE_2FA_FOR_ADMINS"))
+	if err != nil {
+		log.Fatal("[InitAndConfig] Could not load REQUIRE_2FA_FOR_ADMINS from .env file. Missing or not a boolean?")
+	}
+
+	// Determine if users have to verify their mail address before creating offers or requests.
+	app.RequireVerifiedMail, err = strconv.ParseBool(os.Getenv("REQUIRE_MAIL_VERIFICATION"))
+	if err != nil {
+		log.Fatal("[InitAndConfig] Could not load REQUIRE_MAIL_VERIFICATION from .env file. Missing or not a boolean?")
+	}
+
 	// Initialize the validator instance to validate fields with tag 'validate'
 	validatorConfig := &validator.Config{TagName: "validate"}
 	app.Validator = validator.New(validatorConfig)
@@ -80,6 +290,13 @@ func InitAndConfig() *App {
 	}
 	app.NotifSleepOffset = time.Duration(notifSleepOffset) * time.Minute
 
+	// Set sleep offset for reaper of revoked and refresh tokens.
+	tokensSleepOffset, err := strconv.Atoi(os.Getenv("TOKENS_SLEEP_OFFSET"))
+	if err != nil {
+		log.Fatal("[InitAndConfig] Could not load TOKENS_SLEEP_OFFSET from .env file. Missing or not an integer?")
+	}
+	app.TokensSleepOffset = time.Duration(tokensSleepOffset) * time.Minute
+
 	// Set weight for tags similarity in matching score calculation.
 	app.TagsWeightAlpha, err = strconv.ParseFloat(os.Getenv("TAGS_WEIGHT_ALPHA"), 64)
 	if err != nil {
@@ -92,5 +309,11 @@ func InitAndConfig() *App {
 		log.Fatal("[InitAndConfig] Could not load DESCRIPTIONS_WEIGHT_BETA from .env file. Missing or not an integer?")
 	}
 
+	// Set weight for trust level of offering user in matching score calculation.
+	app.TrustWeightGamma, err = strconv.ParseFloat(os.Getenv("TRUST_WEIGHT_GAMMA"), 64)
+	if err != nil {
+		log.Fatal("[InitAndConfig] Could not load TRUST_WEIGHT_GAMMA from .env file. Missing or not a float?")
+	}
+
 	return app
 }
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"strings"
+
+	"net/http"
+
+	"github.com/caTUstrophy/backend/db"
+	"github.com/gin-gonic/gin"
+)
+
+// Structs
+
+type RevealContactPayload struct {
+	Reason string `conform:"trim" validate:"required"`
+}
+
+// Functions
+
+// Returns the IDs of all users whose contact details supplied
+// viewer may see: the viewer and everyone the viewer or one of
+// the viewer's organisations currently has a valid matching with.
+// Sharing an organisation is not enough, as owners add members
+// without their consent.
+func (app *App) visibleContacts(viewer *db.User) map[string]bool {
+
+	visible := map[string]bool{
+		viewer.ID: true,
+	}
+
+	organisationIDs := app.organisationIDs(viewer)
+
+	query := app.DB.Table("matchings").
+		Select("\"offers\".\"user_id\", \"requests\".\"user_id\"").
+		Joins("JOIN \"offers\" ON \"offers\".\"id\" = \"matchings\".\"offer_id\"").
+		Joins("JOIN \"requests\" ON \"requests\".\"id\" = \"matchings\".\"request_id\"")
+
+	if len(organisationIDs) > 0 {
+		query = query.Where("\"matchings\".\"invalid\" = ? AND (\"offers\".\"user_id\" = ? OR \"requests\".\"user_id\" = ? OR \"offers\".\"organisation_id\" IN (?) OR \"requests\".\"organisation_id\" IN (?))", false, viewer.ID, viewer.ID, organisationIDs, organisationIDs)
+	} else {
+		query = query.Where("\"matchings\".\"invalid\" = ? AND (\"offers\".\"user_id\" = ? OR \"requests\".\"user_id\" = ?)", false, viewer.ID, viewer.ID)
+	}
+
+	rows, err := query.Rows()
+	if err != nil {
+		return visible
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+
+		var offerUserID, requestUserID string
+		if err := rows.Scan(&offerUserID, &requestUserID); err == nil {
+			visible[offerUserID] = true
+			visible[requestUserID] = true
+		}
+	}
+
+	return visible
+}
+
+// Masks contact details of every user contained in supplied
+// response model, e.g. the result of CopyNestedModel, unless
+// supplied viewer may see them. Masked users carry the field
+// ContactMasked. Changes the model in place and returns it.
+func (app *App) protectContacts(viewer *db.User, model interface{}) interface{} {
+
+	maskContacts(model, app.visibleContacts(viewer))
+
+	return model
+}
+
+func maskContacts(model interface{}, visible map[string]bool) {
+
+	switch model := model.(type) {
+	case []interface{}:
+		for _, element := range model {
+			maskContacts(element, visible)
+		}
+	case []map[string]interface{}:
+		for _, element := range model {
+			maskContacts(element, visible)
+		}
+	case map[string]interface{}:
+
+		_, hasMail := model["Mail"]
+		_, hasPhoneNumbers := model["PhoneNumbers"]
+
+		if id, ok := model["ID"].(string); ok && (hasMail || hasPhoneNumbers) && !visible[id] {
+
+			if mail, ok := model["Mail"].(string); ok {
+				model["Mail"] = maskMail(mail)
+			}
+
+			if numbers, ok := model["PhoneNumbers"].(db.PhoneNumbers); ok {
+				model["PhoneNumbers"] = maskPhoneNumbers(numbers)
+			}
+
+			model["ContactMasked"] = true
+		}
+
+		for _, value := range model {
+			maskContacts(value, visible)
+		}
+	}
+}
+
+// Keeps first character of the local part and the domain,
+// e.g. "a***@example.com".
+func maskMail(mail string) string {
+
+	at := strings.LastIndex(mail, "@")
+	if at < 1 {
+		return "***"
+	}
+
+	return mail[:1] + "***" + mail[at:]
+}
+
+// Keeps labels, country code and the last two digits,
+// e.g. "+49*******00".
+func maskPhoneNumbers(numbers db.PhoneNumbers) db.PhoneNumbers {
+
+	masked := make(db.PhoneNumbers, len(numbers))
+
+	for i, number := range numbers {
+
+		masked[i].Label = number.Label
+
+		if len(number.Number) <= 5 {
+			masked[i].Number = strings.Repeat("*", len(number.Number))
+			continue
+		}
+
+		masked[i].Number = number.Number[:3] + strings.Repeat("*", (len(number.Number)-5)) + number.Number[(len(number.Number)-2):]
+	}
+
+	return masked
+}
+
+// Hands out unmasked contact details of a user active in a
+// region to an admin of it. Every reveal is recorded in our
+// audit trail together with the supplied reason.
+func (app *App) RevealContactInRegion(c *gin.Context) {
+
+	// Check authorization for this function.
+	User := app.AuthorizeShort(c)
+	if User == nil {
+		return
+	}
+
+	regionID := app.getUUID(c, "regionID")
+	if regionID == "" {
+		return
+	}
+
+	userID := app.getUUID(c, "userID")
+	if userID == "" {
+		return
+	}
+
+	var Region db.Region
+	app.DB.First(&Region, "\"id\" = ?", regionID)
+
+	if Region.ID == "" {
+
+		c.JSON(http.StatusNotFound, gin.H{
+			"Error": "The region you requested does not exist.",
+		})
+
+		return
+	}
+
+	// Check if user permissions are sufficient (user is admin).
+	if ok := app.CheckScope(User, Region, db.PermissionRegionContactReveal); !ok {
+
+		// Signal client that the provided authorization was not sufficient.
+		c.Header("WWW-Authenticate", "Bearer realm=\"CaTUstrophy\", error=\"authentication_failed\", error_description=\"Could not authenticate the request\"")
+		c.Status(http.StatusUnauthorized)
+
+		return
+	}
+
+	var Payload RevealContactPayload
+
+	// Expect reason for reveal in JSON request body.
+	if ok := app.ValidatePayloadShort(c, &Payload); !ok {
+		return
+	}
+
+	// Only users active in this region are its admins' business.
+	var revealedUser db.User
+	app.DB.Where(usersActiveInRegion, Region.ID, Region.ID, Region.ID).First(&revealedUser, "\"id\" = ?", userID)
+
+	if revealedUser.ID == "" {
+
+		c.JSON(http.StatusNotFound, gin.H{
+			"Error": "The user you requested is not active in this region.",
+		})
+
+		return
+	}
+
+	app.audit(app.DB, c, User, db.AuditUserContactReveal, "user", revealedUser.ID, Region.ID, nil, gin.H{"Reason": Payload.Reason})
+
+	model := CopyNestedModel(revealedUser, fieldsUserContact)
+
+	c.JSON(http.StatusOK, model)
+}
@@ -0,0 +1,43 @@
+package db
+
+import (
+	"errors"
+	"reflect"
+
+	"database/sql/driver"
+	"encoding/json"
+)
+
+// Field-wise difference between the state of an audited
+// object before and after a change, stored as JSONB:
+// {"Field": {"Before": ..., "After": ...}, ...}
+type AuditChanges map[string]AuditChange
+
+type AuditChange struct {
+	Before interface{}
+	After  interface{}
+}
+
+func (changes *AuditChanges) Scan(value interface{}) error {
+
+	// Entries without any recorded changes.
+	if value == nil {
+		return nil
+	}
+
+	if reflect.TypeOf(value).String() != "[]uint8" {
+		return errors.New("Could not scan audit changes - type assertion failed.")
+	}
+
+	return json.Unmarshal(value.([]byte), changes)
+}
+
+func (changes AuditChanges) Value() (driver.Value, error) {
+
+	valueString, err := json.Marshal(changes)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(valueString), nil
+}
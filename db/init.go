@@ -56,6 +56,8 @@ func InitDB() *gorm.DB {
 func AddDefaultData(db *gorm.DB) {
 
 	// Drop all existing tables that will be created afterwards.
+	db.DropTableIfExists(&Permission{})
+	db.DropTableIfExists(&Role{})
 	db.DropTableIfExists(&Group{})
 	db.DropTableIfExists(&User{})
 	db.DropTableIfExists(&Tag{})
@@ -65,13 +67,31 @@ func AddDefaultData(db *gorm.DB) {
 	db.DropTableIfExists(&Region{})
 	db.DropTableIfExists(&Notification{})
 	db.DropTableIfExists(&MatchingScore{})
+	db.DropTableIfExists(&RevokedToken{})
+	db.DropTableIfExists(&RefreshToken{})
+	db.DropTableIfExists(&Session{})
+	db.DropTableIfExists(&OneTimeToken{})
+	db.DropTableIfExists(&SigningKey{})
+	db.DropTableIfExists(&APIKey{})
+	db.DropTableIfExists(&RecoveryCode{})
+	db.DropTableIfExists(&AuditEntry{})
+	db.DropTableIfExists(&Organisation{})
+	db.DropTableIfExists(&OrganisationMember{})
+	db.DropTableIfExists(&TrustGrant{})
+	db.DropTableIfExists(&TrustRequirement{})
+	db.DropTableIfExists(&Feedback{})
+	db.DropTableIfExists(&Invitation{})
 	db.DropTableIfExists("region_offers")
 	db.DropTableIfExists("region_requests")
 	db.DropTableIfExists("offer_tags")
 	db.DropTableIfExists("request_tags")
 	db.DropTableIfExists("user_groups")
+	db.DropTableIfExists("role_permissions")
+	db.DropTableIfExists("organisation_groups")
 
 	// Check if our tables are present, otherwise create them.
+	db.CreateTable(&Permission{})
+	db.CreateTable(&Role{})
 	db.CreateTable(&Group{})
 	db.CreateTable(&User{})
 	db.CreateTable(&Tag{})
@@ -81,6 +101,20 @@ func AddDefaultData(db *gorm.DB) {
 	db.CreateTable(&Region{})
 	db.CreateTable(&Notification{})
 	db.CreateTable(&MatchingScore{})
+	db.CreateTable(&RevokedToken{})
+	db.CreateTable(&RefreshToken{})
+	db.CreateTable(&Session{})
+	db.CreateTable(&OneTimeToken{})
+	db.CreateTable(&SigningKey{})
+	db.CreateTable(&APIKey{})
+	db.CreateTable(&RecoveryCode{})
+	db.CreateTable(&AuditEntry{})
+	db.CreateTable(&Organisation{})
+	db.CreateTable(&OrganisationMember{})
+	db.CreateTable(&TrustGrant{})
+	db.CreateTable(&TrustRequirement{})
+	db.CreateTable(&Feedback{})
+	db.CreateTable(&Invitation{})
 
 	// Three default permission entities.
 
@@ -91,21 +125,22 @@ func AddDefaultData(db *gorm.DB) {
 		Boundaries:  GeoPolygon{[]gormGIS.GeoPoint{gormGIS.GeoPoint{13.324401, 52.516872}, gormGIS.GeoPoint{13.322599, 52.514740}, gormGIS.GeoPoint{13.322679, 52.512611}, gormGIS.GeoPoint{13.322674, 52.511743}, gormGIS.GeoPoint{13.328280, 52.508302}, gormGIS.GeoPoint{13.331077, 52.512191}, gormGIS.GeoPoint{13.329763, 52.513787}, gormGIS.GeoPoint{13.324401, 52.516872}}},
 	}
 
-	// Three default group entities.
+	// Three default group entities. Their roles are
+	// assigned by access right when migrating.
 
 	GroupUser := Group{
 		ID:           fmt.Sprintf("%s", uuid.NewV4()),
 		DefaultGroup: true,
 		Region:       Region{},
 		RegionId:     "",
-		AccessRight:  "user",
+		AccessRight:  RoleUser,
 		Description:  "This permission represents a standard, registered but not privileged user in our system.",
 	}
 
 	GroupAdmin := Group{
 		ID:           fmt.Sprintf("%s", uuid.NewV4()),
 		DefaultGroup: false,
-		AccessRight:  "superadmin",
+		AccessRight:  RoleSuperadmin,
 		Description:  "This permission represents a registered and fully authorized user in our system. Users with this permission have full API access to our system.",
 	}
 
@@ -114,7 +149,7 @@ func AddDefaultData(db *gorm.DB) {
 		DefaultGroup: false,
 		Region:       RegionTU,
 		RegionId:     RegionTU.ID,
-		AccessRight:  "admin",
+		AccessRight:  RoleAdmin,
 		Description:  "This permission represents a registered and fully authorized user in our system. Users with this permission have full API access to our system.",
 	}
 
@@ -145,6 +180,7 @@ func AddDefaultData(db *gorm.DB) {
 		Name:          "admin",
 		PreferredName: "The Boss Around Here",
 		Mail:          "admin@example.org",
+		MailVerified:  true,
 		PhoneNumbers:  *PhoneNumbers,
 		PasswordHash:  "$2a$10$SkmaOImXqNS/PSWp65p1ougtA1N.o8r5qyu8M4RPTfGSMEf2k.Q1C",
 		Groups:        []Group{GroupAdmin},
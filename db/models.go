@@ -15,28 +15,174 @@ const (
 	// NotificationPromotion string = "promotion"
 )
 
+const (
+	OneTimeTokenMailVerification string = "mail_verification"
+	OneTimeTokenPasswordReset    string = "password_reset"
+	OneTimeTokenLoginChallenge   string = "login_challenge"
+	// Place for more, future one-time token types.
+)
+
+// Trust levels region admins can grant to users, from
+// lowest to highest. Users without a grant have none.
+const (
+	TrustLevelVerified string = "verified"
+	TrustLevelVetted   string = "vetted"
+)
+
+// Sides of a matching giving feedback.
+const (
+	FeedbackSideOffer   string = "offer"
+	FeedbackSideRequest string = "request"
+)
+
+// Roles of members within an organisation.
+const (
+	OrganisationRoleOwner  string = "owner"
+	OrganisationRoleMember string = "member"
+)
+
+const (
+	AuditRegionAdminPromote       string = "region_admin.promote"
+	AuditRegionAdminDemote        string = "region_admin.demote"
+	AuditSystemAdminPromote       string = "system_admin.promote"
+	AuditSystemAdminDemote        string = "system_admin.demote"
+	AuditRoleCreate               string = "role.create"
+	AuditRoleUpdate               string = "role.update"
+	AuditRoleGrant                string = "role.grant"
+	AuditRoleRevoke               string = "role.revoke"
+	AuditUserUpdate               string = "user.update"
+	AuditUserSuspend              string = "user.suspend"
+	AuditUserEnable               string = "user.enable"
+	AuditUserDelete               string = "user.delete"
+	AuditUserContactReveal        string = "user.contact_reveal"
+	AuditUserTrustGrant           string = "user.trust_grant"
+	AuditUserTrustRevoke          string = "user.trust_revoke"
+	AuditServiceAccountCreate     string = "service_account.create"
+	AuditAPIKeyCreate             string = "api_key.create"
+	AuditAPIKeyRevoke             string = "api_key.revoke"
+	AuditRegionCreate             string = "region.create"
+	AuditRegionUpdate             string = "region.update"
+	AuditRegionTrustRequirement   string = "region.trust_requirement"
+	AuditMatchingCreate           string = "matching.create"
+	AuditMatchingUpdate           string = "matching.update"
+	AuditMatchingComplete         string = "matching.complete"
+	AuditOrganisationCreate       string = "organisation.create"
+	AuditOrganisationUpdate       string = "organisation.update"
+	AuditOrganisationMemberSet    string = "organisation.member_set"
+	AuditOrganisationMemberRemove string = "organisation.member_remove"
+	AuditInvitationCreate         string = "invitation.create"
+	AuditInvitationRevoke         string = "invitation.revoke"
+	AuditInvitationAccept         string = "invitation.accept"
+	// Place for more, future audited actions.
+)
+
 // Models
 
+type Permission struct {
+	Name        string `gorm:"primary_key"`
+	Description string
+}
+
+type Role struct {
+	ID          string       `gorm:"primary_key"`
+	Name        string       `gorm:"not null;unique"`
+	Description string       `gorm:"not null"`
+	BuiltIn     bool         `gorm:"not null"`
+	Permissions []Permission `gorm:"many2many:role_permissions"`
+}
+
+// Grants a role to its users, either in the region
+// of the group or system-wide without region.
 type Group struct {
 	ID           string `gorm:"primary_key"`
 	DefaultGroup bool   `gorm:"not null"`
 	RegionId     string `gorm:"index;not null"`
 	Region       Region `gorm:"ForeignKey:RegionId;AssociationForeignKey:Refer"`
+	RoleID       string `gorm:"index"`
+	Role         Role   `gorm:"ForeignKey:RoleID;AssociationForeignKey:Refer"`
 	Users        []User `gorm:"many2many:user_groups"`
-	AccessRight  string
-	Description  string
+	// Name of the role, kept for clients that rely on it.
+	AccessRight string
+	Description string
 }
 
 type User struct {
-	ID            string       `gorm:"primary_key"`
-	Name          string       `gorm:"not null"`
-	PreferredName string       `gorm:"not null"`
-	Mail          string       `gorm:"index;not null;unique"`
-	MailVerified  bool         `gorm:"not null"`
-	PhoneNumbers  PhoneNumbers `gorm:"not null" sql:"type:jsonb"`
-	PasswordHash  string       `gorm:"not null;unique"`
-	Groups        []Group      `gorm:"many2many:user_groups"`
-	Enabled       bool         `gorm:"not null"`
+	ID                string       `gorm:"primary_key"`
+	Name              string       `gorm:"not null"`
+	PreferredName     string       `gorm:"not null"`
+	Mail              string       `gorm:"index;not null;unique"`
+	MailVerified      bool         `gorm:"not null"`
+	PhoneNumbers      PhoneNumbers `gorm:"not null" sql:"type:jsonb"`
+	PasswordHash      string       `gorm:"not null;unique"`
+	Groups            []Group      `gorm:"many2many:user_groups"`
+	Enabled           bool         `gorm:"not null"`
+	SuspensionReason  string
+	SessionsRevokedAt time.Time
+	ServiceAccount    bool `gorm:"not null;default:false"`
+	TOTPSecret        string
+	TOTPEnabled       bool  `gorm:"not null;default:false"`
+	TOTPLastCounter   int64 `gorm:"not null;default:0"`
+	// Deleted users are kept anonymised, so that
+	// matchings stay intact for the other party.
+	Deleted bool `gorm:"not null;default:false"`
+}
+
+// A relief organisation, e.g. a shelter, a food bank or a
+// fire brigade. Its members offer and request on its behalf
+// and hold the roles granted to it through groups.
+type Organisation struct {
+	ID          string  `gorm:"primary_key"`
+	Name        string  `gorm:"not null;unique"`
+	Description string  `gorm:"not null"`
+	Groups      []Group `gorm:"many2many:organisation_groups"`
+}
+
+type OrganisationMember struct {
+	OrganisationID string `gorm:"primary_key"`
+	UserID         string `gorm:"primary_key"`
+	User           User   `gorm:"ForeignKey:UserID;AssociationForeignKey:Refer"`
+	Role           string `gorm:"not null"`
+}
+
+// Trust a region admin puts in a user, e.g. after checking the
+// ID card of a volunteer. Only the newest grant of a user in a
+// region counts and only until it expires or gets revoked.
+type TrustGrant struct {
+	ID          string    `gorm:"primary_key"`
+	UserID      string    `gorm:"index;not null"`
+	RegionID    string    `gorm:"index;not null"`
+	Level       string    `gorm:"not null"`
+	Note        string    `gorm:"not null"`
+	GrantedByID string    `gorm:"not null"`
+	CreatedAt   time.Time `gorm:"not null"`
+	ExpiresAt   time.Time `gorm:"index;not null"`
+	Revoked     bool      `gorm:"not null"`
+}
+
+// Minimum trust level the user of an offer needs in a region
+// in order to be matched with requests carrying the tag.
+type TrustRequirement struct {
+	RegionID string `gorm:"primary_key"`
+	TagName  string `gorm:"primary_key"`
+	Level    string `gorm:"not null"`
+}
+
+type RecoveryCode struct {
+	ID       string `gorm:"primary_key"`
+	UserID   string `gorm:"index;not null"`
+	CodeHash string `gorm:"index;not null"`
+	Used     bool   `gorm:"not null"`
+}
+
+type APIKey struct {
+	ID         string    `gorm:"primary_key"`
+	Name       string    `gorm:"not null"`
+	Prefix     string    `gorm:"not null"`
+	KeyHash    string    `gorm:"index;not null;unique"`
+	UserID     string    `gorm:"index;not null"`
+	CreatedAt  time.Time `gorm:"not null"`
+	LastUsedAt *time.Time
+	Revoked    bool `gorm:"not null"`
 }
 
 type Tag struct {
@@ -56,6 +202,10 @@ type Offer struct {
 	ValidityPeriod time.Time `gorm:"not null"`
 	Matched        bool      `gorm:"not null"`
 	Expired        bool      `gorm:"not null"`
+	// Set if made on behalf of an organisation.
+	OrganisationID string `gorm:"index"`
+	// Trust level of its user, looked up for responses.
+	TrustLevel string `gorm:"-"`
 }
 
 type Request struct {
@@ -71,6 +221,8 @@ type Request struct {
 	ValidityPeriod time.Time `gorm:"not null"`
 	Matched        bool      `gorm:"not null"`
 	Expired        bool      `gorm:"not null"`
+	// Set if made on behalf of an organisation.
+	OrganisationID string `gorm:"index"`
 }
 
 type Matching struct {
@@ -82,6 +234,25 @@ type Matching struct {
 	RequestId string  `gorm:"index;not null"`
 	Request   Request `gorm:"ForeignKey:RequestId;AssociationForeignKey:Refer"`
 	Invalid   bool    `gorm:"not null"`
+	// Set by the parties of the matching on their handover.
+	OfferConfirmed   bool `gorm:"not null;default:false"`
+	RequestConfirmed bool `gorm:"not null;default:false"`
+	// Set once both parties or a region admin confirmed the handover.
+	Completed bool
+}
+
+// Rating one party of a completed matching gives the user
+// of the other side. Every side rates once per matching.
+type Feedback struct {
+	ID         string    `gorm:"primary_key"`
+	MatchingID string    `gorm:"index;not null;unique_index:idx_feedback_matching_side"`
+	RegionID   string    `gorm:"index;not null"`
+	Side       string    `gorm:"not null;unique_index:idx_feedback_matching_side"`
+	AuthorID   string    `gorm:"index;not null"`
+	SubjectID  string    `gorm:"index;not null"`
+	Rating     int       `gorm:"not null"`
+	Comment    string    `gorm:"not null"`
+	CreatedAt  time.Time `gorm:"not null"`
 }
 
 type Region struct {
@@ -102,6 +273,89 @@ type Notification struct {
 	ItemID    string    `gorm:"not null"`
 	Read      bool      `gorm:"not null"`
 	CreatedAt time.Time `gorm:"not null"`
+	// Set if all members of an organisation are notified.
+	OrganisationID string `gorm:"index"`
+}
+
+type RevokedToken struct {
+	ID        string    `gorm:"primary_key"`
+	UserID    string    `gorm:"index;not null"`
+	ExpiresAt time.Time `gorm:"index;not null"`
+}
+
+// One login of a user on a device. All JWTs and refresh
+// tokens of a login carry its ID as session ID.
+type Session struct {
+	ID         string    `gorm:"primary_key"`
+	UserID     string    `gorm:"index;not null"`
+	UserAgent  string    `gorm:"not null"`
+	IP         string    `gorm:"not null"`
+	CreatedAt  time.Time `gorm:"not null"`
+	LastSeenAt time.Time `gorm:"not null"`
+	ExpiresAt  time.Time `gorm:"index;not null"`
+	Revoked    bool      `gorm:"not null"`
+}
+
+type RefreshToken struct {
+	ID        string    `gorm:"primary_key"`
+	TokenHash string    `gorm:"index;not null;unique"`
+	FamilyID  string    `gorm:"index;not null"`
+	UserID    string    `gorm:"index;not null"`
+	Used      bool      `gorm:"not null"`
+	Revoked   bool      `gorm:"not null"`
+	CreatedAt time.Time `gorm:"not null"`
+	ExpiresAt time.Time `gorm:"index;not null"`
+}
+
+type SigningKey struct {
+	ID         string    `gorm:"primary_key"`
+	Algorithm  string    `gorm:"not null"`
+	PrivateKey string    `gorm:"not null"`
+	CreatedAt  time.Time `gorm:"not null"`
+	RetiredAt  *time.Time
+	ExpiresAt  *time.Time `gorm:"index"`
+}
+
+type OneTimeToken struct {
+	TokenHash string    `gorm:"primary_key"`
+	Type      string    `gorm:"index;not null"`
+	UserID    string    `gorm:"index;not null"`
+	Mail      string    `gorm:"not null"`
+	Used      bool      `gorm:"not null"`
+	CreatedAt time.Time `gorm:"not null"`
+	ExpiresAt time.Time `gorm:"index;not null"`
+}
+
+// Invites supplied mail address to take over the role of a group
+// in a region. Accepting creates the account if necessary. Only
+// the hash of the token in the invitation link is stored.
+type Invitation struct {
+	ID           string    `gorm:"primary_key"`
+	TokenHash    string    `gorm:"index;not null;unique"`
+	Mail         string    `gorm:"index;not null"`
+	RegionID     string    `gorm:"index;not null"`
+	GroupID      string    `gorm:"not null"`
+	Role         string    `gorm:"not null"`
+	CreatedByID  string    `gorm:"not null"`
+	CreatedAt    time.Time `gorm:"not null"`
+	ExpiresAt    time.Time `gorm:"index;not null"`
+	AcceptedByID string
+	AcceptedAt   *time.Time
+	Revoked      bool `gorm:"not null"`
+}
+
+// Records who did what to which object. Entries are
+// append-only, the database refuses to change them.
+type AuditEntry struct {
+	ID         string       `gorm:"primary_key"`
+	CreatedAt  time.Time    `gorm:"index;not null"`
+	RequestID  string       `gorm:"index"`
+	ActorID    string       `gorm:"index;not null"`
+	Action     string       `gorm:"index;not null"`
+	TargetType string       `gorm:"index"`
+	TargetID   string       `gorm:"index"`
+	RegionID   string       `gorm:"index"`
+	Changes    AuditChanges `sql:"type:jsonb"`
 }
 
 type MatchingScore struct {
@@ -113,6 +367,9 @@ type MatchingScore struct {
 	Request       Request `gorm:"ForeignKey:RequestID;AssociationForeignKey:Refer"`
 	MatchingScore float64 `gorm:"not null"`
 	Recommended   bool
+	// Set if the user of the offer lacks a trust
+	// level required by the tags of the request.
+	TrustMissing bool
 }
 
 // Helpers
@@ -0,0 +1,183 @@
+package db
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/jinzhu/gorm"
+	"github.com/satori/go.uuid"
+)
+
+// Constants
+
+// Permissions that are checked by our endpoints. Roles are
+// made of these and granted to users through groups, either
+// for one region or, if the group has no region, system-wide.
+const (
+	PermissionUserRead             string = "user:read"
+	PermissionUserUpdate           string = "user:update"
+	PermissionUserSuspend          string = "user:suspend"
+	PermissionGroupRead            string = "group:read"
+	PermissionRoleManage           string = "role:manage"
+	PermissionServiceAccountManage string = "service-account:manage"
+	PermissionSystemAdminRead      string = "system:admins:read"
+	PermissionSystemAdminManage    string = "system:admins:manage"
+	PermissionSystemLockoutRead    string = "system:lockouts:read"
+	PermissionSystemHelpRead       string = "system:help:read"
+	PermissionOrganisationManage   string = "organisation:manage"
+	PermissionAuditRead            string = "audit:read"
+	PermissionRegionUpdate         string = "region:update"
+	PermissionRegionAdminRead      string = "region:admins:read"
+	PermissionRegionAdminManage    string = "region:admins:manage"
+	PermissionRegionRoleGrant      string = "region:roles:grant"
+	PermissionRegionUserRead       string = "region:users:read"
+	PermissionRegionUserSuspend    string = "region:users:suspend"
+	PermissionRegionContactReveal  string = "region:contacts:reveal"
+	PermissionRegionTrustManage    string = "region:trust:manage"
+	PermissionRegionAuditRead      string = "region:audit:read"
+	PermissionItemRead             string = "item:read"
+	PermissionItemUpdate           string = "item:update"
+	PermissionRecommendationRead   string = "recommendation:read"
+	PermissionMatchingRead         string = "matching:read"
+	PermissionMatchingCreate       string = "matching:create"
+	PermissionMatchingUpdate       string = "matching:update"
+)
+
+// Names of the roles every deployment has. Groups created
+// before roles existed carry one of these as access right.
+const (
+	RoleUser        string = "user"
+	RoleAdmin       string = "admin"
+	RoleSuperadmin  string = "superadmin"
+	RoleObserver    string = "observer"
+	RoleCoordinator string = "coordinator"
+)
+
+// Variables
+
+var DefaultPermissions = []Permission{
+	{PermissionUserRead, "List and view all users."},
+	{PermissionUserUpdate, "Update profiles and groups of all users."},
+	{PermissionUserSuspend, "Suspend and re-enable users system-wide."},
+	{PermissionGroupRead, "List all groups."},
+	{PermissionRoleManage, "List permissions, create roles and change their permissions."},
+	{PermissionServiceAccountManage, "Create service accounts and manage their API keys."},
+	{PermissionSystemAdminRead, "List system admins."},
+	{PermissionSystemAdminManage, "Promote users to system admins."},
+	{PermissionSystemLockoutRead, "List current login lockouts."},
+	{PermissionSystemHelpRead, "Read the description of our JSON responses."},
+	{PermissionOrganisationManage, "Update all organisations and manage their members."},
+	{PermissionAuditRead, "Read the whole audit trail."},
+	{PermissionRegionUpdate, "Update description and boundaries of a region."},
+	{PermissionRegionAdminRead, "List admins of a region."},
+	{PermissionRegionAdminManage, "Promote users to admins of a region."},
+	{PermissionRegionRoleGrant, "Grant roles in a region to users."},
+	{PermissionRegionUserRead, "List users active in a region."},
+	{PermissionRegionUserSuspend, "Suspend and re-enable users in a region."},
+	{PermissionRegionContactReveal, "Reveal masked contact details of users active in a region."},
+	{PermissionRegionTrustManage, "Grant trust levels to users and require them for tags in a region."},
+	{PermissionRegionAuditRead, "Read the audit trail of a region."},
+	{PermissionItemRead, "View all offers and requests of a region."},
+	{PermissionItemUpdate, "Update all offers and requests of a region."},
+	{PermissionRecommendationRead, "View matching recommendations of a region."},
+	{PermissionMatchingRead, "View all matchings of a region."},
+	{PermissionMatchingCreate, "Create matchings in a region."},
+	{PermissionMatchingUpdate, "Update all matchings of a region."},
+}
+
+// Permissions of the built-in roles. These are restored on every
+// start of the backend and can not be changed through our API.
+var DefaultRoles = map[string][]string{
+	RoleUser: []string{},
+	RoleAdmin: []string{
+		PermissionRegionUpdate, PermissionRegionAdminRead, PermissionRegionAdminManage,
+		PermissionRegionRoleGrant, PermissionRegionUserRead, PermissionRegionUserSuspend,
+		PermissionRegionContactReveal, PermissionRegionTrustManage, PermissionRegionAuditRead,
+		PermissionItemRead, PermissionItemUpdate, PermissionRecommendationRead,
+		PermissionMatchingRead, PermissionMatchingCreate, PermissionMatchingUpdate,
+	},
+	RoleSuperadmin: nil,
+	RoleObserver: []string{
+		PermissionRegionAdminRead, PermissionRegionUserRead, PermissionItemRead,
+		PermissionRecommendationRead, PermissionMatchingRead,
+	},
+	RoleCoordinator: []string{
+		PermissionItemRead, PermissionRecommendationRead, PermissionMatchingRead,
+		PermissionMatchingCreate, PermissionMatchingUpdate,
+	},
+}
+
+var defaultRoleDescriptions = map[string]string{
+	RoleUser:        "Standard, registered but not privileged user.",
+	RoleAdmin:       "Administrates a region.",
+	RoleSuperadmin:  "Has every permission in the whole system.",
+	RoleObserver:    "Can view everything in a region, but not change anything.",
+	RoleCoordinator: "Can create and update matchings in a region, but not manage its admins.",
+}
+
+// Functions
+
+// Creates permission, role, organisation, trust, feedback, invitation,
+// audit, session, token, signing key, API key and recovery code tables
+// if they do not yet exist, adds account, two-factor and deletion
+// columns to users, organisation columns to offers, requests and
+// notifications, the completion column to matchings and the trust
+// column to matching scores, restores all built-in permissions and
+// roles and assigns roles to groups that were created before roles
+// existed. New user columns default to false, so that existing
+// users can be migrated.
+func Migrate(db *gorm.DB) {
+
+	db.AutoMigrate(&Permission{}, &Role{}, &Group{}, &AuditEntry{}, &Organisation{}, &OrganisationMember{}, &TrustGrant{}, &TrustRequirement{}, &Feedback{}, &Invitation{})
+	db.AutoMigrate(&User{}, &RevokedToken{}, &Session{}, &RefreshToken{}, &OneTimeToken{}, &SigningKey{}, &APIKey{}, &RecoveryCode{})
+	db.AutoMigrate(&Offer{}, &Request{}, &Notification{}, &Matching{}, &MatchingScore{})
+
+	// Nobody, not even our backend, may rewrite history.
+	db.Exec("CREATE OR REPLACE RULE \"audit_entries_no_update\" AS ON UPDATE TO \"audit_entries\" DO INSTEAD NOTHING")
+	db.Exec("CREATE OR REPLACE RULE \"audit_entries_no_delete\" AS ON DELETE TO \"audit_entries\" DO INSTEAD NOTHING")
+
+	for _, permission := range DefaultPermissions {
+
+		// Update description of already existing permissions.
+		db.Where(Permission{Name: permission.Name}).Assign(Permission{Description: permission.Description}).FirstOrCreate(&permission)
+	}
+
+	for name, permissionNames := range DefaultRoles {
+
+		var role Role
+		db.First(&role, "\"name\" = ?", name)
+
+		if role.ID == "" {
+
+			role = Role{
+				ID:          fmt.Sprintf("%s", uuid.NewV4()),
+				Name:        name,
+				Description: defaultRoleDescriptions[name],
+				BuiltIn:     true,
+			}
+			db.Create(&role)
+		}
+
+		// Superadmins always hold every permission.
+		if permissionNames == nil {
+
+			permissionNames = make([]string, len(DefaultPermissions))
+
+			for i, permission := range DefaultPermissions {
+				permissionNames[i] = permission.Name
+			}
+		}
+
+		var Permissions []Permission
+		if len(permissionNames) > 0 {
+			db.Where("\"name\" IN (?)", permissionNames).Find(&Permissions)
+		}
+		db.Model(&role).Association("Permissions").Replace(Permissions)
+
+		// Map groups without role by their access right.
+		result := db.Model(&Group{}).Where("(\"role_id\" = '' OR \"role_id\" IS NULL) AND \"access_right\" = ?", name).Update("role_id", role.ID)
+		if result.RowsAffected > 0 {
+			log.Printf("[Migrate] Assigned role %s to %d existing groups.\n", name, result.RowsAffected)
+		}
+	}
+}
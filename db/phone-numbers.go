@@ -4,54 +4,110 @@ package db
 
 import (
 	"errors"
-	"fmt"
-	"reflect"
+	"log"
 	"strings"
 
 	"database/sql/driver"
 	"encoding/json"
+
+	"github.com/jinzhu/gorm"
+	"github.com/nyaruka/phonenumbers"
 )
 
-type PhoneNumbers []string
+// Constants
 
-func (num *PhoneNumbers) Scan(value interface{}) error {
+// Labels users can attach to their phone numbers.
+const (
+	PhoneLabelMobile   string = "mobile"
+	PhoneLabelLandline string = "landline"
+	PhoneLabelSMS      string = "sms"
+)
 
-	var err error
+// Variables
 
-	if reflect.TypeOf(value).String() == "[]string" {
+var ErrPhoneNumberInvalid = errors.New("Is not a valid phone number")
+var ErrPhoneLabelInvalid = errors.New("Has an unknown label, use mobile, landline or sms")
 
-		// Start of JSON string to be unmarshalled later.
-		jsonByteString := "[ "
+// Structs
 
-		// Make sure we operate on a string slice.
-		numbers := value.([]string)
+// A phone number in E.164 format, e.g. "+493012345678",
+// with an optional label describing how to reach it.
+type PhoneNumber struct {
+	Number string
+	Label  string
+}
 
-		// Range over supplied numbers and append each to JSON string.
-		for _, n := range numbers {
-			jsonByteString = fmt.Sprintf("%s\"%s\", ", jsonByteString, n)
-		}
+type PhoneNumbers []PhoneNumber
+
+// Functions
+
+// Parses supplied number, which may be written in national format
+// of supplied default region, e.g. "DE", or in international format
+// with leading "+". Returns the validated number in E.164 format.
+func NewPhoneNumber(number string, label string, defaultRegion string) (PhoneNumber, error) {
+
+	label = strings.ToLower(strings.TrimSpace(label))
+	if label != "" && label != PhoneLabelMobile && label != PhoneLabelLandline && label != PhoneLabelSMS {
+		return PhoneNumber{}, ErrPhoneLabelInvalid
+	}
+
+	parsed, err := phonenumbers.Parse(strings.TrimSpace(number), defaultRegion)
+	if err != nil || !phonenumbers.IsValidNumber(parsed) {
+		return PhoneNumber{}, ErrPhoneNumberInvalid
+	}
+
+	return PhoneNumber{
+		Number: phonenumbers.Format(parsed, phonenumbers.E164),
+		Label:  label,
+	}, nil
+}
+
+func (num *PhoneNumbers) Scan(value interface{}) error {
 
-		// Remove trailing comma and space and replace by closing bracket of JSON string.
-		jsonByteString = strings.TrimRight(jsonByteString, ", ")
-		jsonByteString = fmt.Sprintf("%s ]", jsonByteString)
+	var raw []byte
 
-		err = json.Unmarshal([]byte(jsonByteString), &num)
-	} else if reflect.TypeOf(value).String() == "[]uint8" {
-		err = json.Unmarshal(value.([]byte), &num)
-	} else {
+	switch value := value.(type) {
+	case []byte:
+		raw = value
+	case string:
+		raw = []byte(value)
+	default:
 		return errors.New("Could not scan phone numbers - type assertion failed.")
 	}
 
-	// Attempt to unmarshal into type.
-	if err != nil {
+	var entries []json.RawMessage
+	if err := json.Unmarshal(raw, &entries); err != nil {
 		return err
 	}
 
+	numbers := make(PhoneNumbers, len(entries))
+
+	for i, entry := range entries {
+
+		// Numbers stored before labels existed are plain strings.
+		var plain string
+		if err := json.Unmarshal(entry, &plain); err == nil {
+			numbers[i] = PhoneNumber{Number: plain}
+			continue
+		}
+
+		if err := json.Unmarshal(entry, &numbers[i]); err != nil {
+			return err
+		}
+	}
+
+	*num = numbers
+
 	return nil
 }
 
 func (num PhoneNumbers) Value() (driver.Value, error) {
 
+	// Store no numbers as empty list rather than null.
+	if num == nil {
+		num = PhoneNumbers{}
+	}
+
 	valueString, err := json.Marshal(num)
 	if err != nil {
 		return nil, err
@@ -59,3 +115,35 @@ func (num PhoneNumbers) Value() (driver.Value, error) {
 
 	return string(valueString), nil
 }
+
+// Converts phone numbers stored as plain strings before labels
+// existed into labelled numbers in E.164 format. Numbers without
+// country code are taken to be of supplied default region. Numbers
+// that can not be parsed are kept as they were and logged.
+func MigratePhoneNumbers(db *gorm.DB, defaultRegion string) {
+
+	var Users []User
+	db.Select("\"id\", \"phone_numbers\"").Find(&Users, "EXISTS (SELECT 1 FROM jsonb_array_elements(\"phone_numbers\") AS \"entry\" WHERE jsonb_typeof(\"entry\") = 'string')")
+
+	for _, user := range Users {
+
+		numbers := make(PhoneNumbers, len(user.PhoneNumbers))
+
+		for i, number := range user.PhoneNumbers {
+
+			normalized, err := NewPhoneNumber(number.Number, number.Label, defaultRegion)
+			if err != nil {
+				log.Printf("[MigratePhoneNumbers] Could not normalize phone number %d of user %s: %s\n", i, user.ID, err)
+				normalized = number
+			}
+
+			numbers[i] = normalized
+		}
+
+		db.Model(&User{}).Where("\"id\" = ?", user.ID).Update("phone_numbers", numbers)
+	}
+
+	if len(Users) > 0 {
+		log.Printf("[MigratePhoneNumbers] Converted phone numbers of %d users.\n", len(Users))
+	}
+}
@@ -141,3 +141,32 @@ func NotificationReaper(db *gorm.DB, expiryOffset time.Duration, sleepOffset tim
 		time.Sleep(sleepOffset)
 	}
 }
+
+// For revoked, refresh and one-time tokens. Once a revoked token has
+// expired on its own, it is not needed anymore on the revocation list.
+// Expired refresh and one-time tokens can not be used anymore and are
+// deleted as well.
+func TokenReaper(db *gorm.DB, sleepOffset time.Duration) {
+
+	log.Println("Tokens reaper started.")
+
+	for {
+
+		// Delete all revocation entries of already expired tokens.
+		db.Where("\"expires_at\" < ?", time.Now()).Delete(&RevokedToken{})
+
+		// Delete all expired refresh tokens.
+		db.Where("\"expires_at\" < ?", time.Now()).Delete(&RefreshToken{})
+
+		// Delete all sessions whose tokens all expired.
+		db.Where("\"expires_at\" < ?", time.Now()).Delete(&Session{})
+
+		// Delete all expired one-time tokens.
+		db.Where("\"expires_at\" < ?", time.Now()).Delete(&OneTimeToken{})
+
+		log.Printf("Tokens reaper done. Sleeping for %s.\n", sleepOffset.String())
+
+		// Let function execution sleep until next round.
+		time.Sleep(sleepOffset)
+	}
+}
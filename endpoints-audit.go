@@ -0,0 +1,181 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"net/http"
+
+	"github.com/caTUstrophy/backend/db"
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"github.com/satori/go.uuid"
+)
+
+// Functions
+
+// Applies the filters and cursor supplied as query parameters
+// to a query on audit entries and loads the matching entries,
+// newest first. If more entries follow, the cursor to the next
+// page is sent in header X-Next-Cursor. On invalid parameters
+// writes an error response and returns false.
+func (app *App) findAuditEntries(c *gin.Context, query *gorm.DB) ([]db.AuditEntry, bool) {
+
+	filters := map[string]string{
+		"actor":   "\"actor_id\" = ?",
+		"action":  "\"action\" = ?",
+		"type":    "\"target_type\" = ?",
+		"target":  "\"target_id\" = ?",
+		"request": "\"request_id\" = ?",
+	}
+
+	for parameter, condition := range filters {
+
+		if value := c.Query(parameter); value != "" {
+			query = query.Where(condition, value)
+		}
+	}
+
+	if before := c.Query("before"); before != "" {
+
+		beforeTime, err := time.Parse(time.RFC3339, before)
+		if err != nil {
+
+			c.JSON(http.StatusBadRequest, gin.H{
+				"before": "Needs to be an RFC3339 date",
+			})
+
+			return nil, false
+		}
+
+		query = query.Where("\"created_at\" < ?", beforeTime)
+	}
+
+	// Cursors are the ID of the last entry of the previous page.
+	// Entries created at the same time are ordered by their ID,
+	// so that paging neither skips nor repeats them.
+	if cursor := c.Query("cursor"); cursor != "" {
+
+		if _, err := uuid.FromString(cursor); err != nil {
+
+			c.JSON(http.StatusBadRequest, gin.H{
+				"cursor": "Is invalid",
+			})
+
+			return nil, false
+		}
+
+		query = query.Where("(\"created_at\", \"id\") < (SELECT \"created_at\", \"id\" FROM \"audit_entries\" WHERE \"id\" = ?)", cursor)
+	}
+
+	limit := 100
+
+	if limitParam := c.Query("limit"); limitParam != "" {
+
+		var err error
+		limit, err = strconv.Atoi(limitParam)
+		if err != nil || limit < 1 || limit > 1000 {
+
+			c.JSON(http.StatusBadRequest, gin.H{
+				"limit": "Needs to be a number between 1 and 1000",
+			})
+
+			return nil, false
+		}
+	}
+
+	// Load one more entry than requested to know if another page follows.
+	AuditEntries := []db.AuditEntry{}
+	query.Order("\"created_at\" DESC, \"id\" DESC").Limit((limit + 1)).Find(&AuditEntries)
+
+	if len(AuditEntries) > limit {
+
+		AuditEntries = AuditEntries[:limit]
+
+		c.Header("X-Next-Cursor", AuditEntries[(limit-1)].ID)
+	}
+
+	return AuditEntries, true
+}
+
+// Lists our whole audit trail page by page, see
+// findAuditEntries for the supported query parameters.
+func (app *App) ListAuditEntries(c *gin.Context) {
+
+	// Check authorization for this function.
+	User := app.AuthorizeShort(c)
+	if User == nil {
+		return
+	}
+
+	// Check if user permissions are sufficient (user is superadmin).
+	if ok := app.CheckScope(User, db.Region{}, db.PermissionAuditRead); !ok {
+
+		// Signal client that the provided authorization was not sufficient.
+		c.Header("WWW-Authenticate", "Bearer realm=\"CaTUstrophy\", error=\"authentication_failed\", error_description=\"Could not authenticate the request\"")
+		c.Status(http.StatusUnauthorized)
+
+		return
+	}
+
+	query := app.DB.Model(&db.AuditEntry{})
+
+	if regionID := c.Query("region"); regionID != "" {
+		query = query.Where("\"region_id\" = ?", regionID)
+	}
+
+	AuditEntries, ok := app.findAuditEntries(c, query)
+	if !ok {
+		return
+	}
+
+	model := CopyNestedModel(AuditEntries, fieldsAuditEntry)
+
+	c.JSON(http.StatusOK, model)
+}
+
+// Lists the audit trail of one region.
+func (app *App) ListAuditEntriesForRegion(c *gin.Context) {
+
+	// Check authorization for this function.
+	User := app.AuthorizeShort(c)
+	if User == nil {
+		return
+	}
+
+	regionID := app.getUUID(c, "regionID")
+	if regionID == "" {
+		return
+	}
+
+	var Region db.Region
+	app.DB.First(&Region, "\"id\" = ?", regionID)
+
+	if Region.ID == "" {
+
+		c.JSON(http.StatusNotFound, gin.H{
+			"Error": "The region you requested does not exist.",
+		})
+
+		return
+	}
+
+	// Check if user permissions are sufficient (user is admin).
+	if ok := app.CheckScope(User, Region, db.PermissionRegionAuditRead); !ok {
+
+		// Signal client that the provided authorization was not sufficient.
+		c.Header("WWW-Authenticate", "Bearer realm=\"CaTUstrophy\", error=\"authentication_failed\", error_description=\"Could not authenticate the request\"")
+		c.Status(http.StatusUnauthorized)
+
+		return
+	}
+
+	AuditEntries, ok := app.findAuditEntries(c, app.DB.Model(&db.AuditEntry{}).Where("\"region_id\" = ?", Region.ID))
+	if !ok {
+		return
+	}
+
+	model := CopyNestedModel(AuditEntries, fieldsAuditEntry)
+
+	c.JSON(http.StatusOK, model)
+}
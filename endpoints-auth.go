@@ -3,9 +3,10 @@ package main
 import (
 	"fmt"
 	"log"
-	"os"
+	"math"
 	"time"
 
+	"encoding/json"
 	"net/http"
 
 	"github.com/caTUstrophy/backend/db"
@@ -14,7 +15,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator"
 	"github.com/leebenson/conform"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/satori/go.uuid"
 )
 
 // Structs
@@ -24,24 +25,82 @@ type LoginPayload struct {
 	Password string `validate:"required"`
 }
 
+type RefreshPayload struct {
+	RefreshToken string `conform:"trim" validate:"required"`
+}
+
 // Functions
 
 // Check if provided authorization data in request
 // is correct and all validity checks are positive.
 func (app *App) Authorize(req *http.Request) (bool, *db.User, string) {
 
-	jwtSigningSecret := []byte(os.Getenv("JWT_SIGNING_SECRET"))
+	// Service accounts authenticate with an API key instead of a JWT.
+	if apiKey := req.Header.Get("X-API-Key"); apiKey != "" {
+		return app.AuthorizeAPIKey(apiKey)
+	}
+
+	ok, User, _, message := app.AuthorizeWithClaims(req)
+
+	return ok, User, message
+}
+
+// Checks if supplied API key is known, not revoked and
+// belongs to an enabled service account.
+func (app *App) AuthorizeAPIKey(apiKey string) (bool, *db.User, string) {
+
+	var APIKey db.APIKey
+	app.DB.First(&APIKey, "\"key_hash\" = ?", hashOpaqueToken(apiKey))
+
+	if APIKey.ID == "" || APIKey.Revoked {
+		return false, nil, "API key was invalid"
+	}
+
+	// Retrieve service account from cache or database.
+	principal := app.getPrincipal(APIKey.UserID)
+	if principal == nil || !principal.User.ServiceAccount {
+		return false, nil, "API key was invalid"
+	}
+
+	User := principal.CopyUser()
+
+	// Suspended service accounts are not allowed to do anything.
+	if !User.Enabled {
+		return false, nil, "User is suspended"
+	}
+
+	// Remember when this key was used. To spare our database a write
+	// on every request, this is only updated once per minute.
+	nowTime := time.Now()
+	if APIKey.LastUsedAt == nil || nowTime.Sub(*APIKey.LastUsedAt) > time.Minute {
+		app.DB.Model(&APIKey).Update("last_used_at", nowTime)
+	}
+
+	return true, User, ""
+}
+
+// Works like Authorize but additionally returns the
+// claims of the validated JWT, e.g. for revoking it.
+func (app *App) AuthorizeWithClaims(req *http.Request) (bool, *db.User, jwt.MapClaims, string) {
 
 	// Extract JWT from request headers.
 	requestJWT, err := request.ParseFromRequest(req, request.AuthorizationHeaderExtractor, func(token *jwt.Token) (interface{}, error) {
 
 		// Verify that JWT was signed with correct algorithm.
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		if token.Method != jwt.SigningMethodRS256 {
 			return nil, fmt.Errorf("[Authorize] Unexpected signing method: %v.", token.Header["alg"])
 		}
 
-		// Return our JWT signing secret as the key to verify integrity of JWT.
-		return jwtSigningSecret, nil
+		// Find the public key the JWT claims to be signed with.
+		kid, _ := token.Header["kid"].(string)
+
+		publicKey, ok := app.Keyring.PublicKey(kid)
+		if !ok {
+			return nil, fmt.Errorf("[Authorize] Unknown signing key: %v.", token.Header["kid"])
+		}
+
+		// Return the public key to verify integrity of JWT.
+		return publicKey, nil
 	})
 
 	// Check if JWT is valid.
@@ -52,41 +111,111 @@ func (app *App) Authorize(req *http.Request) (bool, *db.User, string) {
 
 			if (validationError.Errors & (jwt.ValidationErrorExpired | jwt.ValidationErrorNotValidYet)) != 0 {
 				// JWT is not yet valid or expired.
-				return false, nil, "JWT not yet valid or expired"
+				return false, nil, nil, "JWT not yet valid or expired"
 			} else {
 				// Invalid JWT was delivered.
-				return false, nil, "JWT was invalid"
+				return false, nil, nil, "JWT was invalid"
 			}
 		} else {
 			// Something went wrong.
-			return false, nil, "JWT was invalid"
+			return false, nil, nil, "JWT was invalid"
 		}
 	}
 
 	claims := requestJWT.Claims.(jwt.MapClaims)
 
-	// Check if JWT is expired.
-	jwtExp, ok := claims["exp"].(string)
+	// Validity period was already checked while parsing,
+	// but expiration and issue date have to be present.
+	_, ok := claimTime(claims, "exp")
 	if !ok {
-		return false, nil, "JWT contained invalid date"
+		return false, nil, nil, "JWT contained invalid date"
 	}
 
-	exp, _ := time.Parse(time.RFC3339, jwtExp)
-	if exp.Before(time.Now()) {
-		return false, nil, "JWT was expired"
+	iat, ok := claimTime(claims, "iat")
+	if !ok {
+		return false, nil, nil, "JWT contained invalid date"
 	}
 
-	// Extract mail of JWT claimed user.
-	email := claims["iss"].(string)
+	// Check that JWT was issued by us for us.
+	if !claims.VerifyIssuer(app.JWTIssuer, true) || !claims.VerifyAudience(app.JWTAudience, true) {
+		return false, nil, nil, "JWT was invalid"
+	}
 
-	// Retrieve user from database.
-	var User db.User
-	app.DB.Preload("Groups").First(&User, "mail = ?", email)
-	for i, _ := range User.Groups {
-		app.DB.Model(&User.Groups[i]).Related(&User.Groups[i].Region)
+	// Extract unique ID of JWT.
+	jti, ok := claims["jti"].(string)
+	if !ok || jti == "" {
+		return false, nil, nil, "JWT was invalid"
+	}
+
+	// Check if JWT was put on revocation list.
+	var CountRevoked int
+	app.DB.Model(&db.RevokedToken{}).Where("\"id\" = ?", jti).Count(&CountRevoked)
+
+	if CountRevoked > 0 {
+		return false, nil, nil, "JWT was revoked"
+	}
+
+	// Check that the session of this JWT was not signed out.
+	sessionID, _ := claims["sid"].(string)
+
+	var Session db.Session
+	app.DB.First(&Session, "\"id\" = ?", sessionID)
+
+	if Session.ID == "" || Session.Revoked || Session.UserID != claims["sub"] {
+		return false, nil, nil, "JWT was revoked"
+	}
+
+	// Extract ID of JWT claimed user.
+	userID, ok := claims["sub"].(string)
+	if !ok || userID == "" {
+		return false, nil, nil, "JWT was invalid"
+	}
+
+	// Retrieve user from cache or database.
+	principal := app.getPrincipal(userID)
+	if principal == nil {
+		return false, nil, nil, "JWT was invalid"
+	}
+
+	User := principal.CopyUser()
+
+	// Suspended users are not allowed to do anything.
+	if !User.Enabled {
+		return false, nil, nil, "User is suspended"
+	}
+
+	// Check if user logged out of all sessions after this JWT was issued.
+	// Claim iat only has second precision, so compare whole seconds, or a
+	// login right after revoking would be refused. JWTs issued earlier in
+	// that second are already caught by the revocation of their session.
+	if iat.Unix() < User.SessionsRevokedAt.Unix() {
+		return false, nil, nil, "JWT was revoked"
+	}
+
+	// Remember when this session was used. To spare our database
+	// a write on every request, this is only updated once per minute.
+	nowTime := time.Now()
+	if nowTime.Sub(Session.LastSeenAt) > time.Minute {
+		app.DB.Model(&Session).Update("last_seen_at", nowTime)
+	}
+
+	return true, User, claims, ""
+}
+
+// Reads a numeric date claim (seconds since epoch) from
+// supplied JWT claims. Returns false if it is missing or
+// not a number.
+func claimTime(claims jwt.MapClaims, name string) (time.Time, bool) {
+
+	switch value := claims[name].(type) {
+	case float64:
+		return time.Unix(int64(value), 0), true
+	case json.Number:
+		seconds, err := value.Int64()
+		return time.Unix(seconds, 0), (err == nil)
 	}
 
-	return true, &User, ""
+	return time.Time{}, false
 }
 
 // Helper function for Authorize.
@@ -113,44 +242,46 @@ func (app *App) AuthorizeShort(c *gin.Context) *db.User {
 // operations labelled with permission for a given region.
 func (app *App) CheckScope(user *db.User, region db.Region, permission string) bool {
 
-	// Fast, because the typical user is member of few groups.
-	for _, group := range user.Groups {
+	// Deployments may require admins to use two-factor authentication.
+	// Service accounts authenticate with API keys and are exempt.
+	if app.Require2FAForAdmins && !user.TOTPEnabled && !user.ServiceAccount {
+		return false
+	}
 
-		if group.AccessRight == "superadmin" {
-			return true
-		}
+	return app.HasPermission(user, region, permission)
+}
 
-		// If someone wants to check only for superadmin without region,
-		// an empty region is sufficient. Otherwise, the region has
-		// to be present.
-		if region.ID == "" {
-			continue
-		}
+// Checks if any role granted to supplied user contains permission,
+// either system-wide or in supplied region. Unlike CheckScope this
+// ignores policies about the way the user authenticated, so it is
+// also suitable to check the privileges of other users.
+func (app *App) HasPermission(user *db.User, region db.Region, permission string) bool {
 
-		if group.RegionId == region.ID {
+	principal := app.getPrincipal(user.ID)
+	if principal == nil {
+		return false
+	}
 
-			if group.AccessRight == permission {
-				return true
-			}
-		}
+	// Groups without region grant their role system-wide.
+	if principal.Permissions[""][permission] {
+		return true
 	}
 
-	// No group found that gives permission to user.
-	return false
+	return (region.ID != "") && principal.Permissions[region.ID][permission]
 }
 
 // Check supplied user's access to multiple regions.
 func (app *App) CheckScopes(user *db.User, regions []db.Region, permission string) bool {
 
-	// Check for superadmin privilege.
-	if su := app.CheckScope(user, db.Region{}, "superadmin"); su {
+	// Check for system-wide permission.
+	if ok := app.CheckScope(user, db.Region{}, permission); ok {
 		return true
 	}
 
 	// Iterate over regions until region with permission is found.
 	for _, Region := range regions {
 
-		if ok := app.CheckScope(user, Region, "admin"); ok {
+		if ok := app.CheckScope(user, Region, permission); ok {
 			return true
 		}
 	}
@@ -159,29 +290,106 @@ func (app *App) CheckScopes(user *db.User, regions []db.Region, permission strin
 	return false
 }
 
-// Produce a JWT and store it in application's session cache.
-func (app *App) makeToken(c *gin.Context, user *db.User) string {
+// Records a new session or updates when, where and with which
+// device an existing one was used. A session lasts as long as
+// its JWTs or refresh tokens can be used.
+func (app *App) touchSession(c *gin.Context, user *db.User, sessionID string) {
 
-	// Retrieve the session signing key from environment.
-	jwtSigningSecret := os.Getenv("JWT_SIGNING_SECRET")
+	nowTime := time.Now()
+
+	expiresAt := nowTime.Add(app.SessionValidFor)
+	if app.RefreshValidFor > app.SessionValidFor {
+		expiresAt = nowTime.Add(app.RefreshValidFor)
+	}
+
+	userAgent := c.Request.UserAgent()
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+
+	result := app.DB.Model(&db.Session{}).Where("\"id\" = ? AND \"user_id\" = ?", sessionID, user.ID).Updates(map[string]interface{}{
+		"user_agent":   userAgent,
+		"ip":           c.ClientIP(),
+		"last_seen_at": nowTime,
+		"expires_at":   expiresAt,
+	})
+
+	if result.RowsAffected == 0 {
+
+		Session := db.Session{
+			ID:         sessionID,
+			UserID:     user.ID,
+			UserAgent:  userAgent,
+			IP:         c.ClientIP(),
+			CreatedAt:  nowTime,
+			LastSeenAt: nowTime,
+			ExpiresAt:  expiresAt,
+			Revoked:    false,
+		}
+		app.DB.Create(&Session)
+	}
+}
+
+// Revokes supplied sessions of a user including all of their
+// JWTs and refresh tokens.
+func (app *App) revokeSessions(userID string, sessionIDs ...string) {
+
+	app.DB.Model(&db.Session{}).Where("\"user_id\" = ? AND \"id\" IN (?)", userID, sessionIDs).Update("revoked", true)
+	app.DB.Model(&db.RefreshToken{}).Where("\"user_id\" = ? AND \"family_id\" IN (?)", userID, sessionIDs).Update("revoked", true)
+}
+
+// Produce a JWT and record its session in our database.
+// All JWTs and refresh tokens handed out for one login share
+// the same session ID.
+func (app *App) makeToken(c *gin.Context, user *db.User, sessionID string) string {
+
+	app.touchSession(c, user, sessionID)
+
+	// Retrieve the current signing key from our keyring.
+	kid, signingKey := app.Keyring.Current()
 
 	// Save current timestamp.
 	nowTime := time.Now()
-	expTime := nowTime.Add(app.SessionValidFor).Format(time.RFC3339)
 
 	// At this point, the user exists and provided a correct password.
 	// Create a JWT with claims to identify user.
-	sessionJWT := jwt.New(jwt.SigningMethodHS512)
+	sessionJWT := jwt.New(jwt.SigningMethodRS256)
+	sessionJWT.Header["kid"] = kid
 
 	claims := sessionJWT.Claims.(jwt.MapClaims)
 
 	// Add these claims.
-	claims["iss"] = user.Mail
-	claims["iat"] = nowTime.Format(time.RFC3339)
-	claims["nbf"] = nowTime.Add((-1 * time.Minute)).Format(time.RFC3339)
-	claims["exp"] = expTime
+	claims["jti"] = fmt.Sprintf("%s", uuid.NewV4())
+	claims["sid"] = sessionID
+	claims["sub"] = user.ID
+	claims["iss"] = app.JWTIssuer
+	claims["aud"] = app.JWTAudience
+	claims["iat"] = nowTime.Unix()
+	claims["nbf"] = nowTime.Add((-1 * time.Minute)).Unix()
+	claims["exp"] = nowTime.Add(app.SessionValidFor).Unix()
+
+	// Optionally tell consumers of this JWT about the user's groups.
+	// Our own authorization always uses the groups from database.
+	if app.JWTEmbedScopes {
+
+		var Groups []db.Group
+		app.DB.Model(user).Related(&Groups, "Groups")
+
+		scopes := make([]map[string]string, len(Groups))
+
+		for i, group := range Groups {
+
+			scopes[i] = map[string]string{
+				"ID":          group.ID,
+				"RegionID":    group.RegionId,
+				"AccessRight": group.AccessRight,
+			}
+		}
 
-	sessionJWTString, err := sessionJWT.SignedString([]byte(jwtSigningSecret))
+		claims["groups"] = scopes
+	}
+
+	sessionJWTString, err := sessionJWT.SignedString(signingKey)
 	if err != nil {
 		log.Fatalf("[makeToken] Creating JWT went wrong: %s.\nTerminating.", err)
 	}
@@ -189,6 +397,28 @@ func (app *App) makeToken(c *gin.Context, user *db.User) string {
 	return sessionJWTString
 }
 
+// Produce an opaque, single-use refresh token for supplied
+// session and store its hash in our database.
+func (app *App) makeRefreshToken(user *db.User, sessionID string) string {
+
+	refreshToken := generateOpaqueToken()
+	nowTime := time.Now()
+
+	RefreshToken := db.RefreshToken{
+		ID:        fmt.Sprintf("%s", uuid.NewV4()),
+		TokenHash: hashOpaqueToken(refreshToken),
+		FamilyID:  sessionID,
+		UserID:    user.ID,
+		Used:      false,
+		Revoked:   false,
+		CreatedAt: nowTime,
+		ExpiresAt: nowTime.Add(app.RefreshValidFor),
+	}
+	app.DB.Create(&RefreshToken)
+
+	return refreshToken
+}
+
 func (app *App) Login(c *gin.Context) {
 
 	var Payload LoginPayload
@@ -228,19 +458,37 @@ func (app *App) Login(c *gin.Context) {
 		return
 	}
 
+	clientIP := c.ClientIP()
+
+	// Refuse login attempts for locked mail addresses and IPs
+	// before doing any expensive password hashing.
+	if wait := app.LoginThrottle.RetryAfter(Payload.Mail, clientIP); wait > 0 {
+
+		c.Header("Retry-After", fmt.Sprintf("%d", int(math.Ceil(wait.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"Error": "Too many failed login attempts, try again later",
+		})
+
+		return
+	}
+
 	// Find user in database.
 	var User db.User
 	app.DB.First(&User, "mail = ?", Payload.Mail)
 
-	// Check if user is not known to our system.
-	if User.Mail == "" {
+	// Check if user is not known to our system. Service accounts can
+	// not log in with a password, they look like unknown users here.
+	if User.Mail == "" || User.ServiceAccount {
 		User.PasswordHash = ""
 	}
 
 	// Compare password hash from database with possible plaintext
 	// password from request. Compares in constant time.
-	err = bcrypt.CompareHashAndPassword([]byte(User.PasswordHash), []byte(Payload.Password))
-	if err != nil {
+	ok, upgrade := app.Passwords.Verify(User.PasswordHash, Payload.Password)
+	if !ok {
+
+		// Count this failed attempt towards a lockout.
+		app.LoginThrottle.Fail(Payload.Mail, clientIP)
 
 		// Signal client that an error occured.
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -250,19 +498,79 @@ func (app *App) Login(c *gin.Context) {
 		return
 	}
 
-	// Create session JWT and expiration time of JWT.
-	sessionJWTString := app.makeToken(c, &User)
+	// Previous failed attempts for this mail do not count anymore.
+	// With two-factor authentication, only a correct code clears
+	// them, otherwise codes could be guessed by logging in again.
+	if !User.TOTPEnabled {
+		app.LoginThrottle.Succeed(Payload.Mail)
+	}
 
-	// Deliver JWT to client that made the request.
+	// Rehash password if it was hashed with an outdated algorithm
+	// or cost. Only possible now that we know the plaintext.
+	if upgrade {
+
+		hash, err := app.Passwords.Hash(Payload.Password)
+		if err != nil {
+			log.Printf("[Login] Could not upgrade password hash of user %s: %s\n", User.ID, err)
+		} else {
+
+			// Only replace the hash we verified, the password might have changed meanwhile.
+			app.DB.Model(&db.User{}).Where("\"id\" = ? AND \"password_hash\" = ?", User.ID, User.PasswordHash).Update("password_hash", hash)
+			app.Principals.Invalidate(User.ID)
+		}
+	}
+
+	// Suspended users can not log in. As the password was correct,
+	// we can tell the user about the suspension and its reason.
+	if !User.Enabled {
+
+		c.JSON(http.StatusForbidden, gin.H{
+			"Error":  "Account is suspended",
+			"Reason": User.SuspensionReason,
+		})
+
+		return
+	}
+
+	// Users with two-factor authentication have to supply
+	// a code in a second step to finish their login.
+	if User.TOTPEnabled {
+
+		challengeToken, _ := app.makeOneTimeToken(User, db.OneTimeTokenLoginChallenge, (5 * time.Minute))
+
+		c.JSON(http.StatusOK, gin.H{
+			"TwoFactorRequired": true,
+			"ChallengeToken":    challengeToken,
+		})
+
+		return
+	}
+
+	app.startSession(c, &User)
+}
+
+// Starts a new session for supplied user after successful
+// login and sends JWT and refresh token to the client.
+func (app *App) startSession(c *gin.Context, user *db.User) {
+
+	// Start a new session for this login.
+	sessionID := fmt.Sprintf("%s", uuid.NewV4())
+
+	// Create session JWT and refresh token for this session.
+	sessionJWTString := app.makeToken(c, user, sessionID)
+	refreshToken := app.makeRefreshToken(user, sessionID)
+
+	// Deliver JWT and refresh token to client that made the request.
 	c.JSON(http.StatusOK, gin.H{
-		"AccessToken": sessionJWTString,
+		"AccessToken":  sessionJWTString,
+		"RefreshToken": refreshToken,
 	})
 }
 
 func (app *App) RenewToken(c *gin.Context) {
 
 	// Check authorization for this function.
-	ok, User, message := app.Authorize(c.Request)
+	ok, User, claims, message := app.AuthorizeWithClaims(c.Request)
 	if !ok {
 
 		// Signal client an error and expect authorization.
@@ -272,8 +580,11 @@ func (app *App) RenewToken(c *gin.Context) {
 		return
 	}
 
+	// Stay within the session of the supplied JWT.
+	sessionID, _ := claims["sid"].(string)
+
 	// Create session JWT and expiration time of JWT.
-	sessionJWTString := app.makeToken(c, User)
+	sessionJWTString := app.makeToken(c, User, sessionID)
 
 	// Deliver JWT to client that made the request.
 	c.JSON(http.StatusOK, gin.H{
@@ -283,6 +594,43 @@ func (app *App) RenewToken(c *gin.Context) {
 
 func (app *App) Logout(c *gin.Context) {
 
+	// Check authorization for this function.
+	ok, User, claims, message := app.AuthorizeWithClaims(c.Request)
+	if !ok {
+
+		// Signal client an error and expect authorization.
+		c.Header("WWW-Authenticate", fmt.Sprintf("Bearer realm=\"CaTUstrophy\", error=\"invalid_token\", error_description=\"%s\"", message))
+		c.Status(http.StatusUnauthorized)
+
+		return
+	}
+
+	// Expiration date was already validated in authorization.
+	exp, _ := claimTime(claims, "exp")
+
+	// Put this JWT on the revocation list until it would have expired anyway.
+	RevokedToken := db.RevokedToken{
+		ID:        claims["jti"].(string),
+		UserID:    User.ID,
+		ExpiresAt: exp,
+	}
+	app.DB.Create(&RevokedToken)
+
+	// Neither this session nor its refresh tokens may be used anymore.
+	if sessionID, ok := claims["sid"].(string); ok && sessionID != "" {
+		app.revokeSessions(User.ID, sessionID)
+	}
+
+	// Signal client success and return ID of logged out user.
+	c.JSON(http.StatusOK, gin.H{
+		"ID": User.ID,
+	})
+}
+
+// Revokes all JWTs of the authorized user that were
+// issued up to now, including the one used for this request.
+func (app *App) LogoutAll(c *gin.Context) {
+
 	// Check authorization for this function.
 	ok, User, message := app.Authorize(c.Request)
 	if !ok {
@@ -294,8 +642,94 @@ func (app *App) Logout(c *gin.Context) {
 		return
 	}
 
+	// Every JWT issued before this point in time is invalid from now on.
+	app.DB.Model(User).Update("sessions_revoked_at", time.Now())
+
+	// Same goes for all sessions and refresh tokens of this user.
+	app.DB.Model(&db.Session{}).Where("\"user_id\" = ?", User.ID).Update("revoked", true)
+	app.DB.Model(&db.RefreshToken{}).Where("\"user_id\" = ?", User.ID).Update("revoked", true)
+
+	app.Principals.Invalidate(User.ID)
+
 	// Signal client success and return ID of logged out user.
 	c.JSON(http.StatusOK, gin.H{
 		"ID": User.ID,
 	})
 }
+
+// Publishes the public keys our JWTs can currently be verified
+// with, so that other services do not need any shared secret.
+func (app *App) GetJWKS(c *gin.Context) {
+
+	c.JSON(http.StatusOK, gin.H{
+		"keys": app.Keyring.JWKs(),
+	})
+}
+
+// Exchanges a refresh token for a new pair of JWT and refresh
+// token. Every refresh token can only be used once. If a used
+// refresh token is presented again, it was most likely stolen
+// and we revoke all refresh tokens of that session.
+func (app *App) RefreshToken(c *gin.Context) {
+
+	var Payload RefreshPayload
+
+	// Expect refresh token in JSON request body.
+	if ok := app.ValidatePayloadShort(c, &Payload); !ok {
+		return
+	}
+
+	// Find refresh token in database.
+	var RefreshToken db.RefreshToken
+	app.DB.First(&RefreshToken, "\"token_hash\" = ?", hashOpaqueToken(Payload.RefreshToken))
+
+	if RefreshToken.ID == "" || RefreshToken.Revoked || RefreshToken.ExpiresAt.Before(time.Now()) {
+
+		c.JSON(http.StatusBadRequest, gin.H{
+			"RefreshToken": "Is invalid or expired",
+		})
+
+		return
+	}
+
+	// Mark refresh token as used. Only one request can succeed here,
+	// even if the same token is presented multiple times concurrently.
+	result := app.DB.Model(&db.RefreshToken{}).Where("\"id\" = ? AND \"used\" = ?", RefreshToken.ID, false).Update("used", true)
+
+	if result.RowsAffected == 0 {
+
+		// Refresh token was already used: revoke the whole session
+		// including the JWTs handed out with the stolen tokens.
+		app.revokeSessions(RefreshToken.UserID, RefreshToken.FamilyID)
+		log.Printf("[RefreshToken] Reuse of refresh token detected for user %s. Revoked session %s.\n", RefreshToken.UserID, RefreshToken.FamilyID)
+
+		c.JSON(http.StatusBadRequest, gin.H{
+			"RefreshToken": "Is invalid or expired",
+		})
+
+		return
+	}
+
+	// Find user this refresh token was issued to.
+	var User db.User
+	app.DB.First(&User, "\"id\" = ?", RefreshToken.UserID)
+
+	if User.ID == "" || !User.Enabled {
+
+		c.JSON(http.StatusBadRequest, gin.H{
+			"RefreshToken": "Is invalid or expired",
+		})
+
+		return
+	}
+
+	// Create new JWT and refresh token within the same session.
+	sessionJWTString := app.makeToken(c, &User, RefreshToken.FamilyID)
+	refreshToken := app.makeRefreshToken(&User, RefreshToken.FamilyID)
+
+	// Deliver JWT and refresh token to client that made the request.
+	c.JSON(http.StatusOK, gin.H{
+		"AccessToken":  sessionJWTString,
+		"RefreshToken": refreshToken,
+	})
+}
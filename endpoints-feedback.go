@@ -0,0 +1,391 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"net/http"
+
+	"github.com/caTUstrophy/backend/db"
+	"github.com/gin-gonic/gin"
+	"github.com/satori/go.uuid"
+)
+
+// Structs
+
+type FeedbackPayload struct {
+	Rating  int    `validate:"required"`
+	Comment string `conform:"trim"`
+}
+
+// Constants
+
+const (
+	// Ratings range from 1 to maxRating, ratings
+	// of at most badRating count as bad ones.
+	maxRating = 5
+	badRating = 2
+
+	// Users with this many bad ratings in a region
+	// get flagged to the region's admins.
+	flaggedMinBadRatings = 2
+
+	maxFeedbackCommentLength = 500
+)
+
+// Functions
+
+// Aggregates all ratings supplied user received.
+func (app *App) reputation(userID string) map[string]interface{} {
+
+	var ratings, badRatings int
+	var average float64
+
+	row := app.DB.Model(&db.Feedback{}).Select("COUNT(*), COALESCE(AVG(\"rating\"), 0), COUNT(CASE WHEN \"rating\" <= ? THEN 1 END)", badRating).Where("\"subject_id\" = ?", userID).Row()
+	row.Scan(&ratings, &average, &badRatings)
+
+	return map[string]interface{}{
+		"Ratings":    ratings,
+		"Average":    average,
+		"BadRatings": badRatings,
+	}
+}
+
+// Loads the matching referenced in request URL together with its
+// region, offer and request. On fail writes an error response.
+func (app *App) getMatching(c *gin.Context) *db.Matching {
+
+	matchingID := app.getUUID(c, "matchingID")
+	if matchingID == "" {
+		return nil
+	}
+
+	var Matching db.Matching
+	app.DB.First(&Matching, "\"id\" = ?", matchingID)
+
+	if Matching.ID == "" {
+
+		c.JSON(http.StatusNotFound, gin.H{
+			"Error": "The matching you requested does not exist.",
+		})
+
+		return nil
+	}
+
+	app.DB.Model(&Matching).Related(&Matching.Region)
+	app.DB.Model(&Matching).Related(&Matching.Offer)
+	app.DB.Model(&Matching).Related(&Matching.Request)
+
+	return &Matching
+}
+
+// Confirms that offer and request of a matching were handed
+// over. The matching is completed once both parties confirmed
+// or an admin of the region, who is no party, did. Afterwards
+// both parties can give feedback.
+func (app *App) CompleteMatching(c *gin.Context) {
+
+	// Check authorization for this function.
+	User := app.AuthorizeShort(c)
+	if User == nil {
+		return
+	}
+
+	Matching := app.getMatching(c)
+	if Matching == nil {
+		return
+	}
+
+	ownsOffer := app.ownsItem(User, Matching.Offer.UserID, Matching.Offer.OrganisationID)
+	ownsRequest := app.ownsItem(User, Matching.Request.UserID, Matching.Request.OrganisationID)
+
+	// Check if user permissions are sufficient (user is concerned user or admin in region).
+	if ok := (ownsOffer || ownsRequest || app.CheckScope(User, Matching.Region, db.PermissionMatchingUpdate)); !ok {
+
+		// Signal client that the provided authorization was not sufficient.
+		c.Header("WWW-Authenticate", "Bearer realm=\"CaTUstrophy\", error=\"authentication_failed\", error_description=\"Could not authenticate the request\"")
+		c.Status(http.StatusUnauthorized)
+
+		return
+	}
+
+	if Matching.Invalid {
+
+		c.JSON(http.StatusBadRequest, gin.H{
+			"Error": "An invalid matching can not be completed",
+		})
+
+		return
+	}
+
+	if !Matching.Completed {
+
+		before := gin.H{
+			"OfferConfirmed":   Matching.OfferConfirmed,
+			"RequestConfirmed": Matching.RequestConfirmed,
+			"Completed":        Matching.Completed,
+		}
+
+		// A party only confirms its own side, so that
+		// no party can complete the matching alone.
+		if ownsOffer {
+			Matching.OfferConfirmed = true
+		}
+
+		if ownsRequest {
+			Matching.RequestConfirmed = true
+		}
+
+		Matching.Completed = (Matching.OfferConfirmed && Matching.RequestConfirmed) || (!ownsOffer && !ownsRequest)
+
+		app.DB.Model(Matching).Updates(map[string]interface{}{
+			"offer_confirmed":   Matching.OfferConfirmed,
+			"request_confirmed": Matching.RequestConfirmed,
+			"completed":         Matching.Completed,
+		})
+
+		app.audit(app.DB, c, User, db.AuditMatchingComplete, "matching", Matching.ID, Matching.RegionId, before, gin.H{
+			"OfferConfirmed":   Matching.OfferConfirmed,
+			"RequestConfirmed": Matching.RequestConfirmed,
+			"Completed":        Matching.Completed,
+		})
+	}
+
+	app.DB.Model(&Matching.Offer).Related(&Matching.Offer.User)
+	app.DB.Model(&Matching.Request).Related(&Matching.Request.User)
+	app.loadTrustLevel(&Matching.Offer, Matching.RegionId)
+
+	// Only expose fields that are necessary and
+	// contact details the user may see.
+	model := app.protectContacts(User, CopyNestedModel(*Matching, fieldsMatching))
+
+	c.JSON(http.StatusOK, model)
+}
+
+// Rates the user of the other side of a completed matching.
+// Every side of a matching can give feedback once.
+func (app *App) CreateFeedback(c *gin.Context) {
+
+	// Check authorization for this function.
+	User := app.AuthorizeShort(c)
+	if User == nil {
+		return
+	}
+
+	Matching := app.getMatching(c)
+	if Matching == nil {
+		return
+	}
+
+	ownsOffer := app.ownsItem(User, Matching.Offer.UserID, Matching.Offer.OrganisationID)
+	ownsRequest := app.ownsItem(User, Matching.Request.UserID, Matching.Request.OrganisationID)
+
+	// Only parties of the matching give feedback.
+	if !ownsOffer && !ownsRequest {
+
+		// Signal client that the provided authorization was not sufficient.
+		c.Header("WWW-Authenticate", "Bearer realm=\"CaTUstrophy\", error=\"authentication_failed\", error_description=\"Could not authenticate the request\"")
+		c.Status(http.StatusUnauthorized)
+
+		return
+	}
+
+	if ownsOffer && ownsRequest {
+
+		c.JSON(http.StatusBadRequest, gin.H{
+			"Error": "You are on both sides of this matching",
+		})
+
+		return
+	}
+
+	var Payload FeedbackPayload
+
+	// Expect rating and comment in JSON request body.
+	if ok := app.ValidatePayloadShort(c, &Payload); !ok {
+		return
+	}
+
+	if Payload.Rating < 1 || Payload.Rating > maxRating {
+
+		c.JSON(http.StatusBadRequest, gin.H{
+			"Rating": fmt.Sprintf("Has to be between 1 and %d", maxRating),
+		})
+
+		return
+	}
+
+	if len([]rune(Payload.Comment)) > maxFeedbackCommentLength {
+
+		c.JSON(http.StatusBadRequest, gin.H{
+			"Comment": "Is too long",
+		})
+
+		return
+	}
+
+	if Matching.Invalid || !Matching.Completed {
+
+		c.JSON(http.StatusBadRequest, gin.H{
+			"Error": "Feedback can only be given on completed matchings",
+		})
+
+		return
+	}
+
+	Feedback := db.Feedback{
+		ID:         fmt.Sprintf("%s", uuid.NewV4()),
+		MatchingID: Matching.ID,
+		RegionID:   Matching.RegionId,
+		AuthorID:   User.ID,
+		Rating:     Payload.Rating,
+		Comment:    Payload.Comment,
+		CreatedAt:  time.Now(),
+	}
+
+	if ownsOffer {
+		Feedback.Side = db.FeedbackSideOffer
+		Feedback.SubjectID = Matching.Request.UserID
+	} else {
+		Feedback.Side = db.FeedbackSideRequest
+		Feedback.SubjectID = Matching.Offer.UserID
+	}
+
+	// Feedback is unique per matching and side, so concurrent
+	// requests of the same side can not both be stored.
+	if err := app.DB.Create(&Feedback).Error; err != nil {
+
+		c.JSON(http.StatusBadRequest, gin.H{
+			"Error": "Feedback was already given for your side of this matching",
+		})
+
+		return
+	}
+
+	model := CopyNestedModel(Feedback, fieldsFeedback)
+
+	c.JSON(http.StatusCreated, model)
+}
+
+// Lists feedback given on a matching to its parties
+// and admins of its region.
+func (app *App) ListFeedbackForMatching(c *gin.Context) {
+
+	// Check authorization for this function.
+	User := app.AuthorizeShort(c)
+	if User == nil {
+		return
+	}
+
+	Matching := app.getMatching(c)
+	if Matching == nil {
+		return
+	}
+
+	// Check if user permissions are sufficient (user is concerned user or admin in region).
+	if ok := (app.ownsItem(User, Matching.Offer.UserID, Matching.Offer.OrganisationID) || app.ownsItem(User, Matching.Request.UserID, Matching.Request.OrganisationID) || app.CheckScope(User, Matching.Region, db.PermissionMatchingRead)); !ok {
+
+		// Signal client that the provided authorization was not sufficient.
+		c.Header("WWW-Authenticate", "Bearer realm=\"CaTUstrophy\", error=\"authentication_failed\", error_description=\"Could not authenticate the request\"")
+		c.Status(http.StatusUnauthorized)
+
+		return
+	}
+
+	var Feedbacks []db.Feedback
+	app.DB.Order("\"created_at\"").Find(&Feedbacks, "\"matching_id\" = ?", Matching.ID)
+
+	model := CopyNestedModel(Feedbacks, fieldsFeedback)
+
+	c.JSON(http.StatusOK, model)
+}
+
+// Lists users who received repeated bad ratings on matchings
+// of a region, the ones with most bad ratings first.
+func (app *App) ListFlaggedUsersInRegion(c *gin.Context) {
+
+	// Check authorization for this function.
+	User := app.AuthorizeShort(c)
+	if User == nil {
+		return
+	}
+
+	Region := app.getRegionWithPermission(c, User, db.PermissionRegionUserRead)
+	if Region == nil {
+		return
+	}
+
+	rows, err := app.DB.Model(&db.Feedback{}).
+		Select("\"subject_id\", COUNT(*)").
+		Where("\"region_id\" = ? AND \"rating\" <= ?", Region.ID, badRating).
+		Group("\"subject_id\"").
+		Having("COUNT(*) >= ?", flaggedMinBadRatings).
+		Order("COUNT(*) DESC").
+		Rows()
+	if err != nil {
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"Error": "Could not load flagged users, please try again later.",
+		})
+
+		return
+	}
+	defer rows.Close()
+
+	model := make([]map[string]interface{}, 0)
+
+	for rows.Next() {
+
+		var subjectID string
+		var badRatingsInRegion int
+
+		if err := rows.Scan(&subjectID, &badRatingsInRegion); err != nil {
+			continue
+		}
+
+		var flaggedUser db.User
+		app.DB.First(&flaggedUser, "\"id\" = ? AND \"deleted\" = ?", subjectID, false)
+
+		if flaggedUser.ID == "" {
+			continue
+		}
+
+		entry := CopyNestedModel(flaggedUser, fieldsUserNoGroups).(map[string]interface{})
+		entry["Reputation"] = app.reputation(flaggedUser.ID)
+		entry["BadRatingsInRegion"] = badRatingsInRegion
+
+		model = append(model, entry)
+	}
+
+	// Admins see contact details only after revealing them.
+	app.protectContacts(User, model)
+
+	c.JSON(http.StatusOK, model)
+}
+
+// Lists all feedback a user received on matchings of a region.
+func (app *App) ListFeedbackForUserInRegion(c *gin.Context) {
+
+	// Check authorization for this function.
+	User := app.AuthorizeShort(c)
+	if User == nil {
+		return
+	}
+
+	Region := app.getRegionWithPermission(c, User, db.PermissionRegionUserRead)
+	if Region == nil {
+		return
+	}
+
+	userID := app.getUUID(c, "userID")
+	if userID == "" {
+		return
+	}
+
+	var Feedbacks []db.Feedback
+	app.DB.Order("\"created_at\" DESC").Find(&Feedbacks, "\"region_id\" = ? AND \"subject_id\" = ?", Region.ID, userID)
+
+	model := CopyNestedModel(Feedbacks, fieldsFeedback)
+
+	c.JSON(http.StatusOK, model)
+}
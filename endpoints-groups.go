@@ -35,7 +35,7 @@ func (app *App) GetGroups(c *gin.Context) {
 	}
 
 	// Check if user permissions are sufficient (user is admin).
-	if ok = app.CheckScope(User, db.Region{}, "superadmin"); !ok {
+	if ok = app.CheckScope(User, db.Region{}, db.PermissionGroupRead); !ok {
 
 		// Signal client that the provided authorization was not sufficient.
 		c.Header("WWW-Authenticate", "Bearer realm=\"CaTUstrophy\", error=\"authentication_failed\", error_description=\"Could not authenticate the request\"")
@@ -80,7 +80,7 @@ func (app *App) ListSystemAdmins(c *gin.Context) {
 	}
 
 	// Check if user permissions are sufficient (user is admin).
-	if ok := app.CheckScope(User, db.Region{}, "superadmin"); !ok {
+	if ok := app.CheckScope(User, db.Region{}, db.PermissionSystemAdminRead); !ok {
 
 		// Signal client that the provided authorization was not sufficient.
 		c.Header("WWW-Authenticate", "Bearer realm=\"CaTUstrophy\", error=\"authentication_failed\", error_description=\"Could not authenticate the request\"")
@@ -90,7 +90,7 @@ func (app *App) ListSystemAdmins(c *gin.Context) {
 	}
 
 	var group db.Group
-	app.DB.Preload("Users").First(&group, "access_right = ?", "superadmin")
+	app.DB.Preload("Users").First(&group, "access_right = ?", db.RoleSuperadmin)
 
 	model := CopyNestedModel(group.Users, fieldsSystemAdmin)
 
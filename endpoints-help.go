@@ -15,16 +15,19 @@ import (
 
 var ReplacementsJSON = map[string]interface{}{
 	"time.Time":           "RFC3339 date",
-	"db.PhoneNumbers":     "[string, ...]",
+	"*time.Time":          "RFC3339 date or null",
+	"db.PhoneNumbers":     "[{\"Label\": string, \"Number\": E.164 string}, ...]",
 	"db.NotificationType": "string",
+	"db.AuditChanges":     "{string: {\"Before\": any, \"After\": any}, ...}",
 }
 
 var ReplacementsJSONbyKey = map[string]interface{}{
-	"ID":        "UUID v4",
-	"OfferId":   "UUID v4",
-	"RequestId": "UUID v4",
-	"RegionId":  "UUID v4",
-	"UserId":    "UUID v4",
+	"ID":             "UUID v4",
+	"OfferId":        "UUID v4",
+	"RequestId":      "UUID v4",
+	"RegionId":       "UUID v4",
+	"UserId":         "UUID v4",
+	"OrganisationID": "UUID v4",
 }
 
 // This function generates documentation like we present in README
@@ -47,7 +50,7 @@ func (app *App) GetJsonResponseInfo(c *gin.Context) {
 	}
 
 	// Check if user permissions are sufficient (user is admin).
-	if ok = app.CheckScope(authUser, db.Region{}, "superadmin"); !ok {
+	if ok = app.CheckScope(authUser, db.Region{}, db.PermissionSystemHelpRead); !ok {
 
 		// Signal client that the provided authorization was not sufficient.
 		c.Header("WWW-Authenticate", "Bearer realm=\"CaTUstrophy\", error=\"authentication_failed\", error_description=\"Could not authenticate the request\"")
@@ -93,6 +96,39 @@ func (app *App) GetJsonResponseInfo(c *gin.Context) {
 	usersNoGroup[0] = allResponses["User without groups"].(map[string]interface{})
 	allResponses["List of users without group"] = usersNoGroup
 
+	// API KEY
+	var apiKey db.APIKey
+	app.DB.First(&apiKey)
+	currResponseMap = getJSONResponseInfo(apiKey, fieldsAPIKey)
+	allResponses["API key"] = currResponseMap
+
+	// API KEYS LIST
+	var apiKeys [1]map[string]interface{}
+	apiKeys[0] = allResponses["API key"].(map[string]interface{})
+	allResponses["API keys"] = apiKeys
+
+	// ROLE
+	var role db.Role
+	app.DB.Preload("Permissions").First(&role, "\"name\" = ?", db.RoleAdmin)
+	currResponseMap = getJSONResponseInfo(role, fieldsRole)
+	allResponses["Role"] = currResponseMap
+
+	// ROLES LIST
+	var roles [1]map[string]interface{}
+	roles[0] = allResponses["Role"].(map[string]interface{})
+	allResponses["Roles"] = roles
+
+	// AUDIT ENTRY
+	var auditEntry db.AuditEntry
+	app.DB.First(&auditEntry)
+	currResponseMap = getJSONResponseInfo(auditEntry, fieldsAuditEntry)
+	allResponses["Audit entry"] = currResponseMap
+
+	// AUDIT ENTRIES LIST
+	var auditEntries [1]map[string]interface{}
+	auditEntries[0] = allResponses["Audit entry"].(map[string]interface{})
+	allResponses["Audit entries"] = auditEntries
+
 	// TAGS LIST
 	var tag db.Tag
 	var tags [1]map[string]interface{}
@@ -0,0 +1,394 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"net/http"
+
+	"github.com/caTUstrophy/backend/db"
+	"github.com/gin-gonic/gin"
+	"github.com/satori/go.uuid"
+)
+
+// Structs
+
+type InvitationPayload struct {
+	Mail  string `conform:"trim,email" validate:"required,email"`
+	Role  string `conform:"trim,lower"`
+	Group string `conform:"trim"`
+}
+
+// Name and password are only needed if
+// accepting creates a new account.
+type AcceptInvitationPayload struct {
+	Token         string `conform:"trim" validate:"required"`
+	Name          string `conform:"trim" validate:"excludesall=!@#$%^&*()_+-=:;?/0x2C0x7C"`
+	PreferredName string `conform:"trim" validate:"excludesall=!@#$%^&*()_+-=:;?/0x2C0x7C"`
+	PhoneNumbers  []PhoneNumberPayload
+	Password      string
+}
+
+// Functions
+
+// Sends the invitation link to the invited mail address.
+func (app *App) sendInvitationMail(invitation db.Invitation, link string, regionName string, inviterName string) {
+
+	body := fmt.Sprintf("Hello,\n\n%s invited you to help as %s in region %s on CaTUstrophy. To accept, open the following link:\n\n%s\n\nThe link is valid until %s. If you do not have an account yet, you can create one there. If you did not expect this invitation, you can ignore this mail.\n", inviterName, invitation.Role, regionName, link, invitation.ExpiresAt.Format(time.RFC1123))
+
+	err := app.Mailer.Send(invitation.Mail, "You are invited to CaTUstrophy", body)
+	if err != nil {
+		log.Printf("[sendInvitationMail] Sending invitation %s failed: %s\n", invitation.ID, err)
+	}
+}
+
+// Returns the group an invitation should grant: either the group
+// for supplied role in supplied region, created if necessary, or
+// supplied group of that region. Nobody may invite to permissions
+// they don't hold themselves. On fail writes an error response.
+func (app *App) invitableGroup(c *gin.Context, User *db.User, Region db.Region, Payload InvitationPayload) (db.Group, bool) {
+
+	if (Payload.Role == "") == (Payload.Group == "") {
+
+		c.JSON(http.StatusBadRequest, gin.H{
+			"Role": "Either role or group is required",
+		})
+
+		return db.Group{}, false
+	}
+
+	if Payload.Role != "" {
+		return app.grantableGroup(c, User, Region, Payload.Role)
+	}
+
+	var Group db.Group
+	app.DB.First(&Group, "\"id\" = ? AND \"region_id\" = ?", Payload.Group, Region.ID)
+
+	if Group.ID == "" {
+
+		c.JSON(http.StatusNotFound, gin.H{
+			"Error": "The group you requested does not exist in this region.",
+		})
+
+		return db.Group{}, false
+	}
+
+	var Role db.Role
+	app.DB.Preload("Permissions").First(&Role, "\"id\" = ?", Group.RoleID)
+
+	if ok := app.mayGrantRole(c, User, Region, Role); !ok {
+		return db.Group{}, false
+	}
+
+	return Group, true
+}
+
+// Invites a mail address to take over a role in a region, no
+// matter if an account with it exists yet. The invitation link
+// is mailed to the address and handed out once in the response,
+// so that it can also be passed on through other channels.
+func (app *App) CreateInvitationInRegion(c *gin.Context) {
+
+	// Check authorization for this function.
+	User := app.AuthorizeShort(c)
+	if User == nil {
+		return
+	}
+
+	Region := app.getRegionWithPermission(c, User, db.PermissionRegionRoleGrant)
+	if Region == nil {
+		return
+	}
+
+	var Payload InvitationPayload
+
+	// Expect mail and either role or group in JSON request body.
+	if ok := app.ValidatePayloadShort(c, &Payload); !ok {
+		return
+	}
+
+	Group, ok := app.invitableGroup(c, User, *Region, Payload)
+	if !ok {
+		return
+	}
+
+	token := generateOpaqueToken()
+	nowTime := time.Now()
+
+	Invitation := db.Invitation{
+		ID:          fmt.Sprintf("%s", uuid.NewV4()),
+		TokenHash:   hashOpaqueToken(token),
+		Mail:        Payload.Mail,
+		RegionID:    Region.ID,
+		GroupID:     Group.ID,
+		Role:        Group.AccessRight,
+		CreatedByID: User.ID,
+		CreatedAt:   nowTime,
+		ExpiresAt:   nowTime.Add(app.InviteValidFor),
+		Revoked:     false,
+	}
+
+	model := CopyNestedModel(Invitation, fieldsInvitation)
+
+	// A new invitation replaces open ones for the same mail and group.
+	tx := app.DB.Begin()
+	tx.Model(&db.Invitation{}).Where("\"mail\" = ? AND \"group_id\" = ? AND \"accepted_at\" IS NULL AND \"revoked\" = ?", Invitation.Mail, Group.ID, false).Update("revoked", true)
+	tx.Create(&Invitation)
+	app.audit(tx, c, User, db.AuditInvitationCreate, "invitation", Invitation.ID, Region.ID, nil, model)
+	tx.Commit()
+
+	// The link is only sent to the invited mail address, as accepting
+	// it with a new account proves to own that address.
+	link := fmt.Sprintf("%s/invitation?token=%s", app.FrontendURL, token)
+	go app.sendInvitationMail(Invitation, link, Region.Name, User.Name)
+
+	c.JSON(http.StatusCreated, model)
+}
+
+// Lists all invitations of a region, newest first, including
+// accepted, revoked and expired ones.
+func (app *App) ListInvitationsForRegion(c *gin.Context) {
+
+	// Check authorization for this function.
+	User := app.AuthorizeShort(c)
+	if User == nil {
+		return
+	}
+
+	Region := app.getRegionWithPermission(c, User, db.PermissionRegionRoleGrant)
+	if Region == nil {
+		return
+	}
+
+	var Invitations []db.Invitation
+	app.DB.Order("\"created_at\" DESC").Find(&Invitations, "\"region_id\" = ?", Region.ID)
+
+	model := CopyNestedModel(Invitations, fieldsInvitation)
+
+	c.JSON(http.StatusOK, model)
+}
+
+func (app *App) RevokeInvitationInRegion(c *gin.Context) {
+
+	// Check authorization for this function.
+	User := app.AuthorizeShort(c)
+	if User == nil {
+		return
+	}
+
+	Region := app.getRegionWithPermission(c, User, db.PermissionRegionRoleGrant)
+	if Region == nil {
+		return
+	}
+
+	invitationID := app.getUUID(c, "invitationID")
+	if invitationID == "" {
+		return
+	}
+
+	var Invitation db.Invitation
+	app.DB.First(&Invitation, "\"id\" = ? AND \"region_id\" = ?", invitationID, Region.ID)
+
+	if Invitation.ID == "" || Invitation.Revoked {
+
+		c.JSON(http.StatusNotFound, gin.H{
+			"Error": "The invitation you requested does not exist.",
+		})
+
+		return
+	}
+
+	if Invitation.AcceptedAt != nil {
+
+		c.JSON(http.StatusBadRequest, gin.H{
+			"Error": "The invitation was already accepted. Demote the user instead.",
+		})
+
+		return
+	}
+
+	app.DB.Model(&Invitation).Update("revoked", true)
+
+	app.audit(app.DB, c, User, db.AuditInvitationRevoke, "invitation", Invitation.ID, Region.ID, gin.H{"Revoked": false}, gin.H{"Revoked": true})
+
+	model := CopyNestedModel(Invitation, fieldsInvitation)
+
+	c.JSON(http.StatusOK, model)
+}
+
+// Accepts an invitation. With authorization, the role goes to the
+// authorized user, who has to own the invited mail address and have
+// it verified, so that a leaked link can not be used by others.
+// Otherwise a new account for the invited mail address is created,
+// which counts as verified, as the link was sent to it.
+func (app *App) AcceptInvitation(c *gin.Context) {
+
+	var Payload AcceptInvitationPayload
+
+	// Expect token and, for new accounts, profile in JSON request body.
+	if ok := app.ValidatePayloadShort(c, &Payload); !ok {
+		return
+	}
+
+	var Invitation db.Invitation
+	app.DB.First(&Invitation, "\"token_hash\" = ?", hashOpaqueToken(Payload.Token))
+
+	if Invitation.ID == "" || Invitation.Revoked || Invitation.AcceptedAt != nil || Invitation.ExpiresAt.Before(time.Now()) {
+
+		c.JSON(http.StatusBadRequest, gin.H{
+			"Token": "Is invalid or expired",
+		})
+
+		return
+	}
+
+	var acceptingUser db.User
+	created := false
+
+	if c.Request.Header.Get("Authorization") != "" || c.Request.Header.Get("X-API-Key") != "" {
+
+		User := app.AuthorizeShort(c)
+		if User == nil {
+			return
+		}
+
+		if User.ServiceAccount {
+
+			c.JSON(http.StatusBadRequest, gin.H{
+				"Error": "Service accounts can not accept invitations.",
+			})
+
+			return
+		}
+
+		if !strings.EqualFold(User.Mail, Invitation.Mail) || !User.MailVerified {
+
+			c.JSON(http.StatusForbidden, gin.H{
+				"Error": "The invitation was sent to another mail address. Verify your mail address or log in with the invited one.",
+			})
+
+			return
+		}
+
+		app.DB.First(&acceptingUser, "\"id\" = ?", User.ID)
+	} else {
+
+		var CountDup int
+		app.DB.Model(&db.User{}).Where("\"mail\" = ?", Invitation.Mail).Count(&CountDup)
+
+		if CountDup > 0 {
+
+			c.JSON(http.StatusBadRequest, gin.H{
+				"Mail": "Already exists, log in to accept the invitation",
+			})
+
+			return
+		}
+
+		errResp := make(map[string]string)
+
+		if Payload.Name == "" {
+			errResp["Name"] = "Is required"
+		}
+
+		if Payload.Password == "" {
+			errResp["Password"] = "Is required"
+		}
+
+		if len(errResp) > 0 {
+			c.JSON(http.StatusBadRequest, errResp)
+			return
+		}
+
+		// Check password against our password policy.
+		if ok := app.checkPasswordPolicy(c, Payload.Password, Payload.Name, Payload.PreferredName, Invitation.Mail); !ok {
+			return
+		}
+
+		PhoneNumbers, ok := app.parsePhoneNumbers(c, Payload.PhoneNumbers)
+		if !ok {
+			return
+		}
+
+		hash, err := app.Passwords.Hash(Payload.Password)
+		if err != nil {
+			// If there was an error during hash creation - terminate immediately.
+			log.Fatal("[AcceptInvitation] Error while generating hash in user creation. Terminating.")
+		}
+
+		var DefaultGroup db.Group
+		app.DB.First(&DefaultGroup, "\"default_group\" = ?", true)
+
+		acceptingUser = db.User{
+			ID:            fmt.Sprintf("%s", uuid.NewV4()),
+			Name:          Payload.Name,
+			PreferredName: Payload.PreferredName,
+			Mail:          Invitation.Mail,
+			MailVerified:  true,
+			PhoneNumbers:  PhoneNumbers,
+			PasswordHash:  hash,
+			Groups:        []db.Group{DefaultGroup},
+			Enabled:       true,
+		}
+		created = true
+	}
+
+	var Group db.Group
+	app.DB.First(&Group, "\"id\" = ?", Invitation.GroupID)
+
+	if Group.ID == "" {
+
+		c.JSON(http.StatusBadRequest, gin.H{
+			"Token": "Is invalid or expired",
+		})
+
+		return
+	}
+
+	nowTime := time.Now()
+
+	tx := app.DB.Begin()
+
+	// Mark invitation as accepted. Only one request can succeed here.
+	result := tx.Model(&db.Invitation{}).Where("\"id\" = ? AND \"accepted_at\" IS NULL AND \"revoked\" = ?", Invitation.ID, false).Updates(map[string]interface{}{
+		"accepted_by_id": acceptingUser.ID,
+		"accepted_at":    nowTime,
+	})
+
+	if result.RowsAffected == 0 {
+
+		tx.Rollback()
+
+		c.JSON(http.StatusBadRequest, gin.H{
+			"Token": "Is invalid or expired",
+		})
+
+		return
+	}
+
+	if created {
+		tx.Create(&acceptingUser)
+	}
+
+	tx.Model(&acceptingUser).Association("Groups").Append(Group)
+	app.audit(tx, c, &acceptingUser, db.AuditInvitationAccept, "invitation", Invitation.ID, Invitation.RegionID, nil, gin.H{"User": acceptingUser.ID, "Group": Group.ID, "Role": Group.AccessRight})
+	tx.Commit()
+
+	app.Principals.Invalidate(acceptingUser.ID)
+
+	app.DB.Preload("Groups").First(&acceptingUser, "\"id\" = ?", acceptingUser.ID)
+
+	for groupLoop := range acceptingUser.Groups {
+		app.DB.Model(&acceptingUser.Groups[groupLoop]).Related(&acceptingUser.Groups[groupLoop].Region)
+	}
+
+	model := CopyNestedModel(acceptingUser, fieldsUser)
+
+	if created {
+		c.JSON(http.StatusCreated, model)
+	} else {
+		c.JSON(http.StatusOK, model)
+	}
+}
@@ -96,6 +96,20 @@ func (app *App) CreateMatching(c *gin.Context) {
 		return
 	}
 
+	// Check that offer and request do not belong to suspended users.
+	var CountSuspended int
+	app.DB.Model(&db.User{}).Where("\"id\" IN (?, ?) AND \"enabled\" = ?", Offer.UserID, Request.UserID, false).Count(&CountSuspended)
+
+	if CountSuspended > 0 {
+
+		// Signal request failure to client.
+		c.JSON(http.StatusBadRequest, gin.H{
+			"Matching": "Offer or request belongs to a suspended user",
+		})
+
+		return
+	}
+
 	// Check that offer or request are not already expired.
 	if (Offer.Expired) || (Request.Expired) {
 
@@ -136,7 +150,7 @@ func (app *App) CreateMatching(c *gin.Context) {
 	var ContainingRegion db.Region
 	app.DB.First(&ContainingRegion, "id = ?", Payload.Region)
 
-	if ok := app.CheckScope(User, ContainingRegion, "admin"); !ok {
+	if ok := app.CheckScope(User, ContainingRegion, db.PermissionMatchingCreate); !ok {
 
 		// Signal client that the provided authorization was not sufficient.
 		c.Header("WWW-Authenticate", "Bearer realm=\"CaTUstrophy\", error=\"authentication_failed\", error_description=\"Could not authenticate the request\"")
@@ -145,6 +159,21 @@ func (app *App) CreateMatching(c *gin.Context) {
 		return
 	}
 
+	// Check that the user of the offer holds the trust level
+	// the tags of the request require in this region.
+	var RequestTags []db.Tag
+	app.DB.Model(&Request).Association("Tags").Find(&RequestTags)
+
+	if required := app.requiredTrustLevel(ContainingRegion.ID, RequestTags); trustRank(app.trustLevel(Offer.UserID, []string{ContainingRegion.ID})) < trustRank(required) {
+
+		// Signal request failure to client.
+		c.JSON(http.StatusBadRequest, gin.H{
+			"Matching": fmt.Sprintf("Offer needs a user with trust level %s in this region", required),
+		})
+
+		return
+	}
+
 	// Save matching.
 	var Matching db.Matching
 	Matching.ID = fmt.Sprintf("%s", uuid.NewV4())
@@ -165,22 +194,25 @@ func (app *App) CreateMatching(c *gin.Context) {
 	app.DB.Save(&Request)
 
 	// Trigger a notification for involved users.
+	// Items of organisations notify all of their members.
 	NotifyOfferUser := db.Notification{
-		ID:        fmt.Sprintf("%s", uuid.NewV4()),
-		Type:      db.NotificationMatching,
-		UserID:    Offer.UserID,
-		ItemID:    Matching.ID,
-		Read:      false,
-		CreatedAt: time.Now(),
+		ID:             fmt.Sprintf("%s", uuid.NewV4()),
+		Type:           db.NotificationMatching,
+		UserID:         Offer.UserID,
+		OrganisationID: Offer.OrganisationID,
+		ItemID:         Matching.ID,
+		Read:           false,
+		CreatedAt:      time.Now(),
 	}
 
 	NotifyRequestUser := db.Notification{
-		ID:        fmt.Sprintf("%s", uuid.NewV4()),
-		Type:      db.NotificationMatching,
-		UserID:    Request.UserID,
-		ItemID:    Matching.ID,
-		Read:      false,
-		CreatedAt: time.Now(),
+		ID:             fmt.Sprintf("%s", uuid.NewV4()),
+		Type:           db.NotificationMatching,
+		UserID:         Request.UserID,
+		OrganisationID: Request.OrganisationID,
+		ItemID:         Matching.ID,
+		Read:           false,
+		CreatedAt:      time.Now(),
 	}
 
 	app.DB.Create(&NotifyOfferUser)
@@ -191,13 +223,19 @@ func (app *App) CreateMatching(c *gin.Context) {
 	app.DB.Model(&Matching.Offer).Related(&Matching.Offer.User)
 	app.DB.Model(&Matching).Related(&Matching.Request)
 	app.DB.Model(&Matching.Request).Related(&Matching.Request.User)
+	app.loadTrustLevel(&Matching.Offer, Matching.RegionId)
 
 	// Set recommendation of optimal matchings to false due to new matching.
 	// AKTUELL: ÜBER ALLE REGIONS VON OFFER UND REQUEST ITERIEREN UND ALLE AUF UPDATED = FALSE SETZEN.
 	// app.DB.Model({ alle concerned regions }).Update("RecommendationUpdated", false)
 
-	// Only expose fields that are necessary.
-	model := CopyNestedModel(Matching, fieldsMatching)
+	// Only expose fields that are necessary and
+	// contact details the user may see.
+	model := app.protectContacts(User, CopyNestedModel(Matching, fieldsMatching))
+
+	// The audit trail only references offer and request, their
+	// contents are anonymised when a user deletes the account.
+	app.audit(app.DB, c, User, db.AuditMatchingCreate, "matching", Matching.ID, Matching.RegionId, nil, gin.H{"Offer": Matching.OfferId, "Request": Matching.RequestId})
 
 	c.JSON(http.StatusCreated, model)
 }
@@ -205,7 +243,7 @@ func (app *App) CreateMatching(c *gin.Context) {
 func (app *App) GetMatching(c *gin.Context) {
 
 	// Check authorization for this function.
-	ok, _, message := app.Authorize(c.Request)
+	ok, User, message := app.Authorize(c.Request)
 	if !ok {
 
 		// Signal client an error and expect authorization.
@@ -229,13 +267,36 @@ func (app *App) GetMatching(c *gin.Context) {
 	// Retrieve the specified matching.
 	var Matching db.Matching
 	app.DB.First(&Matching, "id = ?", matchingID)
+
+	if Matching.ID == "" {
+
+		c.JSON(http.StatusNotFound, gin.H{
+			"Error": "The matching you requested does not exist.",
+		})
+
+		return
+	}
+
+	app.DB.Model(&Matching).Related(&Matching.Region)
 	app.DB.Model(&Matching).Related(&Matching.Offer)
 	app.DB.Model(&Matching.Offer).Related(&Matching.Offer.User)
 	app.DB.Model(&Matching).Related(&Matching.Request)
 	app.DB.Model(&Matching.Request).Related(&Matching.Request.User)
+	app.loadTrustLevel(&Matching.Offer, Matching.RegionId)
 
-	// Only expose fields that are necessary.
-	model := CopyNestedModel(Matching, fieldsMatching)
+	// Check if user permissions are sufficient (user is concerned user or admin in region).
+	if ok := (app.ownsItem(User, Matching.Offer.UserID, Matching.Offer.OrganisationID) || app.ownsItem(User, Matching.Request.UserID, Matching.Request.OrganisationID) || app.CheckScope(User, Matching.Region, db.PermissionMatchingRead)); !ok {
+
+		// Signal client that the provided authorization was not sufficient.
+		c.Header("WWW-Authenticate", "Bearer realm=\"CaTUstrophy\", error=\"authentication_failed\", error_description=\"Could not authenticate the request\"")
+		c.Status(http.StatusUnauthorized)
+
+		return
+	}
+
+	// Only expose fields that are necessary and
+	// contact details the user may see.
+	model := app.protectContacts(User, CopyNestedModel(Matching, fieldsMatching))
 
 	// Send back results to client.
 	c.JSON(http.StatusOK, model)
@@ -320,7 +381,7 @@ func (app *App) UpdateMatching(c *gin.Context) {
 
 	// Check if user permissions are sufficient (user is concerned user or admin in region).
 	// This conforms to the scope 'C' level of this handler.
-	if ok := ((Matching.Offer.UserID == User.ID) || (Matching.Request.UserID == User.ID) || app.CheckScope(User, Matching.Region, "admin")); !ok {
+	if ok := (app.ownsItem(User, Matching.Offer.UserID, Matching.Offer.OrganisationID) || app.ownsItem(User, Matching.Request.UserID, Matching.Request.OrganisationID) || app.CheckScope(User, Matching.Region, db.PermissionMatchingUpdate)); !ok {
 
 		// Signal client that the provided authorization was not sufficient.
 		c.Header("WWW-Authenticate", "Bearer realm=\"CaTUstrophy\", error=\"authentication_failed\", error_description=\"Could not authenticate the request\"")
@@ -339,6 +400,8 @@ func (app *App) UpdateMatching(c *gin.Context) {
 		return
 	}
 
+	before := gin.H{"Invalid": Matching.Invalid}
+
 	// All checks passed - set matching to invalid.
 	Matching.Invalid = true
 	app.DB.Save(&Matching)
@@ -352,9 +415,13 @@ func (app *App) UpdateMatching(c *gin.Context) {
 	// Load final needed additional data.
 	app.DB.Model(&Matching.Offer).Related(&Matching.Offer.User)
 	app.DB.Model(&Matching.Request).Related(&Matching.Request.User)
+	app.loadTrustLevel(&Matching.Offer, Matching.RegionId)
+
+	app.audit(app.DB, c, User, db.AuditMatchingUpdate, "matching", Matching.ID, Matching.RegionId, before, gin.H{"Invalid": Matching.Invalid})
 
-	// Only expose fields that are necessary.
-	model := CopyNestedModel(Matching, fieldsMatching)
+	// Only expose fields that are necessary and
+	// contact details the user may see.
+	model := app.protectContacts(User, CopyNestedModel(Matching, fieldsMatching))
 
 	// Send back results to client.
 	c.JSON(http.StatusOK, model)
@@ -1,15 +1,26 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"time"
 
+	"archive/zip"
+	"encoding/json"
 	"net/http"
 
 	"github.com/caTUstrophy/backend/db"
 	"github.com/gin-gonic/gin"
 )
 
+// Structs
+
+type DeleteMePayload struct {
+	Password string `validate:"required"`
+	Code     string `conform:"trim"`
+}
+
 // Functions
 
 func (app *App) GetMe(c *gin.Context) {
@@ -26,7 +37,8 @@ func (app *App) GetMe(c *gin.Context) {
 	}
 
 	// Marshal only necessary fields.
-	response := CopyNestedModel(*User, fieldsUser)
+	response := CopyNestedModel(*User, fieldsUser).(map[string]interface{})
+	response["Reputation"] = app.reputation(User.ID)
 
 	c.JSON(http.StatusOK, response)
 }
@@ -44,7 +56,7 @@ func (app *App) UpdateMe(c *gin.Context) {
 		return
 	}
 
-	app.UpdateUserObject(User, c, false)
+	app.UpdateUserObject(User, User, c, false)
 
 	return
 }
@@ -138,13 +150,15 @@ func (app *App) ListUserMatchings(c *gin.Context) {
 		// Load offer and request for this matching.
 		app.DB.Model(&Matching).Related(&Matching.Offer).Related(&Matching.Request)
 
-		// Check if user is owner of either the offer or the request.
-		if (Matching.Offer.UserID == User.ID) || (Matching.Request.UserID == User.ID) {
+		// Check if user owns either the offer or the request,
+		// possibly through an organisation.
+		if app.ownsItem(User, Matching.Offer.UserID, Matching.Offer.OrganisationID) || app.ownsItem(User, Matching.Request.UserID, Matching.Request.OrganisationID) {
 
 			// If so - load some more related data.
 			app.DB.Model(&Matching).Related(&Matching.Region)
 			app.DB.Model(&Matching.Offer).Related(&Matching.Offer.User)
 			app.DB.Model(&Matching.Request).Related(&Matching.Request.User)
+			app.loadTrustLevel(&Matching.Offer, Matching.RegionId)
 
 			// Add marshalled version of matching to response list.
 			response = append(response, CopyNestedModel(Matching, fieldsMatching))
@@ -153,3 +167,333 @@ func (app *App) ListUserMatchings(c *gin.Context) {
 
 	c.JSON(http.StatusOK, response)
 }
+
+// Lists all sessions of the authorized user that were not
+// signed out and have not yet expired, most recently used first.
+func (app *App) ListSessions(c *gin.Context) {
+
+	// Check authorization for this function.
+	ok, User, claims, message := app.AuthorizeWithClaims(c.Request)
+	if !ok {
+
+		// Signal client an error and expect authorization.
+		c.Header("WWW-Authenticate", fmt.Sprintf("Bearer realm=\"CaTUstrophy\", error=\"invalid_token\", error_description=\"%s\"", message))
+		c.Status(http.StatusUnauthorized)
+
+		return
+	}
+
+	var Sessions []db.Session
+	app.DB.Order("\"last_seen_at\" DESC").Find(&Sessions, "\"user_id\" = ? AND \"revoked\" = ? AND \"expires_at\" > ?", User.ID, false, time.Now())
+
+	model := make([]map[string]interface{}, len(Sessions))
+
+	for i, session := range Sessions {
+
+		model[i] = CopyNestedModel(session, fieldsSession).(map[string]interface{})
+
+		// Mark the session this request was made in.
+		model[i]["Current"] = (session.ID == claims["sid"])
+	}
+
+	c.JSON(http.StatusOK, model)
+}
+
+// Signs out one session of the authorized user, e.g. on a lost
+// phone. All JWTs and refresh tokens of it are revoked at once.
+func (app *App) DeleteSession(c *gin.Context) {
+
+	// Check authorization for this function.
+	User := app.AuthorizeShort(c)
+	if User == nil {
+		return
+	}
+
+	sessionID := app.getUUID(c, "sessionID")
+	if sessionID == "" {
+		return
+	}
+
+	var Session db.Session
+	app.DB.First(&Session, "\"id\" = ? AND \"user_id\" = ? AND \"revoked\" = ?", sessionID, User.ID, false)
+
+	if Session.ID == "" {
+
+		c.JSON(http.StatusNotFound, gin.H{
+			"Error": "The session you requested does not exist.",
+		})
+
+		return
+	}
+
+	app.revokeSessions(User.ID, Session.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"ID": Session.ID,
+	})
+}
+
+// Collects all personal data we store about supplied user.
+// Keys are the names of the parts of an export.
+func (app *App) collectPersonalData(User *db.User) map[string]interface{} {
+
+	var Profile db.User
+	app.DB.Preload("Groups").First(&Profile, "\"id\" = ?", User.ID)
+
+	for i := range Profile.Groups {
+		app.DB.Model(&Profile.Groups[i]).Related(&Profile.Groups[i].Region)
+	}
+
+	// Expired ones included, as all of them contain personal data.
+	var Offers []db.Offer
+	app.DB.Preload("Tags").Find(&Offers, "\"user_id\" = ?", User.ID)
+
+	var Requests []db.Request
+	app.DB.Preload("Tags").Find(&Requests, "\"user_id\" = ?", User.ID)
+
+	var Matchings []db.Matching
+	app.DB.Find(&Matchings, "\"offer_id\" IN (SELECT \"id\" FROM \"offers\" WHERE \"user_id\" = ?) OR \"request_id\" IN (SELECT \"id\" FROM \"requests\" WHERE \"user_id\" = ?)", User.ID, User.ID)
+
+	for i := range Matchings {
+
+		app.DB.Preload("Tags").First(&Matchings[i].Offer, "\"id\" = ?", Matchings[i].OfferId)
+		app.DB.Preload("Tags").First(&Matchings[i].Request, "\"id\" = ?", Matchings[i].RequestId)
+		app.DB.Model(&Matchings[i].Offer).Related(&Matchings[i].Offer.User)
+		app.DB.Model(&Matchings[i].Request).Related(&Matchings[i].Request.User)
+		app.loadTrustLevel(&Matchings[i].Offer, Matchings[i].RegionId)
+	}
+
+	var Notifications []db.Notification
+	app.DB.Order("\"created_at\" DESC").Find(&Notifications, "\"user_id\" = ?", User.ID)
+
+	var Sessions []db.Session
+	app.DB.Order("\"last_seen_at\" DESC").Find(&Sessions, "\"user_id\" = ?", User.ID)
+
+	var Memberships []db.OrganisationMember
+	app.DB.Find(&Memberships, "\"user_id\" = ?", User.ID)
+
+	// Revoked and expired ones included, as admins noted them.
+	var Grants []db.TrustGrant
+	app.DB.Order("\"created_at\" DESC").Find(&Grants, "\"user_id\" = ?", User.ID)
+
+	// Feedback the user gave as well as received.
+	var Feedbacks []db.Feedback
+	app.DB.Order("\"created_at\" DESC").Find(&Feedbacks, "\"author_id\" = ? OR \"subject_id\" = ?", User.ID, User.ID)
+
+	return map[string]interface{}{
+		"Profile":       CopyNestedModel(Profile, fieldsUser),
+		"Offers":        CopyNestedModel(Offers, fieldsOffer),
+		"Requests":      CopyNestedModel(Requests, fieldsRequest),
+		"Matchings":     app.protectContacts(User, CopyNestedModel(Matchings, fieldsMatching)),
+		"Notifications": CopyNestedModel(Notifications, fieldsNotificationWithRead),
+		"Sessions":      CopyNestedModel(Sessions, fieldsSession),
+		"Organisations": CopyNestedModel(Memberships, fieldsOrganisationMembership),
+		"Trust":         CopyNestedModel(Grants, fieldsTrustGrant),
+		"Feedback":      CopyNestedModel(Feedbacks, fieldsFeedback),
+	}
+}
+
+// Hands out all personal data of the authorized user, either
+// as one JSON object or, with query parameter format=zip, as
+// ZIP archive containing one JSON file per part.
+func (app *App) ExportMe(c *gin.Context) {
+
+	// Check authorization for this function.
+	User := app.AuthorizeShort(c)
+	if User == nil {
+		return
+	}
+
+	format := c.Query("format")
+	if format != "" && format != "json" && format != "zip" {
+
+		c.JSON(http.StatusBadRequest, gin.H{
+			"format": "Needs to be either json or zip",
+		})
+
+		return
+	}
+
+	exportedAt := time.Now()
+
+	export := app.collectPersonalData(User)
+	export["ExportedAt"] = exportedAt
+
+	filename := fmt.Sprintf("catustrophy-export-%s", exportedAt.Format("2006-01-02"))
+
+	if format != "zip" {
+
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.json\"", filename))
+		c.JSON(http.StatusOK, export)
+
+		return
+	}
+
+	buffer := new(bytes.Buffer)
+	archive := zip.NewWriter(buffer)
+
+	for _, part := range []string{"ExportedAt", "Profile", "Offers", "Requests", "Matchings", "Notifications", "Sessions", "Organisations", "Trust", "Feedback"} {
+
+		content, err := json.MarshalIndent(export[part], "", "    ")
+		if err == nil {
+
+			var file io.Writer
+			file, err = archive.Create(fmt.Sprintf("%s.json", part))
+			if err == nil {
+				_, err = file.Write(content)
+			}
+		}
+
+		if err != nil {
+
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"Error": "Could not create export, please try again later.",
+			})
+
+			return
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"Error": "Could not create export, please try again later.",
+		})
+
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.zip\"", filename))
+	c.Data(http.StatusOK, "application/zip", buffer.Bytes())
+}
+
+// Deletes the account of the authorized user. Personal data
+// is removed or anonymised, while offers, requests and matchings
+// are kept without it, so that region statistics stay correct
+// and the other party of a matching still sees what was agreed.
+func (app *App) DeleteMe(c *gin.Context) {
+
+	// Check authorization for this function.
+	User := app.AuthorizeShort(c)
+	if User == nil {
+		return
+	}
+
+	var Payload DeleteMePayload
+
+	// Expect password and, if enabled, second factor in JSON request body.
+	if ok := app.ValidatePayloadShort(c, &Payload); !ok {
+		return
+	}
+
+	if ok, _ := app.Passwords.Verify(User.PasswordHash, Payload.Password); !ok {
+
+		c.JSON(http.StatusBadRequest, gin.H{
+			"Password": "Is wrong",
+		})
+
+		return
+	}
+
+	if User.TOTPEnabled {
+
+		if ok := app.checkSecondFactor(User, Payload.Code); !ok {
+
+			c.JSON(http.StatusBadRequest, gin.H{
+				"Code": "Is invalid",
+			})
+
+			return
+		}
+	}
+
+	// Otherwise the system might be left without any admin.
+	if app.HasPermission(User, db.Region{}, db.PermissionUserSuspend) {
+
+		c.JSON(http.StatusForbidden, gin.H{
+			"Error": "System admins can not delete their account. Ask another system admin to demote you first.",
+		})
+
+		return
+	}
+
+	// Likewise, no organisation may be left without an owner.
+	for _, organisationID := range app.organisationIDs(User) {
+
+		if app.organisationRole(User, organisationID) == db.OrganisationRoleOwner && app.isLastOrganisationOwner(organisationID) {
+
+			c.JSON(http.StatusForbidden, gin.H{
+				"Error": "You are the last owner of an organisation. Make another member owner first.",
+			})
+
+			return
+		}
+	}
+
+	tx := app.DB.Begin()
+
+	// Keep the user row, so that matchings still reference
+	// somebody, but strip everything that identifies a person.
+	// Mail address and password hash have to stay unique.
+	tx.Model(User).Updates(map[string]interface{}{
+		"name":                "Deleted user",
+		"preferred_name":      "",
+		"mail":                fmt.Sprintf("deleted-%s@invalid", User.ID),
+		"mail_verified":       false,
+		"phone_numbers":       db.PhoneNumbers{},
+		"password_hash":       fmt.Sprintf("!deleted-%s", User.ID),
+		"enabled":             false,
+		"suspension_reason":   "",
+		"sessions_revoked_at": time.Now(),
+		"totp_secret":         "",
+		"totp_enabled":        false,
+		"totp_last_counter":   0,
+		"deleted":             true,
+	})
+	tx.Model(User).Association("Groups").Clear()
+
+	// Offers and requests keep name, tags and regions. Their
+	// location is rounded to about one kilometre. Those made on
+	// behalf of an organisation belong to it and stay untouched,
+	// but move to another owner of the organisation. Otherwise
+	// they would vanish like those of a suspended user.
+	for _, table := range []string{"offers", "requests"} {
+		tx.Exec(fmt.Sprintf("UPDATE \"%s\" SET \"description\" = '', \"location\" = ST_SetSRID(ST_MakePoint(round(ST_X(\"location\")::numeric, 2)::float8, round(ST_Y(\"location\")::numeric, 2)::float8), 4326) WHERE \"user_id\" = ? AND (\"organisation_id\" = '' OR \"organisation_id\" IS NULL)", table), User.ID)
+		tx.Exec(fmt.Sprintf("UPDATE \"%s\" SET \"user_id\" = COALESCE((SELECT \"organisation_members\".\"user_id\" FROM \"organisation_members\" WHERE \"organisation_members\".\"organisation_id\" = \"%s\".\"organisation_id\" AND \"organisation_members\".\"role\" = ? AND \"organisation_members\".\"user_id\" <> ? ORDER BY \"organisation_members\".\"user_id\" LIMIT 1), \"user_id\") WHERE \"user_id\" = ? AND \"organisation_id\" <> ''", table, table), db.OrganisationRoleOwner, User.ID, User.ID)
+	}
+
+	tx.Where("\"user_id\" = ? AND (\"organisation_id\" = '' OR \"organisation_id\" IS NULL)", User.ID).Delete(&db.Notification{})
+	tx.Where("\"user_id\" = ?", User.ID).Delete(&db.OrganisationMember{})
+	tx.Where("\"user_id\" = ?", User.ID).Delete(&db.TrustGrant{})
+
+	// Ratings the user gave keep counting for the rated user,
+	// only the comments go. Feedback about the user goes.
+	tx.Model(&db.Feedback{}).Where("\"author_id\" = ?", User.ID).Update("comment", "")
+	tx.Where("\"subject_id\" = ?", User.ID).Delete(&db.Feedback{})
+	tx.Where("\"user_id\" = ?", User.ID).Delete(&db.Session{})
+	tx.Where("\"user_id\" = ?", User.ID).Delete(&db.RefreshToken{})
+	tx.Where("\"user_id\" = ?", User.ID).Delete(&db.OneTimeToken{})
+	tx.Where("\"user_id\" = ?", User.ID).Delete(&db.RecoveryCode{})
+	tx.Where("\"user_id\" = ?", User.ID).Delete(&db.APIKey{})
+
+	// Offers and requests of this user disappear from recommendations.
+	app.outdateRecommendationsOfUser(tx, User.ID)
+
+	// The audit trail records that, but not what, was deleted.
+	app.audit(tx, c, User, db.AuditUserDelete, "user", User.ID, "", nil, nil)
+
+	if err := tx.Commit().Error; err != nil {
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"Error": "Could not delete account, please try again later.",
+		})
+
+		return
+	}
+
+	app.Principals.Invalidate(User.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"ID": User.ID,
+	})
+}
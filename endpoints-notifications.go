@@ -33,8 +33,14 @@ func (app *App) ListNotifications(c *gin.Context) {
 		return
 	}
 
+	// Members also receive notifications of their organisations.
+	query := app.DB.Where("\"user_id\" = ?", User.ID)
+	if organisationIDs := app.organisationIDs(User); len(organisationIDs) > 0 {
+		query = app.DB.Where("\"user_id\" = ? OR \"organisation_id\" IN (?)", User.ID, organisationIDs)
+	}
+
 	var Notifications []db.Notification
-	app.DB.Find(&Notifications, "\"user_id\" = ? AND \"read\" = ?", User.ID, "false")
+	query.Find(&Notifications, "\"read\" = ?", "false")
 
 	// Instantiate final response slice.
 	response := make([]interface{}, len(Notifications))
@@ -59,6 +65,7 @@ func (app *App) ListNotifications(c *gin.Context) {
 			app.DB.Model(&Matching.Offer).Related(&Matching.Offer.User)
 			app.DB.Model(&Matching).Related(&Matching.Request)
 			app.DB.Model(&Matching.Request).Related(&Matching.Request.User)
+			app.loadTrustLevel(&Matching.Offer, Matching.RegionId)
 
 			// Marshal compiled matching model.
 			jsonMatchingTmp := CopyNestedModel(Matching, fieldsMatching)
@@ -75,6 +82,9 @@ func (app *App) ListNotifications(c *gin.Context) {
 		response[i] = jsonNotification
 	}
 
+	// Matchings might have been invalidated since.
+	app.protectContacts(User, response)
+
 	c.JSON(http.StatusOK, response)
 }
 
@@ -140,9 +150,10 @@ func (app *App) UpdateNotification(c *gin.Context) {
 	var Notification db.Notification
 	app.DB.First(&Notification, "\"id\" = ?", notificationID)
 
-	// Check if user is actually owner of notification.
-	// This conforms to the scope 'C' level of this handler.
-	if Notification.UserID != User.ID {
+	// Check if user is actually owner of notification, possibly
+	// as member of its organisation. This conforms to the scope
+	// 'C' level of this handler.
+	if Notification.UserID != User.ID && app.organisationRole(User, Notification.OrganisationID) == "" {
 
 		// Signal client an error and expect authorization.
 		c.Header("WWW-Authenticate", "Bearer realm=\"CaTUstrophy\", error=\"invalid_token\", error_description=\"JWT was invalid\"")
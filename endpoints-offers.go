@@ -27,6 +27,7 @@ type CreateOfferPayload struct {
 	Tags           []string `conform:"trim" validate:"dive,excludesall=!@#$%^&*()_+-=:;?/0x2C0x7C"`
 	Description    string   `conform:"trim"`
 	ValidityPeriod string   `conform:"trim" validate:"required"`
+	Organisation   string   `conform:"trim"`
 }
 
 type UpdateOfferPayload struct {
@@ -57,6 +58,11 @@ func (app *App) CreateOffer(c *gin.Context) {
 		return
 	}
 
+	// Users may have to verify their mail address first.
+	if ok := app.CheckMailVerified(User, c); !ok {
+		return
+	}
+
 	var Payload CreateOfferPayload
 
 	// Expect offer struct fields for creation in JSON request body.
@@ -104,6 +110,16 @@ func (app *App) CreateOffer(c *gin.Context) {
 		return
 	}
 
+	// Offers on behalf of an organisation require membership in it.
+	if Payload.Organisation != "" && app.organisationRole(User, Payload.Organisation) == "" {
+
+		c.JSON(http.StatusBadRequest, gin.H{
+			"Organisation": "You are no member of this organisation",
+		})
+
+		return
+	}
+
 	var Offer db.Offer
 
 	// Set insert struct to values from payload.
@@ -111,6 +127,7 @@ func (app *App) CreateOffer(c *gin.Context) {
 	Offer.Name = Payload.Name
 	Offer.User = *User
 	Offer.UserID = User.ID
+	Offer.OrganisationID = Payload.Organisation
 	Offer.Location = gormGIS.GeoPoint{Lng: Payload.Location.Longitude, Lat: Payload.Location.Latitude}
 	Offer.Radius = Payload.Radius
 	Offer.Description = Payload.Description
@@ -193,7 +210,8 @@ func (app *App) CreateOffer(c *gin.Context) {
 	// Calculate the matching score of this offer with all possible requests.
 	go app.CalcMatchScoreForOffer(Offer)
 
-	model := CopyNestedModel(Offer, fieldsOfferWithUser)
+	app.loadTrustLevel(&Offer)
+	model := app.protectContacts(User, CopyNestedModel(Offer, fieldsOfferWithUser))
 
 	c.JSON(http.StatusCreated, model)
 }
@@ -229,8 +247,8 @@ func (app *App) GetOffer(c *gin.Context) {
 
 	// Validity check:
 	// User accessing this offer has to be either an admin in any region
-	// of this offer or has to be the owning user of this offer.
-	if ok := ((offer.UserID == User.ID) || app.CheckScopes(User, offer.Regions, "admin")); !ok {
+	// of this offer or has to own this offer, possibly through an organisation.
+	if ok := (app.ownsItem(User, offer.UserID, offer.OrganisationID) || app.CheckScopes(User, offer.Regions, db.PermissionItemRead)); !ok {
 
 		// Signal client that the provided authorization was not sufficient.
 		c.Header("WWW-Authenticate", "Bearer realm=\"CaTUstrophy\", error=\"authentication_failed\", error_description=\"Could not authenticate the request\"")
@@ -240,7 +258,8 @@ func (app *App) GetOffer(c *gin.Context) {
 	}
 
 	// He or she can have it, if he or she wants it so badly!
-	model := CopyNestedModel(offer, fieldsOfferWithUser)
+	app.loadTrustLevel(&offer)
+	model := app.protectContacts(User, CopyNestedModel(offer, fieldsOfferWithUser))
 
 	c.JSON(http.StatusOK, model)
 }
@@ -276,8 +295,8 @@ func (app *App) UpdateOffer(c *gin.Context) {
 
 	// Validity check:
 	// User accessing this offer has to be either an admin in any region
-	// of this offer or has to be the owning user of this offer.
-	if ok := ((Offer.UserID == User.ID) || app.CheckScopes(User, Offer.Regions, "admin")); !ok {
+	// of this offer or has to own this offer, possibly through an organisation.
+	if ok := (app.ownsItem(User, Offer.UserID, Offer.OrganisationID) || app.CheckScopes(User, Offer.Regions, db.PermissionItemUpdate)); !ok {
 
 		// Signal client that the provided authorization was not sufficient.
 		c.Header("WWW-Authenticate", "Bearer realm=\"CaTUstrophy\", error=\"authentication_failed\", error_description=\"Could not authenticate the request\"")
@@ -386,7 +405,8 @@ func (app *App) UpdateOffer(c *gin.Context) {
 	// Calculate the matching score of this offer with all possible requests.
 	go app.CalcMatchScoreForOffer(Offer)
 
-	model := CopyNestedModel(Offer, fieldsRequestWithUser)
+	app.loadTrustLevel(&Offer)
+	model := app.protectContacts(User, CopyNestedModel(Offer, fieldsOfferWithUser))
 
 	c.JSON(http.StatusOK, model)
 }
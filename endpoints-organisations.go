@@ -0,0 +1,611 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"net/http"
+
+	"github.com/caTUstrophy/backend/db"
+	"github.com/gin-gonic/gin"
+	"github.com/satori/go.uuid"
+)
+
+// Structs
+
+type OrganisationPayload struct {
+	Name        string `conform:"trim" validate:"required"`
+	Description string `conform:"trim"`
+}
+
+type OrganisationMemberPayload struct {
+	Mail string `conform:"trim,email" validate:"required,email"`
+	Role string `conform:"trim,lower" validate:"required"`
+}
+
+type GrantOrganisationRolePayload struct {
+	Organisation string `conform:"trim" validate:"required,uuid4"`
+	Role         string `conform:"trim,lower" validate:"required"`
+}
+
+// Functions
+
+// Returns the role of supplied user in supplied organisation
+// or an empty string if the user is no member of it.
+func (app *App) organisationRole(user *db.User, organisationID string) string {
+
+	if organisationID == "" {
+		return ""
+	}
+
+	principal := app.getPrincipal(user.ID)
+	if principal == nil {
+		return ""
+	}
+
+	return principal.Organisations[organisationID]
+}
+
+// Returns the IDs of all organisations supplied user is member of.
+func (app *App) organisationIDs(user *db.User) []string {
+
+	organisationIDs := make([]string, 0)
+
+	principal := app.getPrincipal(user.ID)
+	if principal == nil {
+		return organisationIDs
+	}
+
+	for organisationID := range principal.Organisations {
+		organisationIDs = append(organisationIDs, organisationID)
+	}
+
+	return organisationIDs
+}
+
+// Checks if supplied user may act as owner of an offer or a
+// request, either as the user who made it or as member of the
+// organisation it was made on behalf of.
+func (app *App) ownsItem(user *db.User, ownerID string, organisationID string) bool {
+	return (ownerID == user.ID) || (app.organisationRole(user, organisationID) != "")
+}
+
+// Loads the organisation referenced in request URL.
+// On fail writes an error response.
+func (app *App) getOrganisation(c *gin.Context) *db.Organisation {
+
+	organisationID := app.getUUID(c, "organisationID")
+	if organisationID == "" {
+		return nil
+	}
+
+	var Organisation db.Organisation
+	app.DB.First(&Organisation, "\"id\" = ?", organisationID)
+
+	if Organisation.ID == "" {
+
+		c.JSON(http.StatusNotFound, gin.H{
+			"Error": "The organisation you requested does not exist.",
+		})
+
+		return nil
+	}
+
+	return &Organisation
+}
+
+// Checks that supplied user is member of supplied organisation,
+// with onlyOwners an owner of it, or may manage all organisations.
+// On fail writes an unauthorized response.
+func (app *App) checkOrganisationAccess(c *gin.Context, user *db.User, organisation *db.Organisation, onlyOwners bool) bool {
+
+	role := app.organisationRole(user, organisation.ID)
+
+	if (role == db.OrganisationRoleOwner) || (role != "" && !onlyOwners) || app.CheckScope(user, db.Region{}, db.PermissionOrganisationManage) {
+		return true
+	}
+
+	// Signal client that the provided authorization was not sufficient.
+	c.Header("WWW-Authenticate", "Bearer realm=\"CaTUstrophy\", error=\"authentication_failed\", error_description=\"Could not authenticate the request\"")
+	c.Status(http.StatusUnauthorized)
+
+	return false
+}
+
+// Creates an organisation with the authorized user as its owner.
+func (app *App) CreateOrganisation(c *gin.Context) {
+
+	// Check authorization for this function.
+	User := app.AuthorizeShort(c)
+	if User == nil {
+		return
+	}
+
+	// Users may have to verify their mail address first.
+	if ok := app.CheckMailVerified(User, c); !ok {
+		return
+	}
+
+	var Payload OrganisationPayload
+
+	// Expect organisation fields in JSON request body.
+	if ok := app.ValidatePayloadShort(c, &Payload); !ok {
+		return
+	}
+
+	// Check for duplicate organisation name.
+	var CountDup int
+	app.DB.Model(&db.Organisation{}).Where("\"name\" = ?", Payload.Name).Count(&CountDup)
+
+	if CountDup > 0 {
+
+		c.JSON(http.StatusBadRequest, gin.H{
+			"Name": "Already exists",
+		})
+
+		return
+	}
+
+	Organisation := db.Organisation{
+		ID:          fmt.Sprintf("%s", uuid.NewV4()),
+		Name:        Payload.Name,
+		Description: Payload.Description,
+	}
+
+	Owner := db.OrganisationMember{
+		OrganisationID: Organisation.ID,
+		UserID:         User.ID,
+		Role:           db.OrganisationRoleOwner,
+	}
+
+	model := CopyNestedModel(Organisation, fieldsOrganisation)
+
+	tx := app.DB.Begin()
+	tx.Create(&Organisation)
+	tx.Create(&Owner)
+	app.audit(tx, c, User, db.AuditOrganisationCreate, "organisation", Organisation.ID, "", nil, model)
+	tx.Commit()
+
+	app.Principals.Invalidate(User.ID)
+
+	c.JSON(http.StatusCreated, model)
+}
+
+func (app *App) GetOrganisation(c *gin.Context) {
+
+	// Check authorization for this function.
+	User := app.AuthorizeShort(c)
+	if User == nil {
+		return
+	}
+
+	// Name and description of organisations are public to all users.
+	Organisation := app.getOrganisation(c)
+	if Organisation == nil {
+		return
+	}
+
+	model := CopyNestedModel(*Organisation, fieldsOrganisation)
+
+	c.JSON(http.StatusOK, model)
+}
+
+func (app *App) UpdateOrganisation(c *gin.Context) {
+
+	// Check authorization for this function.
+	User := app.AuthorizeShort(c)
+	if User == nil {
+		return
+	}
+
+	Organisation := app.getOrganisation(c)
+	if Organisation == nil {
+		return
+	}
+
+	if ok := app.checkOrganisationAccess(c, User, Organisation, true); !ok {
+		return
+	}
+
+	var Payload OrganisationPayload
+
+	// Expect organisation fields in JSON request body.
+	if ok := app.ValidatePayloadShort(c, &Payload); !ok {
+		return
+	}
+
+	// Check for duplicate organisation name.
+	var CountDup int
+	app.DB.Model(&db.Organisation{}).Where("\"name\" = ? AND \"id\" <> ?", Payload.Name, Organisation.ID).Count(&CountDup)
+
+	if CountDup > 0 {
+
+		c.JSON(http.StatusBadRequest, gin.H{
+			"Name": "Already exists",
+		})
+
+		return
+	}
+
+	before := CopyNestedModel(*Organisation, fieldsOrganisation)
+
+	app.DB.Model(Organisation).Updates(map[string]interface{}{
+		"name":        Payload.Name,
+		"description": Payload.Description,
+	})
+
+	model := CopyNestedModel(*Organisation, fieldsOrganisation)
+
+	app.audit(app.DB, c, User, db.AuditOrganisationUpdate, "organisation", Organisation.ID, "", before, model)
+
+	c.JSON(http.StatusOK, model)
+}
+
+// Lists all organisations the authorized user is member of
+// together with the user's role in each of them.
+func (app *App) ListUserOrganisations(c *gin.Context) {
+
+	// Check authorization for this function.
+	User := app.AuthorizeShort(c)
+	if User == nil {
+		return
+	}
+
+	var Memberships []db.OrganisationMember
+	app.DB.Find(&Memberships, "\"user_id\" = ?", User.ID)
+
+	model := make([]map[string]interface{}, len(Memberships))
+
+	for i, Membership := range Memberships {
+
+		var Organisation db.Organisation
+		app.DB.First(&Organisation, "\"id\" = ?", Membership.OrganisationID)
+
+		model[i] = CopyNestedModel(Organisation, fieldsOrganisation).(map[string]interface{})
+		model[i]["Role"] = Membership.Role
+	}
+
+	c.JSON(http.StatusOK, model)
+}
+
+func (app *App) ListOrganisationMembers(c *gin.Context) {
+
+	// Check authorization for this function.
+	User := app.AuthorizeShort(c)
+	if User == nil {
+		return
+	}
+
+	Organisation := app.getOrganisation(c)
+	if Organisation == nil {
+		return
+	}
+
+	if ok := app.checkOrganisationAccess(c, User, Organisation, false); !ok {
+		return
+	}
+
+	var Members []db.OrganisationMember
+	app.DB.Preload("User").Find(&Members, "\"organisation_id\" = ?", Organisation.ID)
+
+	model := app.protectContacts(User, CopyNestedModel(Members, fieldsOrganisationMember))
+
+	c.JSON(http.StatusOK, model)
+}
+
+// Adds the user with supplied mail address to an organisation
+// or changes the role of a member. An organisation always keeps
+// at least one owner.
+func (app *App) SetOrganisationMember(c *gin.Context) {
+
+	// Check authorization for this function.
+	User := app.AuthorizeShort(c)
+	if User == nil {
+		return
+	}
+
+	Organisation := app.getOrganisation(c)
+	if Organisation == nil {
+		return
+	}
+
+	if ok := app.checkOrganisationAccess(c, User, Organisation, true); !ok {
+		return
+	}
+
+	var Payload OrganisationMemberPayload
+
+	// Expect mail of user and role in JSON request body.
+	if ok := app.ValidatePayloadShort(c, &Payload); !ok {
+		return
+	}
+
+	if Payload.Role != db.OrganisationRoleOwner && Payload.Role != db.OrganisationRoleMember {
+
+		c.JSON(http.StatusBadRequest, gin.H{
+			"Role": "Has to be owner or member",
+		})
+
+		return
+	}
+
+	var memberUser db.User
+	app.DB.First(&memberUser, "\"mail\" = ? AND \"deleted\" = ?", Payload.Mail, false)
+
+	if memberUser.ID == "" {
+
+		c.JSON(http.StatusNotFound, gin.H{
+			"Error": "Email unkown to system.",
+		})
+
+		return
+	}
+
+	var Member db.OrganisationMember
+	app.DB.First(&Member, "\"organisation_id\" = ? AND \"user_id\" = ?", Organisation.ID, memberUser.ID)
+
+	before := gin.H{"Role": Member.Role}
+
+	if Member.Role == db.OrganisationRoleOwner && Payload.Role != db.OrganisationRoleOwner && app.isLastOrganisationOwner(Organisation.ID) {
+
+		c.JSON(http.StatusBadRequest, gin.H{
+			"Role": "An organisation needs at least one owner",
+		})
+
+		return
+	}
+
+	if Member.UserID == "" {
+
+		// New members gain all roles of the organisation.
+		if ok := app.mayGrantOrganisationRoles(c, User, Organisation); !ok {
+			return
+		}
+
+		Member = db.OrganisationMember{
+			OrganisationID: Organisation.ID,
+			UserID:         memberUser.ID,
+			Role:           Payload.Role,
+		}
+		app.DB.Create(&Member)
+	} else {
+		app.DB.Model(&db.OrganisationMember{}).Where("\"organisation_id\" = ? AND \"user_id\" = ?", Organisation.ID, memberUser.ID).Update("role", Payload.Role)
+		Member.Role = Payload.Role
+	}
+	app.Principals.Invalidate(memberUser.ID)
+
+	app.audit(app.DB, c, User, db.AuditOrganisationMemberSet, "organisation", Organisation.ID, "", before, gin.H{"Role": Member.Role, "UserID": memberUser.ID})
+
+	Member.User = memberUser
+
+	model := app.protectContacts(User, CopyNestedModel(Member, fieldsOrganisationMember))
+
+	c.JSON(http.StatusOK, model)
+}
+
+// Removes a member from an organisation. Owners may remove
+// every member, members may leave on their own.
+func (app *App) RemoveOrganisationMember(c *gin.Context) {
+
+	// Check authorization for this function.
+	User := app.AuthorizeShort(c)
+	if User == nil {
+		return
+	}
+
+	Organisation := app.getOrganisation(c)
+	if Organisation == nil {
+		return
+	}
+
+	userID := app.getUUID(c, "userID")
+	if userID == "" {
+		return
+	}
+
+	if userID != User.ID {
+
+		if ok := app.checkOrganisationAccess(c, User, Organisation, true); !ok {
+			return
+		}
+	}
+
+	var Member db.OrganisationMember
+	app.DB.First(&Member, "\"organisation_id\" = ? AND \"user_id\" = ?", Organisation.ID, userID)
+
+	if Member.UserID == "" {
+
+		c.JSON(http.StatusNotFound, gin.H{
+			"Error": "The user you requested is no member of this organisation.",
+		})
+
+		return
+	}
+
+	if Member.Role == db.OrganisationRoleOwner && app.isLastOrganisationOwner(Organisation.ID) {
+
+		c.JSON(http.StatusBadRequest, gin.H{
+			"Error": "An organisation needs at least one owner",
+		})
+
+		return
+	}
+
+	app.DB.Where("\"organisation_id\" = ? AND \"user_id\" = ?", Organisation.ID, userID).Delete(&db.OrganisationMember{})
+	app.Principals.Invalidate(userID)
+
+	app.audit(app.DB, c, User, db.AuditOrganisationMemberRemove, "organisation", Organisation.ID, "", gin.H{"Role": Member.Role, "UserID": userID}, nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"ID": userID,
+	})
+}
+
+// Checks that supplied user may grant every role the organisation
+// holds in a region, as new members gain them. Nobody may grant
+// permissions they don't hold themselves, not even through an
+// organisation. On fail writes a forbidden response.
+func (app *App) mayGrantOrganisationRoles(c *gin.Context, User *db.User, Organisation *db.Organisation) bool {
+
+	var Groups []db.Group
+	app.DB.Model(Organisation).Association("Groups").Find(&Groups)
+
+	for _, Group := range Groups {
+
+		var Region db.Region
+		app.DB.First(&Region, "\"id\" = ?", Group.RegionId)
+
+		if ok := app.CheckScope(User, Region, db.PermissionRegionRoleGrant); !ok {
+
+			c.JSON(http.StatusForbidden, gin.H{
+				"Error": "This organisation holds roles in regions you can not grant roles in. Ask an admin of these regions to add members.",
+			})
+
+			return false
+		}
+
+		var Role db.Role
+		app.DB.Preload("Permissions").First(&Role, "\"id\" = ?", Group.RoleID)
+
+		if ok := app.mayGrantRole(c, User, Region, Role); !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (app *App) isLastOrganisationOwner(organisationID string) bool {
+
+	var CountOwners int
+	app.DB.Model(&db.OrganisationMember{}).Where("\"organisation_id\" = ? AND \"role\" = ?", organisationID, db.OrganisationRoleOwner).Count(&CountOwners)
+
+	return CountOwners <= 1
+}
+
+// Lists all offers made on behalf of an organisation that are
+// not yet expired.
+func (app *App) ListOrganisationOffers(c *gin.Context) {
+
+	// Check authorization for this function.
+	User := app.AuthorizeShort(c)
+	if User == nil {
+		return
+	}
+
+	Organisation := app.getOrganisation(c)
+	if Organisation == nil {
+		return
+	}
+
+	if ok := app.checkOrganisationAccess(c, User, Organisation, false); !ok {
+		return
+	}
+
+	var Offers []db.Offer
+	app.DB.Preload("Tags").Find(&Offers, "\"organisation_id\" = ? AND \"validity_period\" > ?", Organisation.ID, time.Now())
+
+	model := CopyNestedModel(Offers, fieldsOffer)
+
+	c.JSON(http.StatusOK, model)
+}
+
+// Lists all requests made on behalf of an organisation that
+// are not yet expired.
+func (app *App) ListOrganisationRequests(c *gin.Context) {
+
+	// Check authorization for this function.
+	User := app.AuthorizeShort(c)
+	if User == nil {
+		return
+	}
+
+	Organisation := app.getOrganisation(c)
+	if Organisation == nil {
+		return
+	}
+
+	if ok := app.checkOrganisationAccess(c, User, Organisation, false); !ok {
+		return
+	}
+
+	var Requests []db.Request
+	app.DB.Preload("Tags").Find(&Requests, "\"organisation_id\" = ? AND \"validity_period\" > ?", Organisation.ID, time.Now())
+
+	model := CopyNestedModel(Requests, fieldsRequest)
+
+	c.JSON(http.StatusOK, model)
+}
+
+// Grants a role in a region to an organisation. All of its
+// members hold the role as long as they are members.
+func (app *App) GrantRoleToOrganisationInRegion(c *gin.Context) {
+
+	// Check authorization for this function.
+	User := app.AuthorizeShort(c)
+	if User == nil {
+		return
+	}
+
+	regionID := app.getUUID(c, "regionID")
+	if regionID == "" {
+		return
+	}
+
+	var Region db.Region
+	app.DB.First(&Region, "\"id\" = ?", regionID)
+
+	if Region.ID == "" {
+
+		c.JSON(http.StatusNotFound, gin.H{
+			"Error": "The region you requested does not exist.",
+		})
+
+		return
+	}
+
+	// Check if user permissions are sufficient.
+	if ok := app.CheckScope(User, Region, db.PermissionRegionRoleGrant); !ok {
+
+		// Signal client that the provided authorization was not sufficient.
+		c.Header("WWW-Authenticate", "Bearer realm=\"CaTUstrophy\", error=\"authentication_failed\", error_description=\"Could not authenticate the request\"")
+		c.Status(http.StatusUnauthorized)
+
+		return
+	}
+
+	var Payload GrantOrganisationRolePayload
+
+	// Expect organisation ID and name of role in JSON request body.
+	if ok := app.ValidatePayloadShort(c, &Payload); !ok {
+		return
+	}
+
+	var Organisation db.Organisation
+	app.DB.First(&Organisation, "\"id\" = ?", Payload.Organisation)
+
+	if Organisation.ID == "" {
+
+		c.JSON(http.StatusNotFound, gin.H{
+			"Error": "The organisation you requested does not exist.",
+		})
+
+		return
+	}
+
+	Group, ok := app.grantableGroup(c, User, Region, Payload.Role)
+	if !ok {
+		return
+	}
+
+	app.DB.Model(&Organisation).Association("Groups").Append(Group)
+
+	// Any number of members gain permissions.
+	app.Principals.Clear()
+
+	app.audit(app.DB, c, User, db.AuditRoleGrant, "organisation", Organisation.ID, Region.ID, nil, gin.H{"Group": Group.ID, "Role": Group.AccessRight})
+
+	model := CopyNestedModel(Organisation, fieldsOrganisation)
+
+	c.JSON(http.StatusOK, model)
+}
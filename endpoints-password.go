@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"net/http"
+
+	"github.com/caTUstrophy/backend/db"
+	"github.com/gin-gonic/gin"
+)
+
+// Structs
+
+type PasswordResetRequestPayload struct {
+	Mail string `conform:"trim,email" validate:"required,email"`
+}
+
+type PasswordResetPayload struct {
+	Token    string `conform:"trim" validate:"required"`
+	Password string `validate:"required"`
+}
+
+// Functions
+
+// Creates a new password reset token for supplied user
+// and sends a mail containing the reset link to the
+// user's current mail address.
+func (app *App) sendPasswordResetMail(user db.User) {
+
+	token, expiresAt := app.makeOneTimeToken(user, db.OneTimeTokenPasswordReset, app.ResetValidFor)
+
+	link := fmt.Sprintf("%s/password-reset?token=%s", app.FrontendURL, token)
+	body := fmt.Sprintf("Hello %s,\n\nsomeone requested to reset the password of your CaTUstrophy account. To choose a new password, open the following link:\n\n%s\n\nThe link is valid until %s and can only be used once. If you did not request a new password, you can ignore this mail.\n", user.Name, link, expiresAt.Format(time.RFC1123))
+
+	err := app.Mailer.Send(user.Mail, "Reset your password", body)
+	if err != nil {
+		log.Printf("[sendPasswordResetMail] Sending password reset mail to user %s failed: %s\n", user.ID, err)
+	}
+}
+
+func (app *App) RequestPasswordReset(c *gin.Context) {
+
+	var Payload PasswordResetRequestPayload
+
+	// Expect mail address in JSON request body.
+	if ok := app.ValidatePayloadShort(c, &Payload); !ok {
+		return
+	}
+
+	// Find user in database.
+	var User db.User
+	app.DB.First(&User, "mail = ?", Payload.Mail)
+
+	// Only send a mail if the user is known to our system. Service
+	// accounts never get a password, they authenticate with API keys.
+	if User.ID != "" && !User.ServiceAccount {
+		go app.sendPasswordResetMail(User)
+	}
+
+	// Always respond the same way so that this endpoint
+	// can not be used to find out registered mail addresses.
+	c.JSON(http.StatusOK, gin.H{
+		"Mail": Payload.Mail,
+	})
+}
+
+func (app *App) ConfirmPasswordReset(c *gin.Context) {
+
+	var Payload PasswordResetPayload
+
+	// Expect reset token and new password in JSON request body.
+	if ok := app.ValidatePayloadShort(c, &Payload); !ok {
+		return
+	}
+
+	// Check new password before using up the token, so that a
+	// violation does not require to request another reset mail.
+	var OneTimeToken db.OneTimeToken
+	app.DB.First(&OneTimeToken, "\"token_hash\" = ? AND \"type\" = ?", hashOpaqueToken(Payload.Token), db.OneTimeTokenPasswordReset)
+
+	var tokenUser db.User
+	if OneTimeToken.UserID != "" {
+		app.DB.First(&tokenUser, "\"id\" = ?", OneTimeToken.UserID)
+	}
+
+	if ok := app.checkPasswordPolicy(c, Payload.Password, tokenUser.Name, tokenUser.PreferredName, tokenUser.Mail); !ok {
+		return
+	}
+
+	// Check token and mark it as used.
+	User := app.useOneTimeToken(Payload.Token, db.OneTimeTokenPasswordReset)
+	if User == nil || User.ServiceAccount {
+
+		c.JSON(http.StatusBadRequest, gin.H{
+			"Token": "Is invalid or expired",
+		})
+
+		return
+	}
+
+	// Password hash generation.
+	hash, err := app.Passwords.Hash(Payload.Password)
+	if err != nil {
+		// If there was an error during hash creation - terminate immediately.
+		log.Fatal("[ConfirmPasswordReset] Error while generating hash in password reset. Terminating.")
+	}
+
+	// Set new password and revoke all JWTs issued up to now.
+	app.DB.Model(User).Updates(map[string]interface{}{
+		"password_hash":       hash,
+		"sessions_revoked_at": time.Now(),
+	})
+
+	// Same goes for all sessions, refresh tokens and other pending reset tokens of this user.
+	app.DB.Model(&db.Session{}).Where("\"user_id\" = ?", User.ID).Update("revoked", true)
+	app.DB.Model(&db.RefreshToken{}).Where("\"user_id\" = ?", User.ID).Update("revoked", true)
+	app.DB.Model(&db.OneTimeToken{}).Where("\"user_id\" = ? AND \"type\" = ?", User.ID, db.OneTimeTokenPasswordReset).Update("used", true)
+
+	app.Principals.Invalidate(User.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"ID": User.ID,
+	})
+}
@@ -43,10 +43,45 @@ type PromoteUserPayload struct {
 
 // Functions
 
+// Loads the region referenced in request URL and checks that
+// supplied user holds supplied permission in it. On fail
+// writes an error response.
+func (app *App) getRegionWithPermission(c *gin.Context, user *db.User, permission string) *db.Region {
+
+	regionID := app.getUUID(c, "regionID")
+	if regionID == "" {
+		return nil
+	}
+
+	var Region db.Region
+	app.DB.First(&Region, "\"id\" = ?", regionID)
+
+	if Region.ID == "" {
+
+		c.JSON(http.StatusNotFound, gin.H{
+			"Error": "The region you requested does not exist.",
+		})
+
+		return nil
+	}
+
+	// Check if user permissions are sufficient (user is admin).
+	if ok := app.CheckScope(user, Region, permission); !ok {
+
+		// Signal client that the provided authorization was not sufficient.
+		c.Header("WWW-Authenticate", "Bearer realm=\"CaTUstrophy\", error=\"authentication_failed\", error_description=\"Could not authenticate the request\"")
+		c.Status(http.StatusUnauthorized)
+
+		return nil
+	}
+
+	return &Region
+}
+
 func (app *App) CreateRegion(c *gin.Context) {
 
 	// Check authorization for this function.
-	ok, _, message := app.Authorize(c.Request)
+	ok, User, message := app.Authorize(c.Request)
 	if !ok {
 
 		// Signal client an error and expect authorization.
@@ -124,9 +159,13 @@ func (app *App) CreateRegion(c *gin.Context) {
 	app.DB.Create(&Region)
 
 	// Create admin group for this region.
+	var AdminRole db.Role
+	app.DB.First(&AdminRole, "\"name\" = ?", db.RoleAdmin)
+
 	var admins db.Group
 	admins.RegionId = Region.ID
-	admins.AccessRight = "admin"
+	admins.RoleID = AdminRole.ID
+	admins.AccessRight = AdminRole.Name
 	admins.Description = ("Group for admins of the region " + Region.Name)
 	admins.DefaultGroup = false
 	admins.ID = fmt.Sprintf("%s", uuid.NewV4())
@@ -134,6 +173,8 @@ func (app *App) CreateRegion(c *gin.Context) {
 
 	model := CopyNestedModel(Region, fieldsRegion)
 
+	app.audit(app.DB, c, User, db.AuditRegionCreate, "region", Region.ID, Region.ID, nil, model)
+
 	c.JSON(http.StatusCreated, model)
 }
 
@@ -214,7 +255,7 @@ func (app *App) UpdateRegion(c *gin.Context) {
 	app.DB.First(&Region, "id = ?", regionID)
 
 	// Check if user permissions are sufficient (user is admin).
-	if ok := app.CheckScope(User, Region, "admin"); !ok {
+	if ok := app.CheckScope(User, Region, db.PermissionRegionUpdate); !ok {
 
 		// Signal client that the provided authorization was not sufficient.
 		c.Header("WWW-Authenticate", "Bearer realm=\"CaTUstrophy\", error=\"authentication_failed\", error_description=\"Could not authenticate the request\"")
@@ -223,6 +264,8 @@ func (app *App) UpdateRegion(c *gin.Context) {
 		return
 	}
 
+	before := CopyNestedModel(Region, fieldsRegion)
+
 	Region.Name = Payload.Name
 	Region.Description = Payload.Description
 
@@ -243,6 +286,8 @@ func (app *App) UpdateRegion(c *gin.Context) {
 	// Only marshal needed fields.
 	model := CopyNestedModel(Region, fieldsRegion)
 
+	app.audit(app.DB, c, User, db.AuditRegionUpdate, "region", Region.ID, Region.ID, before, model)
+
 	c.JSON(http.StatusOK, model)
 }
 
@@ -271,12 +316,13 @@ func (app *App) ListOffersForRegion(c *gin.Context) {
 
 	// Load all offers for specified region that are
 	// - not yet expired
-	// - and not yet matched.
+	// - not yet matched
+	// - and not created by suspended users.
 	var Region db.Region
-	app.DB.Preload("Offers.Tags").Preload("Offers", "\"offers\".\"expired\" = ? AND \"offers\".\"matched\" = ?", false, false).First(&Region, "\"id\" = ?", regionID)
+	app.DB.Preload("Offers.Tags").Preload("Offers", ("\"offers\".\"expired\" = ? AND \"offers\".\"matched\" = ? AND "+enabledUsersOnly("offers")), false, false).First(&Region, "\"id\" = ?", regionID)
 
 	// Check if user permissions are sufficient (user is admin).
-	if ok := app.CheckScope(User, Region, "admin"); !ok {
+	if ok := app.CheckScope(User, Region, db.PermissionItemRead); !ok {
 
 		// Signal client that the provided authorization was not sufficient.
 		c.Header("WWW-Authenticate", "Bearer realm=\"CaTUstrophy\", error=\"authentication_failed\", error_description=\"Could not authenticate the request\"")
@@ -285,9 +331,12 @@ func (app *App) ListOffersForRegion(c *gin.Context) {
 		return
 	}
 
+	trust := app.loadRegionTrust(Region.ID)
+
 	model := make([]map[string]interface{}, len(Region.Offers))
 	for i, offer := range Region.Offers {
 		model[i] = CopyNestedModel(offer, fieldsOffer).(map[string]interface{})
+		model[i]["TrustLevel"] = trust.level(offer.UserID)
 	}
 
 	// Send back results to client.
@@ -319,12 +368,13 @@ func (app *App) ListRequestsForRegion(c *gin.Context) {
 
 	// Load all requests for specified region that are
 	// - not yet expired
-	// - and not yet matched.
+	// - not yet matched
+	// - and not created by suspended users.
 	var Region db.Region
-	app.DB.Preload("Requests.Tags").Preload("Requests", "\"requests\".\"expired\" = ? AND \"requests\".\"matched\" = ?", false, false).First(&Region, "\"id\" = ?", regionID)
+	app.DB.Preload("Requests.Tags").Preload("Requests", ("\"requests\".\"expired\" = ? AND \"requests\".\"matched\" = ? AND "+enabledUsersOnly("requests")), false, false).First(&Region, "\"id\" = ?", regionID)
 
 	// Check if user permissions are sufficient (user is admin).
-	if ok := app.CheckScope(User, Region, "admin"); !ok {
+	if ok := app.CheckScope(User, Region, db.PermissionItemRead); !ok {
 
 		// Signal client that the provided authorization was not sufficient.
 		c.Header("WWW-Authenticate", "Bearer realm=\"CaTUstrophy\", error=\"authentication_failed\", error_description=\"Could not authenticate the request\"")
@@ -370,7 +420,7 @@ func (app *App) ListMatchingsForRegion(c *gin.Context) {
 	app.DB.First(&Region, "id = ?", regionID)
 
 	// Check if user permissions are sufficient (user is admin).
-	if ok := app.CheckScope(User, Region, "admin"); !ok {
+	if ok := app.CheckScope(User, Region, db.PermissionMatchingRead); !ok {
 
 		// Signal client that the provided authorization was not sufficient.
 		c.Header("WWW-Authenticate", "Bearer realm=\"CaTUstrophy\", error=\"authentication_failed\", error_description=\"Could not authenticate the request\"")
@@ -391,11 +441,15 @@ func (app *App) ListMatchingsForRegion(c *gin.Context) {
 		app.DB.Model(&matching).Related(&matching.Offer).Related(&matching.Request)
 		app.DB.Model(&matching.Offer).Related(&matching.Offer.User)
 		app.DB.Model(&matching.Request).Related(&matching.Request.User)
+		app.loadTrustLevel(&matching.Offer, matching.RegionId)
 
 		// Marshal it to outside representation and add it to response list.
 		model[i] = CopyNestedModel(matching, fieldsMatching).(map[string]interface{})
 	}
 
+	// Admins see contact details only after revealing them.
+	app.protectContacts(User, model)
+
 	c.JSON(http.StatusOK, model)
 }
 
@@ -429,7 +483,7 @@ func (app *App) ListAdminsForRegion(c *gin.Context) {
 	app.DB.First(&Region, "id = ?", regionID)
 
 	// Check if user permissions are sufficient (user is admin).
-	if ok := app.CheckScope(User, Region, "admin"); !ok {
+	if ok := app.CheckScope(User, Region, db.PermissionRegionAdminRead); !ok {
 
 		// Signal client that the provided authorization was not sufficient.
 		c.Header("WWW-Authenticate", "Bearer realm=\"CaTUstrophy\", error=\"authentication_failed\", error_description=\"Could not authenticate the request\"")
@@ -440,7 +494,7 @@ func (app *App) ListAdminsForRegion(c *gin.Context) {
 
 	// Find users that are admins for this region.
 	var group db.Group
-	app.DB.Preload("Users").First(&group, "region_id = ? AND access_right = ?", regionID, "admin")
+	app.DB.Preload("Users").First(&group, "region_id = ? AND access_right = ?", regionID, db.RoleAdmin)
 	app.DB.Model(&group).Related(&group.Region)
 
 	model := CopyNestedModel(group.Users, fieldsUserNoGroups)
@@ -448,6 +502,71 @@ func (app *App) ListAdminsForRegion(c *gin.Context) {
 	c.JSON(http.StatusOK, model)
 }
 
+// Lists users that are member of a group of this region or
+// have offers or requests in it, page by page. Supports the
+// same query parameters as ListUsers except region. Only
+// groups of this region are included for each user.
+func (app *App) ListUsersInRegion(c *gin.Context) {
+
+	// Check authorization for this function.
+	User := app.AuthorizeShort(c)
+	if User == nil {
+		return
+	}
+
+	regionID := app.getUUID(c, "regionID")
+	if regionID == "" {
+		return
+	}
+
+	var Region db.Region
+	app.DB.First(&Region, "\"id\" = ?", regionID)
+
+	if Region.ID == "" {
+
+		c.JSON(http.StatusNotFound, gin.H{
+			"Error": "The region you requested does not exist.",
+		})
+
+		return
+	}
+
+	// Check if user permissions are sufficient (user is admin).
+	if ok := app.CheckScope(User, Region, db.PermissionRegionUserRead); !ok {
+
+		// Signal client that the provided authorization was not sufficient.
+		c.Header("WWW-Authenticate", "Bearer realm=\"CaTUstrophy\", error=\"authentication_failed\", error_description=\"Could not authenticate the request\"")
+		c.Status(http.StatusUnauthorized)
+
+		return
+	}
+
+	Users, ok := app.findUsers(c, app.DB.Model(&db.User{}).Where(usersActiveInRegion, Region.ID, Region.ID, Region.ID))
+	if !ok {
+		return
+	}
+
+	// Memberships in other regions are none of this region's business.
+	for i := range Users {
+
+		Groups := make([]db.Group, 0)
+
+		for _, Group := range Users[i].Groups {
+
+			if Group.RegionId == Region.ID {
+				Groups = append(Groups, Group)
+			}
+		}
+
+		Users[i].Groups = Groups
+	}
+
+	// Admins see contact details only after revealing them.
+	model := app.protectContacts(User, CopyNestedModel(Users, fieldsUser))
+
+	c.JSON(http.StatusOK, model)
+}
+
 func (app *App) PromoteToRegionAdmin(c *gin.Context) {
 
 	// Check authorization for this function.
@@ -487,7 +606,7 @@ func (app *App) PromoteToRegionAdmin(c *gin.Context) {
 	}
 
 	// Check if user permissions are sufficient (user is admin).
-	if ok := app.CheckScope(User, Region, "admin"); !ok {
+	if ok := app.CheckScope(User, Region, db.PermissionRegionAdminManage); !ok {
 
 		// Signal client that the provided authorization was not sufficient.
 		c.Header("WWW-Authenticate", "Bearer realm=\"CaTUstrophy\", error=\"authentication_failed\", error_description=\"Could not authenticate the request\"")
@@ -536,7 +655,7 @@ func (app *App) PromoteToRegionAdmin(c *gin.Context) {
 
 	// Everything seems fine, promote that user.
 	var group db.Group
-	app.DB.First(&group, "region_id = ? AND access_right = ?", regionID, "admin")
+	app.DB.First(&group, "region_id = ? AND access_right = ?", regionID, db.RoleAdmin)
 	if group.ID == "" {
 
 		c.JSON(http.StatusNotFound, gin.H{
@@ -562,10 +681,85 @@ func (app *App) PromoteToRegionAdmin(c *gin.Context) {
 	promotedUser.Groups = append(promotedUser.Groups, group)
 	// app.DB.Model(&promotedUser).Updates(db.User{Groups: promotedUser.Groups})
 	app.DB.Save(promotedUser)
+	app.Principals.Invalidate(promotedUser.ID)
+
+	app.audit(app.DB, c, User, db.AuditRegionAdminPromote, "user", promotedUser.ID, Region.ID, nil, gin.H{"Group": group.ID})
 
 	model := CopyNestedModel(promotedUser, fieldsUserNoGroups)
 
-	c.JSON(http.StatusOK, model)
+	c.JSON(http.StatusOK, app.protectContacts(User, model))
+}
+
+// Removes a user from the admin group of a region.
+func (app *App) DemoteRegionAdmin(c *gin.Context) {
+
+	// Check authorization for this function.
+	User := app.AuthorizeShort(c)
+	if User == nil {
+		return
+	}
+
+	regionID := app.getUUID(c, "regionID")
+	if regionID == "" {
+		return
+	}
+
+	userID := app.getUUID(c, "userID")
+	if userID == "" {
+		return
+	}
+
+	var Region db.Region
+	app.DB.First(&Region, "\"id\" = ?", regionID)
+
+	if Region.ID == "" {
+
+		c.JSON(http.StatusNotFound, gin.H{
+			"Error": "The region you requested does not exist.",
+		})
+
+		return
+	}
+
+	// Check if user permissions are sufficient (user is admin).
+	if ok := app.CheckScope(User, Region, db.PermissionRegionAdminManage); !ok {
+
+		// Signal client that the provided authorization was not sufficient.
+		c.Header("WWW-Authenticate", "Bearer realm=\"CaTUstrophy\", error=\"authentication_failed\", error_description=\"Could not authenticate the request\"")
+		c.Status(http.StatusUnauthorized)
+
+		return
+	}
+
+	var group db.Group
+	app.DB.First(&group, "region_id = ? AND access_right = ?", regionID, db.RoleAdmin)
+
+	var demotedUser db.User
+	app.DB.First(&demotedUser, "\"id\" = ?", userID)
+
+	// Only members of the admin group can be demoted.
+	var CountMember int
+	app.DB.Table("user_groups").Where("\"group_id\" = ? AND \"user_id\" = ?", group.ID, userID).Count(&CountMember)
+
+	if demotedUser.ID == "" || group.ID == "" || CountMember == 0 {
+
+		c.JSON(http.StatusNotFound, gin.H{
+			"Error": "The user you requested is no admin of this region.",
+		})
+
+		return
+	}
+
+	tx := app.DB.Begin()
+	tx.Model(&demotedUser).Association("Groups").Delete(group)
+	app.audit(tx, c, User, db.AuditRegionAdminDemote, "user", demotedUser.ID, Region.ID, gin.H{"Group": group.ID}, nil)
+	tx.Commit()
+
+	app.Principals.Invalidate(demotedUser.ID)
+
+	model := CopyNestedModel(demotedUser, fieldsUserNoGroups)
+
+	c.JSON(http.StatusOK, app.protectContacts(User, model))
 }
 
 func (app *App) ListRecommendationsForRegion(c *gin.Context) {
@@ -607,7 +801,7 @@ func (app *App) ListRecommendationsForRegion(c *gin.Context) {
 	}
 
 	// Check if user permissions are sufficient (user is admin).
-	if ok := app.CheckScope(User, Region, "admin"); !ok {
+	if ok := app.CheckScope(User, Region, db.PermissionRecommendationRead); !ok {
 
 		// Signal client that the provided authorization was not sufficient.
 		c.Header("WWW-Authenticate", "Bearer realm=\"CaTUstrophy\", error=\"authentication_failed\", error_description=\"Could not authenticate the request\"")
@@ -662,8 +856,9 @@ func (app *App) ListOffersForRequest(c *gin.Context) {
 
 	// Load all offers for specified region that are
 	// - not yet expired
-	// - and not yet matched.
-	app.DB.Preload("Offers", "\"offers\".\"expired\" = ? AND \"offers\".\"matched\" = ?", false, false).First(&Region, "\"id\" = ?", regionID)
+	// - not yet matched
+	// - and not created by suspended users.
+	app.DB.Preload("Offers", ("\"offers\".\"expired\" = ? AND \"offers\".\"matched\" = ? AND "+enabledUsersOnly("offers")), false, false).First(&Region, "\"id\" = ?", regionID)
 
 	// If there currently is no recommendation for this region,
 	// take the time to calculate one.
@@ -684,7 +879,7 @@ func (app *App) ListOffersForRequest(c *gin.Context) {
 	}
 
 	// Check if user permissions are sufficient (user is admin).
-	if ok := app.CheckScope(User, Region, "admin"); !ok {
+	if ok := app.CheckScope(User, Region, db.PermissionRecommendationRead); !ok {
 
 		// Signal client that the provided authorization was not sufficient.
 		c.Header("WWW-Authenticate", "Bearer realm=\"CaTUstrophy\", error=\"authentication_failed\", error_description=\"Could not authenticate the request\"")
@@ -707,7 +902,7 @@ func (app *App) ListOffersForRequest(c *gin.Context) {
 	var Request db.Request
 
 	// Select region based on supplied ID from database.
-	app.DB.First(&Request, "\"id\" = ?", requestID)
+	app.DB.Preload("Tags").First(&Request, "\"id\" = ?", requestID)
 
 	if Request.ID == "" {
 
@@ -724,6 +919,10 @@ func (app *App) ListOffersForRequest(c *gin.Context) {
 
 	model := make([]map[string]interface{}, len(Region.Offers))
 
+	// Trust levels may have expired since scores were calculated.
+	trust := app.loadRegionTrust(Region.ID)
+	requiredRank := trustRank(trust.requiredLevel(Request.Tags))
+
 	// Iterate over all found elements in matching scores list.
 	addIndex := 0
 	for _, matchingScore := range MatchingScores {
@@ -742,6 +941,10 @@ func (app *App) ListOffersForRequest(c *gin.Context) {
 			model[addIndex]["MatchingScore"] = matchingScore.MatchingScore
 			model[addIndex]["Recommended"] = matchingScore.Recommended
 
+			// Add trust level of offering user and whether it suffices.
+			model[addIndex]["TrustLevel"] = trust.level(Region.Offers[i].UserID)
+			model[addIndex]["TrustMissing"] = trustRank(trust.level(Region.Offers[i].UserID)) < requiredRank
+
 			addIndex++
 		}
 	}
@@ -778,8 +981,9 @@ func (app *App) ListRequestsForOffer(c *gin.Context) {
 
 	// Load all requests for specified region that are
 	// - not yet expired
-	// - and not yet matched.
-	app.DB.Preload("Requests", "\"requests\".\"expired\" = ? AND \"requests\".\"matched\" = ?", false, false).First(&Region, "\"id\" = ?", regionID)
+	// - not yet matched
+	// - and not created by suspended users.
+	app.DB.Preload("Requests", ("\"requests\".\"expired\" = ? AND \"requests\".\"matched\" = ? AND "+enabledUsersOnly("requests")), false, false).First(&Region, "\"id\" = ?", regionID)
 
 	// If there currently is no recommendation for this region,
 	// take the time to calculate one.
@@ -800,7 +1004,7 @@ func (app *App) ListRequestsForOffer(c *gin.Context) {
 	}
 
 	// Check if user permissions are sufficient (user is admin).
-	if ok := app.CheckScope(User, Region, "admin"); !ok {
+	if ok := app.CheckScope(User, Region, db.PermissionRecommendationRead); !ok {
 
 		// Signal client that the provided authorization was not sufficient.
 		c.Header("WWW-Authenticate", "Bearer realm=\"CaTUstrophy\", error=\"authentication_failed\", error_description=\"Could not authenticate the offer\"")
@@ -865,3 +1069,81 @@ func (app *App) ListRequestsForOffer(c *gin.Context) {
 	// Send back results to client.
 	c.JSON(http.StatusOK, model)
 }
+
+func (app *App) suspendOrEnableUserInRegion(c *gin.Context, suspend bool) {
+
+	// Check authorization for this function.
+	User := app.AuthorizeShort(c)
+	if User == nil {
+		return
+	}
+
+	// Retrieve region ID from request URL.
+	regionID := app.getUUID(c, "regionID")
+	if regionID == "" {
+		return
+	}
+
+	var Region db.Region
+
+	// Select region based on supplied ID from database.
+	app.DB.First(&Region, "id = ?", regionID)
+
+	if Region.ID == "" {
+
+		c.JSON(http.StatusNotFound, gin.H{
+			"Error": "The region you requested does not exist.",
+		})
+
+		return
+	}
+
+	// Check if user permissions are sufficient (user is admin).
+	if ok := app.CheckScope(User, Region, db.PermissionRegionUserSuspend); !ok {
+
+		// Signal client that the provided authorization was not sufficient.
+		c.Header("WWW-Authenticate", "Bearer realm=\"CaTUstrophy\", error=\"authentication_failed\", error_description=\"Could not authenticate the request\"")
+		c.Status(http.StatusUnauthorized)
+
+		return
+	}
+
+	suspendUser := app.getSuspensionUser(c, User)
+	if suspendUser == nil {
+		return
+	}
+
+	// Region admins must not suspend other admins of their region.
+	if app.HasPermission(suspendUser, Region, db.PermissionRegionUserSuspend) {
+
+		c.JSON(http.StatusForbidden, gin.H{
+			"Error": "You tried to suspend or enable an admin of this region. Please contact a system admin.",
+		})
+
+		return
+	}
+
+	// Region admins are only responsible for users active in their region.
+	var CountOffers, CountRequests int
+	app.DB.Table("region_offers").Joins("JOIN \"offers\" ON \"offers\".\"id\" = \"region_offers\".\"offer_id\"").Where("\"region_offers\".\"region_id\" = ? AND \"offers\".\"user_id\" = ?", Region.ID, suspendUser.ID).Count(&CountOffers)
+	app.DB.Table("region_requests").Joins("JOIN \"requests\" ON \"requests\".\"id\" = \"region_requests\".\"request_id\"").Where("\"region_requests\".\"region_id\" = ? AND \"requests\".\"user_id\" = ?", Region.ID, suspendUser.ID).Count(&CountRequests)
+
+	if (CountOffers + CountRequests) == 0 {
+
+		c.JSON(http.StatusNotFound, gin.H{
+			"User": "The user you tried to suspend or enable has no offers or requests in this region.",
+		})
+
+		return
+	}
+
+	app.SetUserSuspension(User, suspendUser, Region, c, suspend)
+}
+
+func (app *App) SuspendUserInRegion(c *gin.Context) {
+	app.suspendOrEnableUserInRegion(c, true)
+}
+
+func (app *App) EnableUserInRegion(c *gin.Context) {
+	app.suspendOrEnableUserInRegion(c, false)
+}
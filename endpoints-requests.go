@@ -27,6 +27,7 @@ type CreateRequestPayload struct {
 	Tags           []string `conform:"trim" validate:"dive,excludesall=!@#$%^&*()_+-=:;?/0x2C0x7C"`
 	Description    string   `conform:"trim"`
 	ValidityPeriod string   `conform:"trim" validate:"required"`
+	Organisation   string   `conform:"trim"`
 }
 
 type UpdateRequestPayload struct {
@@ -57,6 +58,11 @@ func (app *App) CreateRequest(c *gin.Context) {
 		return
 	}
 
+	// Users may have to verify their mail address first.
+	if ok := app.CheckMailVerified(User, c); !ok {
+		return
+	}
+
 	var Payload CreateRequestPayload
 
 	// Expect request struct fields for creation in JSON request body.
@@ -104,6 +110,16 @@ func (app *App) CreateRequest(c *gin.Context) {
 		return
 	}
 
+	// Requests on behalf of an organisation require membership in it.
+	if Payload.Organisation != "" && app.organisationRole(User, Payload.Organisation) == "" {
+
+		c.JSON(http.StatusBadRequest, gin.H{
+			"Organisation": "You are no member of this organisation",
+		})
+
+		return
+	}
+
 	var Request db.Request
 
 	// Set insert struct to values from payload.
@@ -111,6 +127,7 @@ func (app *App) CreateRequest(c *gin.Context) {
 	Request.Name = Payload.Name
 	Request.User = *User
 	Request.UserID = User.ID
+	Request.OrganisationID = Payload.Organisation
 	Request.Location = gormGIS.GeoPoint{Lng: Payload.Location.Longitude, Lat: Payload.Location.Latitude}
 	Request.Description = Payload.Description
 	Request.Radius = Payload.Radius
@@ -193,7 +210,7 @@ func (app *App) CreateRequest(c *gin.Context) {
 	// Calculate the matching score of this request with all possible offers.
 	go app.CalcMatchScoreForRequest(Request)
 
-	model := CopyNestedModel(Request, fieldsRequestWithUser)
+	model := app.protectContacts(User, CopyNestedModel(Request, fieldsRequestWithUser))
 
 	c.JSON(http.StatusCreated, model)
 }
@@ -229,7 +246,7 @@ func (app *App) GetRequest(c *gin.Context) {
 
 	// Validity check:
 	// User accessing this request has to be either an admin in any region
-	if ok := ((request.UserID == User.ID) || app.CheckScopes(User, request.Regions, "admin")); !ok {
+	if ok := (app.ownsItem(User, request.UserID, request.OrganisationID) || app.CheckScopes(User, request.Regions, db.PermissionItemRead)); !ok {
 
 		// Signal client that the provided authorization was not sufficient.
 		c.Header("WWW-Authenticate", "Bearer realm=\"CaTUstrophy\", error=\"authentication_failed\", error_description=\"Could not authenticate the request\"")
@@ -239,7 +256,7 @@ func (app *App) GetRequest(c *gin.Context) {
 	}
 
 	// He or she can have it, if he or she wants it so badly! :)
-	model := CopyNestedModel(request, fieldsRequestWithUser)
+	model := app.protectContacts(User, CopyNestedModel(request, fieldsRequestWithUser))
 
 	c.JSON(http.StatusOK, model)
 }
@@ -274,7 +291,7 @@ func (app *App) UpdateRequest(c *gin.Context) {
 	app.DB.Model(&Request).Related(&Request.User)
 
 	// Check scope for user / admin on request.
-	if ok := ((Request.UserID == User.ID) || app.CheckScopes(User, Request.Regions, "admin")); !ok {
+	if ok := (app.ownsItem(User, Request.UserID, Request.OrganisationID) || app.CheckScopes(User, Request.Regions, db.PermissionItemUpdate)); !ok {
 
 		// Signal client that the provided authorization was not sufficient.
 		c.Header("WWW-Authenticate", "Bearer realm=\"CaTUstrophy\", error=\"authentication_failed\", error_description=\"Could not authenticate the request\"")
@@ -383,7 +400,7 @@ func (app *App) UpdateRequest(c *gin.Context) {
 	// Calculate the matching score of this request with all possible offers.
 	go app.CalcMatchScoreForRequest(Request)
 
-	model := CopyNestedModel(Request, fieldsRequestWithUser)
+	model := app.protectContacts(User, CopyNestedModel(Request, fieldsRequestWithUser))
 
 	c.JSON(http.StatusOK, model)
 }
@@ -0,0 +1,484 @@
+package main
+
+import (
+	"fmt"
+
+	"net/http"
+
+	"github.com/caTUstrophy/backend/db"
+	"github.com/gin-gonic/gin"
+	"github.com/satori/go.uuid"
+)
+
+// Structs
+
+type RolePayload struct {
+	Name        string   `conform:"trim,lower" validate:"required,excludesall=!@#$%^&*()+=[]{}|\\;'\"<>?/ "`
+	Description string   `conform:"trim" validate:"required"`
+	Permissions []string `validate:"required"`
+}
+
+type UpdateRolePayload struct {
+	Description string   `conform:"trim" validate:"required"`
+	Permissions []string `validate:"required"`
+}
+
+type GrantRolePayload struct {
+	Mail string `conform:"trim,email" validate:"required,email"`
+	Role string `conform:"trim,lower" validate:"required"`
+}
+
+// Functions
+
+// Checks that the authorized user may manage roles.
+// On fail writes an unauthorized response.
+func (app *App) authorizeRoleManagement(c *gin.Context) *db.User {
+
+	// Check authorization for this function.
+	User := app.AuthorizeShort(c)
+	if User == nil {
+		return nil
+	}
+
+	// Check if user permissions are sufficient.
+	if ok := app.CheckScope(User, db.Region{}, db.PermissionRoleManage); !ok {
+
+		// Signal client that the provided authorization was not sufficient.
+		c.Header("WWW-Authenticate", "Bearer realm=\"CaTUstrophy\", error=\"authentication_failed\", error_description=\"Could not authenticate the request\"")
+		c.Status(http.StatusUnauthorized)
+
+		return nil
+	}
+
+	return User
+}
+
+// Loads the permissions with supplied names. On unknown
+// names writes an error response and returns false.
+func (app *App) getPermissions(c *gin.Context, names []string) ([]db.Permission, bool) {
+
+	Permissions := make([]db.Permission, len(names))
+
+	for i, name := range names {
+
+		app.DB.First(&Permissions[i], "\"name\" = ?", name)
+
+		if Permissions[i].Name == "" {
+
+			c.JSON(http.StatusBadRequest, gin.H{
+				"Permissions": (name + " does not exist"),
+			})
+
+			return nil, false
+		}
+	}
+
+	return Permissions, true
+}
+
+func (app *App) ListPermissions(c *gin.Context) {
+
+	if User := app.authorizeRoleManagement(c); User == nil {
+		return
+	}
+
+	var Permissions []db.Permission
+	app.DB.Order("\"name\" ASC").Find(&Permissions)
+
+	model := CopyNestedModel(Permissions, fieldsPermission)
+
+	c.JSON(http.StatusOK, model)
+}
+
+func (app *App) ListRoles(c *gin.Context) {
+
+	if User := app.authorizeRoleManagement(c); User == nil {
+		return
+	}
+
+	var Roles []db.Role
+	app.DB.Preload("Permissions").Order("\"name\" ASC").Find(&Roles)
+
+	model := CopyNestedModel(Roles, fieldsRole)
+
+	c.JSON(http.StatusOK, model)
+}
+
+func (app *App) CreateRole(c *gin.Context) {
+
+	User := app.authorizeRoleManagement(c)
+	if User == nil {
+		return
+	}
+
+	var Payload RolePayload
+
+	// Expect role fields in JSON request body.
+	if ok := app.ValidatePayloadShort(c, &Payload); !ok {
+		return
+	}
+
+	// Check for duplicate role name.
+	var CountDup int
+	app.DB.Model(&db.Role{}).Where("\"name\" = ?", Payload.Name).Count(&CountDup)
+
+	if CountDup > 0 {
+
+		c.JSON(http.StatusBadRequest, gin.H{
+			"Name": "Already exists",
+		})
+
+		return
+	}
+
+	Permissions, ok := app.getPermissions(c, Payload.Permissions)
+	if !ok {
+		return
+	}
+
+	Role := db.Role{
+		ID:          fmt.Sprintf("%s", uuid.NewV4()),
+		Name:        Payload.Name,
+		Description: Payload.Description,
+		BuiltIn:     false,
+		Permissions: Permissions,
+	}
+	app.DB.Create(&Role)
+
+	model := CopyNestedModel(Role, fieldsRole)
+
+	app.audit(app.DB, c, User, db.AuditRoleCreate, "role", Role.ID, "", nil, model)
+
+	c.JSON(http.StatusCreated, model)
+}
+
+// Changes description and permissions of a custom role.
+// Built-in roles are restored on every start and can't
+// be changed here.
+func (app *App) UpdateRole(c *gin.Context) {
+
+	User := app.authorizeRoleManagement(c)
+	if User == nil {
+		return
+	}
+
+	roleID := app.getUUID(c, "roleID")
+	if roleID == "" {
+		return
+	}
+
+	var Role db.Role
+	app.DB.Preload("Permissions").First(&Role, "\"id\" = ?", roleID)
+
+	if Role.ID == "" {
+
+		c.JSON(http.StatusNotFound, gin.H{
+			"Error": "The role you requested does not exist.",
+		})
+
+		return
+	}
+
+	if Role.BuiltIn {
+
+		c.JSON(http.StatusBadRequest, gin.H{
+			"Error": "Built-in roles can not be changed.",
+		})
+
+		return
+	}
+
+	var Payload UpdateRolePayload
+
+	// Expect role fields in JSON request body.
+	if ok := app.ValidatePayloadShort(c, &Payload); !ok {
+		return
+	}
+
+	Permissions, ok := app.getPermissions(c, Payload.Permissions)
+	if !ok {
+		return
+	}
+
+	before := CopyNestedModel(Role, fieldsRole)
+
+	app.DB.Model(&Role).Update("description", Payload.Description)
+	app.DB.Model(&Role).Association("Permissions").Replace(Permissions)
+
+	// Any number of users might hold this role.
+	app.Principals.Clear()
+
+	Role.Permissions = Permissions
+
+	model := CopyNestedModel(Role, fieldsRole)
+
+	app.audit(app.DB, c, User, db.AuditRoleUpdate, "role", Role.ID, "", before, model)
+
+	c.JSON(http.StatusOK, model)
+}
+
+// Checks that supplied user holds all permissions of supplied
+// role in supplied region. On fail writes a forbidden response.
+func (app *App) mayGrantRole(c *gin.Context, User *db.User, Region db.Region, Role db.Role) bool {
+
+	for _, Permission := range Role.Permissions {
+
+		if ok := app.CheckScope(User, Region, Permission.Name); !ok {
+
+			c.JSON(http.StatusForbidden, gin.H{
+				"Error": "You can not grant a role with permissions you do not hold yourself.",
+			})
+
+			return false
+		}
+	}
+
+	return true
+}
+
+// Returns the group granting supplied role in supplied region,
+// which is created if it does not exist yet. Nobody may grant
+// permissions they don't hold themselves in that region. On
+// fail writes an error response and returns false.
+func (app *App) grantableGroup(c *gin.Context, User *db.User, Region db.Region, roleName string) (db.Group, bool) {
+
+	var Role db.Role
+	app.DB.Preload("Permissions").First(&Role, "\"name\" = ?", roleName)
+
+	if Role.ID == "" {
+
+		c.JSON(http.StatusBadRequest, gin.H{
+			"Role": "Does not exist",
+		})
+
+		return db.Group{}, false
+	}
+
+	if ok := app.mayGrantRole(c, User, Region, Role); !ok {
+		return db.Group{}, false
+	}
+
+	// Every region has at most one group per role.
+	var Group db.Group
+	app.DB.First(&Group, "\"region_id\" = ? AND \"role_id\" = ?", Region.ID, Role.ID)
+
+	if Group.ID == "" {
+
+		Group = db.Group{
+			ID:           fmt.Sprintf("%s", uuid.NewV4()),
+			DefaultGroup: false,
+			RegionId:     Region.ID,
+			RoleID:       Role.ID,
+			AccessRight:  Role.Name,
+			Description:  fmt.Sprintf("Group for role %s in region %s", Role.Name, Region.Name),
+		}
+		app.DB.Create(&Group)
+	}
+
+	return Group, true
+}
+
+// Grants a role in a region to a user. Nobody may grant
+// permissions they don't hold themselves in that region.
+func (app *App) GrantRoleInRegion(c *gin.Context) {
+
+	// Check authorization for this function.
+	User := app.AuthorizeShort(c)
+	if User == nil {
+		return
+	}
+
+	regionID := app.getUUID(c, "regionID")
+	if regionID == "" {
+		return
+	}
+
+	var Region db.Region
+	app.DB.First(&Region, "\"id\" = ?", regionID)
+
+	if Region.ID == "" {
+
+		c.JSON(http.StatusNotFound, gin.H{
+			"Error": "The region you requested does not exist.",
+		})
+
+		return
+	}
+
+	// Check if user permissions are sufficient.
+	if ok := app.CheckScope(User, Region, db.PermissionRegionRoleGrant); !ok {
+
+		// Signal client that the provided authorization was not sufficient.
+		c.Header("WWW-Authenticate", "Bearer realm=\"CaTUstrophy\", error=\"authentication_failed\", error_description=\"Could not authenticate the request\"")
+		c.Status(http.StatusUnauthorized)
+
+		return
+	}
+
+	var Payload GrantRolePayload
+
+	// Expect mail of user and name of role in JSON request body.
+	if ok := app.ValidatePayloadShort(c, &Payload); !ok {
+		return
+	}
+
+	var grantedUser db.User
+	app.DB.First(&grantedUser, "\"mail\" = ?", Payload.Mail)
+
+	if grantedUser.ID == "" {
+
+		c.JSON(http.StatusNotFound, gin.H{
+			"Error": "Email unkown to system.",
+		})
+
+		return
+	}
+
+	Group, ok := app.grantableGroup(c, User, Region, Payload.Role)
+	if !ok {
+		return
+	}
+
+	app.DB.Model(&grantedUser).Association("Groups").Append(Group)
+	app.Principals.Invalidate(grantedUser.ID)
+
+	app.audit(app.DB, c, User, db.AuditRoleGrant, "user", grantedUser.ID, Region.ID, nil, gin.H{"Group": Group.ID, "Role": Group.AccessRight})
+
+	model := CopyNestedModel(grantedUser, fieldsUserNoGroups)
+
+	c.JSON(http.StatusOK, app.protectContacts(User, model))
+}
+
+// Returns the group granting the role named in request URL in
+// supplied region. Only roles that could be granted by the user
+// can be revoked. On fail writes an error response.
+func (app *App) revocableGroup(c *gin.Context, User *db.User, Region db.Region) (db.Group, bool) {
+
+	var Role db.Role
+	app.DB.Preload("Permissions").First(&Role, "\"name\" = ?", c.Param("role"))
+
+	if Role.ID == "" {
+
+		c.JSON(http.StatusNotFound, gin.H{
+			"Error": "The role you requested does not exist.",
+		})
+
+		return db.Group{}, false
+	}
+
+	if ok := app.mayGrantRole(c, User, Region, Role); !ok {
+		return db.Group{}, false
+	}
+
+	var Group db.Group
+	app.DB.First(&Group, "\"region_id\" = ? AND \"role_id\" = ?", Region.ID, Role.ID)
+
+	return Group, true
+}
+
+// Revokes a role in a region from a user, e.g. one granted
+// via GrantRoleInRegion or an accepted invitation.
+func (app *App) RevokeRoleInRegion(c *gin.Context) {
+
+	// Check authorization for this function.
+	User := app.AuthorizeShort(c)
+	if User == nil {
+		return
+	}
+
+	Region := app.getRegionWithPermission(c, User, db.PermissionRegionRoleGrant)
+	if Region == nil {
+		return
+	}
+
+	userID := app.getUUID(c, "userID")
+	if userID == "" {
+		return
+	}
+
+	Group, ok := app.revocableGroup(c, User, *Region)
+	if !ok {
+		return
+	}
+
+	var revokedUser db.User
+	app.DB.First(&revokedUser, "\"id\" = ?", userID)
+
+	// Only users holding the role can lose it.
+	var CountMember int
+	app.DB.Table("user_groups").Where("\"group_id\" = ? AND \"user_id\" = ?", Group.ID, userID).Count(&CountMember)
+
+	if revokedUser.ID == "" || Group.ID == "" || CountMember == 0 {
+
+		c.JSON(http.StatusNotFound, gin.H{
+			"Error": "The user you requested does not hold this role in this region.",
+		})
+
+		return
+	}
+
+	tx := app.DB.Begin()
+	tx.Model(&revokedUser).Association("Groups").Delete(Group)
+	app.audit(tx, c, User, db.AuditRoleRevoke, "user", revokedUser.ID, Region.ID, gin.H{"Group": Group.ID, "Role": Group.AccessRight}, nil)
+	tx.Commit()
+
+	app.Principals.Invalidate(revokedUser.ID)
+
+	model := CopyNestedModel(revokedUser, fieldsUserNoGroups)
+
+	c.JSON(http.StatusOK, app.protectContacts(User, model))
+}
+
+// Revokes a role in a region from an organisation, so
+// that none of its members holds it through it anymore.
+func (app *App) RevokeRoleFromOrganisationInRegion(c *gin.Context) {
+
+	// Check authorization for this function.
+	User := app.AuthorizeShort(c)
+	if User == nil {
+		return
+	}
+
+	Region := app.getRegionWithPermission(c, User, db.PermissionRegionRoleGrant)
+	if Region == nil {
+		return
+	}
+
+	organisationID := app.getUUID(c, "organisationID")
+	if organisationID == "" {
+		return
+	}
+
+	Group, ok := app.revocableGroup(c, User, *Region)
+	if !ok {
+		return
+	}
+
+	var Organisation db.Organisation
+	app.DB.First(&Organisation, "\"id\" = ?", organisationID)
+
+	// Only organisations holding the role can lose it.
+	var CountHolding int
+	app.DB.Table("organisation_groups").Where("\"group_id\" = ? AND \"organisation_id\" = ?", Group.ID, organisationID).Count(&CountHolding)
+
+	if Organisation.ID == "" || Group.ID == "" || CountHolding == 0 {
+
+		c.JSON(http.StatusNotFound, gin.H{
+			"Error": "The organisation you requested does not hold this role in this region.",
+		})
+
+		return
+	}
+
+	tx := app.DB.Begin()
+	tx.Model(&Organisation).Association("Groups").Delete(Group)
+	app.audit(tx, c, User, db.AuditRoleRevoke, "organisation", Organisation.ID, Region.ID, gin.H{"Group": Group.ID, "Role": Group.AccessRight}, nil)
+	tx.Commit()
+
+	// Any number of members lose permissions.
+	app.Principals.Clear()
+
+	model := CopyNestedModel(Organisation, fieldsOrganisation)
+
+	c.JSON(http.StatusOK, model)
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"net/http"
+
+	"github.com/caTUstrophy/backend/db"
+	"github.com/gin-gonic/gin"
+	"github.com/satori/go.uuid"
+)
+
+// Structs
+
+type CreateServiceAccountPayload struct {
+	Name   string         `conform:"trim" validate:"required"`
+	Mail   string         `conform:"trim,email" validate:"required,email"`
+	Groups []GroupPayload `validate:"dive"`
+}
+
+type CreateAPIKeyPayload struct {
+	Name string `conform:"trim" validate:"required"`
+}
+
+// Functions
+
+// Checks that the authorized user is a superadmin, as
+// only they may manage service accounts. On fail writes
+// an unauthorized response.
+func (app *App) authorizeServiceAccountManagement(c *gin.Context) *db.User {
+
+	// Check authorization for this function.
+	User := app.AuthorizeShort(c)
+	if User == nil {
+		return nil
+	}
+
+	// Check if user permissions are sufficient (user is admin).
+	if ok := app.CheckScope(User, db.Region{}, db.PermissionServiceAccountManage); !ok {
+
+		// Signal client that the provided authorization was not sufficient.
+		c.Header("WWW-Authenticate", "Bearer realm=\"CaTUstrophy\", error=\"authentication_failed\", error_description=\"Could not authenticate the request\"")
+		c.Status(http.StatusUnauthorized)
+
+		return nil
+	}
+
+	return User
+}
+
+// Loads the service account referenced in request URL.
+// On fail writes an error response.
+func (app *App) getServiceAccount(c *gin.Context) *db.User {
+
+	userID := app.getUUID(c, "userID")
+	if userID == "" {
+		return nil
+	}
+
+	var ServiceAccount db.User
+	app.DB.First(&ServiceAccount, "id = ? AND service_account = ?", userID, true)
+
+	if ServiceAccount.ID == "" {
+
+		c.JSON(http.StatusNotFound, gin.H{
+			"Error": "The service account you requested does not exist.",
+		})
+
+		return nil
+	}
+
+	return &ServiceAccount
+}
+
+func (app *App) CreateServiceAccount(c *gin.Context) {
+
+	User := app.authorizeServiceAccountManagement(c)
+	if User == nil {
+		return
+	}
+
+	var Payload CreateServiceAccountPayload
+
+	// Expect service account fields in JSON request body.
+	if ok := app.ValidatePayloadShort(c, &Payload); !ok {
+		return
+	}
+
+	// Check for user duplicate attempt: entry with mail exists?
+	var CountDup int
+	app.DB.Model(&db.User{}).Where("mail = ?", Payload.Mail).Count(&CountDup)
+
+	if CountDup > 0 {
+
+		// Signal client that this mail is already in use.
+		c.JSON(http.StatusBadRequest, gin.H{
+			"Mail": "Already exists",
+		})
+
+		return
+	}
+
+	// Service accounts are limited to region groups, no integration
+	// should ever hold a system-wide role except the default one.
+	Groups := make([]db.Group, len(Payload.Groups))
+
+	for i, gid := range Payload.Groups {
+
+		group := app.GetGroupObject(gid.ID)
+
+		if group.ID == "" || (group.RegionId == "" && !group.DefaultGroup) {
+
+			c.JSON(http.StatusBadRequest, gin.H{
+				"Groups": (gid.ID + " does not exist or is not allowed"),
+			})
+
+			return
+		}
+
+		Groups[i] = group
+	}
+
+	// Without any groups, a service account is a regular user.
+	if len(Groups) == 0 {
+
+		var DefaultGroup db.Group
+		app.DB.First(&DefaultGroup, "default_group = ?", true)
+
+		Groups = []db.Group{DefaultGroup}
+	}
+
+	ServiceAccount := db.User{
+		ID:           fmt.Sprintf("%s", uuid.NewV4()),
+		Name:         Payload.Name,
+		Mail:         Payload.Mail,
+		MailVerified: true,
+		PhoneNumbers: db.PhoneNumbers{},
+		// Not a valid password hash, so nobody can log in with a password.
+		PasswordHash:   fmt.Sprintf("!service-account-%s", uuid.NewV4()),
+		Groups:         Groups,
+		Enabled:        true,
+		ServiceAccount: true,
+	}
+
+	app.DB.Create(&ServiceAccount)
+
+	app.DB.Preload("Groups").First(&ServiceAccount, "id = ?", ServiceAccount.ID)
+
+	for i, _ := range ServiceAccount.Groups {
+		app.DB.Model(&ServiceAccount.Groups[i]).Related(&ServiceAccount.Groups[i].Region)
+	}
+
+	model := CopyNestedModel(ServiceAccount, fieldsUser)
+
+	app.audit(app.DB, c, User, db.AuditServiceAccountCreate, "user", ServiceAccount.ID, "", nil, model)
+
+	c.JSON(http.StatusCreated, model)
+}
+
+func (app *App) ListServiceAccounts(c *gin.Context) {
+
+	if User := app.authorizeServiceAccountManagement(c); User == nil {
+		return
+	}
+
+	var ServiceAccounts []db.User
+	app.DB.Preload("Groups").Find(&ServiceAccounts, "service_account = ?", true)
+
+	for i, _ := range ServiceAccounts {
+
+		for j, _ := range ServiceAccounts[i].Groups {
+			app.DB.Model(&ServiceAccounts[i].Groups[j]).Related(&ServiceAccounts[i].Groups[j].Region)
+		}
+	}
+
+	model := CopyNestedModel(ServiceAccounts, fieldsUser)
+
+	c.JSON(http.StatusOK, model)
+}
+
+func (app *App) ListAPIKeys(c *gin.Context) {
+
+	if User := app.authorizeServiceAccountManagement(c); User == nil {
+		return
+	}
+
+	ServiceAccount := app.getServiceAccount(c)
+	if ServiceAccount == nil {
+		return
+	}
+
+	var APIKeys []db.APIKey
+	app.DB.Order("\"created_at\" ASC").Find(&APIKeys, "\"user_id\" = ?", ServiceAccount.ID)
+
+	model := CopyNestedModel(APIKeys, fieldsAPIKey)
+
+	c.JSON(http.StatusOK, model)
+}
+
+// Creates a new API key for a service account. The key
+// itself is only contained in this response, we store
+// nothing but its hash.
+func (app *App) CreateAPIKey(c *gin.Context) {
+
+	User := app.authorizeServiceAccountManagement(c)
+	if User == nil {
+		return
+	}
+
+	ServiceAccount := app.getServiceAccount(c)
+	if ServiceAccount == nil {
+		return
+	}
+
+	var Payload CreateAPIKeyPayload
+
+	// Expect name of key in JSON request body.
+	if ok := app.ValidatePayloadShort(c, &Payload); !ok {
+		return
+	}
+
+	key := "ctk_" + generateOpaqueToken()
+
+	APIKey := db.APIKey{
+		ID:        fmt.Sprintf("%s", uuid.NewV4()),
+		Name:      Payload.Name,
+		Prefix:    key[:12],
+		KeyHash:   hashOpaqueToken(key),
+		UserID:    ServiceAccount.ID,
+		CreatedAt: time.Now(),
+		Revoked:   false,
+	}
+	app.DB.Create(&APIKey)
+
+	model := CopyNestedModel(APIKey, fieldsAPIKey).(map[string]interface{})
+
+	// Audit before adding the key, it must never be stored in plaintext.
+	app.audit(app.DB, c, User, db.AuditAPIKeyCreate, "api_key", APIKey.ID, "", nil, model)
+
+	model["Key"] = key
+
+	c.JSON(http.StatusCreated, model)
+}
+
+func (app *App) RevokeAPIKey(c *gin.Context) {
+
+	User := app.authorizeServiceAccountManagement(c)
+	if User == nil {
+		return
+	}
+
+	ServiceAccount := app.getServiceAccount(c)
+	if ServiceAccount == nil {
+		return
+	}
+
+	keyID := app.getUUID(c, "keyID")
+	if keyID == "" {
+		return
+	}
+
+	var APIKey db.APIKey
+	app.DB.First(&APIKey, "\"id\" = ? AND \"user_id\" = ?", keyID, ServiceAccount.ID)
+
+	if APIKey.ID == "" {
+
+		c.JSON(http.StatusNotFound, gin.H{
+			"Error": "The API key you requested does not exist.",
+		})
+
+		return
+	}
+
+	before := CopyNestedModel(APIKey, fieldsAPIKey)
+
+	app.DB.Model(&APIKey).Update("revoked", true)
+
+	model := CopyNestedModel(APIKey, fieldsAPIKey)
+
+	app.audit(app.DB, c, User, db.AuditAPIKeyRevoke, "api_key", APIKey.ID, "", before, model)
+
+	c.JSON(http.StatusOK, model)
+}
@@ -8,9 +8,51 @@ import (
 	"github.com/caTUstrophy/backend/db"
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator"
+	"github.com/jinzhu/gorm"
 	"github.com/leebenson/conform"
 )
 
+// Locks all system admin groups until supplied transaction ends, so
+// that concurrent changes can not remove the last system admins
+// together. Returns the groups and their IDs.
+func lockSystemAdminGroups(tx *gorm.DB) ([]db.Group, []string) {
+
+	var Groups []db.Group
+	tx.Set("gorm:query_option", "FOR UPDATE").Find(&Groups, "\"access_right\" = ? AND \"region_id\" = ''", db.RoleSuperadmin)
+
+	groupIDs := make([]string, len(Groups))
+	for i, group := range Groups {
+		groupIDs[i] = group.ID
+	}
+
+	return Groups, groupIDs
+}
+
+// Checks that another enabled system admin than supplied user
+// remains, otherwise nobody could ever promote a new one. On
+// fail rolls back supplied transaction and writes an error response.
+func keepsSystemAdmin(c *gin.Context, tx *gorm.DB, groupIDs []string, userID string) bool {
+
+	var CountRemaining int
+	tx.Table("user_groups").
+		Joins("JOIN \"users\" ON \"users\".\"id\" = \"user_groups\".\"user_id\"").
+		Where("\"user_groups\".\"group_id\" IN (?) AND \"users\".\"enabled\" = ? AND \"users\".\"id\" <> ?", groupIDs, true, userID).
+		Count(&CountRemaining)
+
+	if CountRemaining == 0 {
+
+		tx.Rollback()
+
+		c.JSON(http.StatusBadRequest, gin.H{
+			"Error": "You can not demote the last system admin.",
+		})
+
+		return false
+	}
+
+	return true
+}
+
 func (app *App) PromoteToSystemAdmin(c *gin.Context) {
 
 	// Check authorization for this function.
@@ -25,7 +67,7 @@ func (app *App) PromoteToSystemAdmin(c *gin.Context) {
 	}
 
 	// Check if user permissions are sufficient (user is admin).
-	if ok := app.CheckScope(User, db.Region{}, "superadmin"); !ok {
+	if ok := app.CheckScope(User, db.Region{}, db.PermissionSystemAdminManage); !ok {
 
 		// Signal client that the provided authorization was not sufficient.
 		c.Header("WWW-Authenticate", "Bearer realm=\"CaTUstrophy\", error=\"authentication_failed\", error_description=\"Could not authenticate the request\"")
@@ -74,7 +116,7 @@ func (app *App) PromoteToSystemAdmin(c *gin.Context) {
 
 	// Everything seems fine, promote that user.
 	var group db.Group
-	app.DB.First(&group, "access_right = ?", "superadmin")
+	app.DB.First(&group, "access_right = ?", db.RoleSuperadmin)
 
 	// Find the user who is to be promoted and add the group to his or her groups.
 	var promotedUser db.User
@@ -92,8 +134,113 @@ func (app *App) PromoteToSystemAdmin(c *gin.Context) {
 	promotedUser.Groups = append(promotedUser.Groups, group)
 	// app.DB.Model(&promotedUser).Updates(db.User{Groups: promotedUser.Groups})
 	app.DB.Save(promotedUser)
+	app.Principals.Invalidate(promotedUser.ID)
+
+	app.audit(app.DB, c, User, db.AuditSystemAdminPromote, "user", promotedUser.ID, "", nil, gin.H{"Group": group.ID})
 
 	model := CopyNestedModel(promotedUser, fieldsUser)
 
 	c.JSON(http.StatusOK, model)
 }
+
+// Removes a user from all system admin groups. The last
+// enabled system admin can not be demoted, otherwise nobody
+// could ever promote a new one.
+func (app *App) DemoteSystemAdmin(c *gin.Context) {
+
+	// Check authorization for this function.
+	User := app.AuthorizeShort(c)
+	if User == nil {
+		return
+	}
+
+	// Check if user permissions are sufficient (user is admin).
+	if ok := app.CheckScope(User, db.Region{}, db.PermissionSystemAdminManage); !ok {
+
+		// Signal client that the provided authorization was not sufficient.
+		c.Header("WWW-Authenticate", "Bearer realm=\"CaTUstrophy\", error=\"authentication_failed\", error_description=\"Could not authenticate the request\"")
+		c.Status(http.StatusUnauthorized)
+
+		return
+	}
+
+	userID := app.getUUID(c, "userID")
+	if userID == "" {
+		return
+	}
+
+	var demotedUser db.User
+	app.DB.First(&demotedUser, "\"id\" = ?", userID)
+
+	tx := app.DB.Begin()
+
+	Groups, groupIDs := lockSystemAdminGroups(tx)
+
+	var CountMember int
+	if len(groupIDs) > 0 {
+		tx.Table("user_groups").Where("\"group_id\" IN (?) AND \"user_id\" = ?", groupIDs, userID).Count(&CountMember)
+	}
+
+	if demotedUser.ID == "" || CountMember == 0 {
+
+		tx.Rollback()
+
+		c.JSON(http.StatusNotFound, gin.H{
+			"Error": "The user you requested is no system admin.",
+		})
+
+		return
+	}
+
+	if ok := keepsSystemAdmin(c, tx, groupIDs, userID); !ok {
+		return
+	}
+
+	tx.Model(&demotedUser).Association("Groups").Delete(Groups)
+	app.audit(tx, c, User, db.AuditSystemAdminDemote, "user", demotedUser.ID, "", gin.H{"Groups": groupIDs}, nil)
+	tx.Commit()
+
+	app.Principals.Invalidate(demotedUser.ID)
+
+	model := CopyNestedModel(demotedUser, fieldsUserNoGroups)
+
+	c.JSON(http.StatusOK, model)
+}
+
+// Lists all mail addresses and client IPs that are currently
+// locked out from logging in due to too many failed attempts.
+func (app *App) ListLockouts(c *gin.Context) {
+
+	// Check authorization for this function.
+	User := app.AuthorizeShort(c)
+	if User == nil {
+		return
+	}
+
+	// Check if user permissions are sufficient (user is admin).
+	if ok := app.CheckScope(User, db.Region{}, db.PermissionSystemLockoutRead); !ok {
+
+		// Signal client that the provided authorization was not sufficient.
+		c.Header("WWW-Authenticate", "Bearer realm=\"CaTUstrophy\", error=\"authentication_failed\", error_description=\"Could not authenticate the request\"")
+		c.Status(http.StatusUnauthorized)
+
+		return
+	}
+
+	Lockouts := app.LoginThrottle.Locked()
+
+	model := make([]map[string]interface{}, len(Lockouts))
+
+	for i, lockout := range Lockouts {
+
+		model[i] = map[string]interface{}{
+			"Type":        lockout.Type,
+			"Value":       lockout.Value,
+			"Lockouts":    lockout.Lockouts,
+			"LastFailure": lockout.LastFailure,
+			"LockedUntil": lockout.LockedUntil,
+		}
+	}
+
+	c.JSON(http.StatusOK, model)
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"net/http"
+
+	"github.com/caTUstrophy/backend/db"
+	"github.com/gin-gonic/gin"
+	"github.com/satori/go.uuid"
+)
+
+// Structs
+
+type TwoFactorCodePayload struct {
+	Code string `conform:"trim" validate:"required"`
+}
+
+type DisableTwoFactorPayload struct {
+	Password string `validate:"required"`
+	Code     string `conform:"trim" validate:"required"`
+}
+
+type LoginSecondFactorPayload struct {
+	ChallengeToken string `conform:"trim" validate:"required"`
+	Code           string `conform:"trim" validate:"required"`
+}
+
+// Functions
+
+// Checks supplied code as second factor of supplied user. Accepts
+// a current TOTP code that was not used before or an unused
+// recovery code. Either one can only be used once.
+func (app *App) checkSecondFactor(user *db.User, code string) bool {
+
+	if counter, ok := verifyTOTP(user.TOTPSecret, code, time.Now()); ok {
+
+		// Remember used time step, so that an intercepted code can not be replayed.
+		result := app.DB.Model(&db.User{}).Where("\"id\" = ? AND \"totp_last_counter\" < ?", user.ID, counter).Update("totp_last_counter", counter)
+
+		return result.RowsAffected > 0
+	}
+
+	// Try code as recovery code.
+	result := app.DB.Model(&db.RecoveryCode{}).Where("\"user_id\" = ? AND \"code_hash\" = ? AND \"used\" = ?", user.ID, hashOpaqueToken(normalizeRecoveryCode(code)), false).Update("used", true)
+
+	return result.RowsAffected > 0
+}
+
+// Replaces all recovery codes of supplied user with new
+// ones and returns these in plaintext.
+func (app *App) makeRecoveryCodes(user *db.User) []string {
+
+	app.DB.Where("\"user_id\" = ?", user.ID).Delete(&db.RecoveryCode{})
+
+	codes := make([]string, 10)
+
+	for i := range codes {
+
+		codes[i] = generateRecoveryCode()
+
+		RecoveryCode := db.RecoveryCode{
+			ID:       fmt.Sprintf("%s", uuid.NewV4()),
+			UserID:   user.ID,
+			CodeHash: hashOpaqueToken(normalizeRecoveryCode(codes[i])),
+			Used:     false,
+		}
+		app.DB.Create(&RecoveryCode)
+	}
+
+	return codes
+}
+
+// Starts enrollment of TOTP as second factor by creating a new
+// secret. Second factor is only enabled after confirming a code.
+func (app *App) StartTwoFactorEnrollment(c *gin.Context) {
+
+	// Check authorization for this function.
+	User := app.AuthorizeShort(c)
+	if User == nil {
+		return
+	}
+
+	if User.TOTPEnabled {
+
+		c.JSON(http.StatusBadRequest, gin.H{
+			"Error": "Two-factor authentication is already enabled",
+		})
+
+		return
+	}
+
+	secret := generateTOTPSecret()
+	app.DB.Model(User).Updates(map[string]interface{}{
+		"totp_secret":       secret,
+		"totp_last_counter": 0,
+	})
+	app.Principals.Invalidate(User.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"Secret": secret,
+		"URI":    totpURI(secret, User.Mail),
+	})
+}
+
+// Enables TOTP as second factor after the user proved to be
+// able to generate codes and hands out recovery codes.
+func (app *App) ConfirmTwoFactorEnrollment(c *gin.Context) {
+
+	// Check authorization for this function.
+	User := app.AuthorizeShort(c)
+	if User == nil {
+		return
+	}
+
+	var Payload TwoFactorCodePayload
+
+	// Expect TOTP code in JSON request body.
+	if ok := app.ValidatePayloadShort(c, &Payload); !ok {
+		return
+	}
+
+	if User.TOTPEnabled || User.TOTPSecret == "" {
+
+		c.JSON(http.StatusBadRequest, gin.H{
+			"Error": "No two-factor enrollment in progress",
+		})
+
+		return
+	}
+
+	// Only TOTP codes are accepted here, there are no recovery codes yet.
+	counter, ok := verifyTOTP(User.TOTPSecret, Payload.Code, time.Now())
+	if !ok {
+
+		c.JSON(http.StatusBadRequest, gin.H{
+			"Code": "Is invalid",
+		})
+
+		return
+	}
+
+	app.DB.Model(User).Updates(map[string]interface{}{
+		"totp_enabled":      true,
+		"totp_last_counter": counter,
+	})
+	app.Principals.Invalidate(User.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"RecoveryCodes": app.makeRecoveryCodes(User),
+	})
+}
+
+func (app *App) DisableTwoFactor(c *gin.Context) {
+
+	// Check authorization for this function.
+	User := app.AuthorizeShort(c)
+	if User == nil {
+		return
+	}
+
+	var Payload DisableTwoFactorPayload
+
+	// Expect password and code in JSON request body.
+	if ok := app.ValidatePayloadShort(c, &Payload); !ok {
+		return
+	}
+
+	if !User.TOTPEnabled {
+
+		c.JSON(http.StatusBadRequest, gin.H{
+			"Error": "Two-factor authentication is not enabled",
+		})
+
+		return
+	}
+
+	// Disabling requires both factors.
+	if ok, _ := app.Passwords.Verify(User.PasswordHash, Payload.Password); !ok {
+
+		c.JSON(http.StatusBadRequest, gin.H{
+			"Password": "Is wrong",
+		})
+
+		return
+	}
+
+	if ok := app.checkSecondFactor(User, Payload.Code); !ok {
+
+		c.JSON(http.StatusBadRequest, gin.H{
+			"Code": "Is invalid",
+		})
+
+		return
+	}
+
+	app.DB.Model(User).Updates(map[string]interface{}{
+		"totp_enabled":      false,
+		"totp_secret":       "",
+		"totp_last_counter": 0,
+	})
+	app.DB.Where("\"user_id\" = ?", User.ID).Delete(&db.RecoveryCode{})
+	app.Principals.Invalidate(User.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"ID": User.ID,
+	})
+}
+
+// Second step of login for users with enabled two-factor
+// authentication. Every challenge token can only be used
+// once, a wrong code requires to log in again.
+func (app *App) LoginSecondFactor(c *gin.Context) {
+
+	var Payload LoginSecondFactorPayload
+
+	// Expect challenge token and code in JSON request body.
+	if ok := app.ValidatePayloadShort(c, &Payload); !ok {
+		return
+	}
+
+	// Check challenge token and mark it as used.
+	User := app.useOneTimeToken(Payload.ChallengeToken, db.OneTimeTokenLoginChallenge)
+	if User == nil || !User.Enabled {
+
+		c.JSON(http.StatusBadRequest, gin.H{
+			"ChallengeToken": "Is invalid or expired",
+		})
+
+		return
+	}
+
+	clientIP := c.ClientIP()
+
+	// Wrong codes count towards the same lockout as wrong passwords.
+	if wait := app.LoginThrottle.RetryAfter(User.Mail, clientIP); wait > 0 {
+
+		c.Header("Retry-After", fmt.Sprintf("%d", int(math.Ceil(wait.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"Error": "Too many failed login attempts, try again later",
+		})
+
+		return
+	}
+
+	if ok := app.checkSecondFactor(User, Payload.Code); !ok {
+
+		app.LoginThrottle.Fail(User.Mail, clientIP)
+
+		c.JSON(http.StatusBadRequest, gin.H{
+			"Code": "Is invalid",
+		})
+
+		return
+	}
+
+	app.LoginThrottle.Succeed(User.Mail)
+
+	app.startSession(c, User)
+}
@@ -3,50 +3,123 @@ package main
 import (
 	"fmt"
 	"log"
+	"strconv"
+	"strings"
+	"time"
 
+	"encoding/base64"
+	"encoding/json"
 	"net/http"
 
 	"github.com/caTUstrophy/backend/db"
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator"
+	"github.com/jinzhu/gorm"
 	"github.com/leebenson/conform"
 	"github.com/satori/go.uuid"
-	"golang.org/x/crypto/bcrypt"
 )
 
 // Structs
 
 type CreateUserPayload struct {
-	Name          string   `conform:"trim" validate:"required,excludesall=!@#$%^&*()_+-=:;?/0x2C0x7C"`
-	PreferredName string   `conform:"trim" validate:"excludesall=!@#$%^&*()_+-=:;?/0x2C0x7C"`
-	Mail          string   `conform:"trim,email" validate:"required,email"`
-	PhoneNumbers  []string `conform:"trim" validate:"required"`
-	Password      string   `validate:"required,min=16,containsany=0123456789,containsany=!@#$%^&*()_+-=:;?/0x2C0x7C"`
+	Name          string               `conform:"trim" validate:"required,excludesall=!@#$%^&*()_+-=:;?/0x2C0x7C"`
+	PreferredName string               `conform:"trim" validate:"excludesall=!@#$%^&*()_+-=:;?/0x2C0x7C"`
+	Mail          string               `conform:"trim,email" validate:"required,email"`
+	PhoneNumbers  []PhoneNumberPayload `validate:"required"`
+	Password      string               `validate:"required"`
 }
 
 type UpdateUserPayload struct {
-	Name          string   `conform:"trim" validate:"excludesall=!@#$%^&*()_+-=:;?/0x2C0x7C"`
-	PreferredName string   `conform:"trim" validate:"excludesall=!@#$%^&*()_+-=:;?/0x2C0x7C"`
-	Mail          string   `conform:"trim"`
-	PhoneNumbers  []string `conform:"trim"`
+	Name          string `conform:"trim" validate:"excludesall=!@#$%^&*()_+-=:;?/0x2C0x7C"`
+	PreferredName string `conform:"trim" validate:"excludesall=!@#$%^&*()_+-=:;?/0x2C0x7C"`
+	Mail          string `conform:"trim"`
+	PhoneNumbers  []PhoneNumberPayload
 	Password      string
 	Groups        []GroupPayload
 }
 
-type GroupPayload struct {
-	ID string `conform:"trim" validate:"required,uuid4"`
+// Phone numbers can be supplied as objects with optional
+// label or, like before labels existed, as plain strings.
+type PhoneNumberPayload struct {
+	Number string
+	Label  string
 }
 
-type PasswordPayload struct {
-	Password string `validate:"min=16,containsany=0123456789,containsany=!@#$%^&*()_+-=:;?/0x2C0x7C"`
+type GroupPayload struct {
+	ID string `conform:"trim" validate:"required,uuid4"`
 }
 
 type EmailPayload struct {
 	Mail string `conform:"trim,email" validate:"email"`
 }
 
+type SuspensionPayload struct {
+	Reason string `conform:"trim" validate:"required"`
+}
+
+// Variables
+
+// Columns user listings can be sorted by.
+var userSortColumns = map[string]string{
+	"name": "name",
+	"mail": "mail",
+}
+
+// Condition for users that are member of a group of a region or
+// have offers or requests there. Expects the region ID three times.
+const usersActiveInRegion = "(\"id\" IN (SELECT \"user_groups\".\"user_id\" FROM \"user_groups\" JOIN \"groups\" ON \"groups\".\"id\" = \"user_groups\".\"group_id\" WHERE \"groups\".\"region_id\" = ?) OR " +
+	"\"id\" IN (SELECT \"offers\".\"user_id\" FROM \"offers\" JOIN \"region_offers\" ON \"region_offers\".\"offer_id\" = \"offers\".\"id\" WHERE \"region_offers\".\"region_id\" = ?) OR " +
+	"\"id\" IN (SELECT \"requests\".\"user_id\" FROM \"requests\" JOIN \"region_requests\" ON \"region_requests\".\"request_id\" = \"requests\".\"id\" WHERE \"region_requests\".\"region_id\" = ?))"
+
+// Escapes wildcards in a search term for a LIKE condition.
+var likeEscaper = strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_")
+
 // Functions
 
+func (payload *PhoneNumberPayload) UnmarshalJSON(data []byte) error {
+
+	var number string
+	if err := json.Unmarshal(data, &number); err == nil {
+		payload.Number = number
+		return nil
+	}
+
+	// Alias type without this method to avoid endless recursion.
+	type phoneNumberObject PhoneNumberPayload
+
+	return json.Unmarshal(data, (*phoneNumberObject)(payload))
+}
+
+// Validates supplied phone numbers and converts them to E.164.
+// Numbers without country code are taken to be of our default
+// region. On invalid numbers writes an error response naming
+// each of them and returns false.
+func (app *App) parsePhoneNumbers(c *gin.Context, payload []PhoneNumberPayload) (db.PhoneNumbers, bool) {
+
+	PhoneNumbers := make(db.PhoneNumbers, len(payload))
+	errResp := make(map[string]string)
+
+	for i, number := range payload {
+
+		PhoneNumber, err := db.NewPhoneNumber(number.Number, number.Label, app.PhoneRegion)
+		if err != nil {
+			errResp[fmt.Sprintf("PhoneNumbers[%d]", i)] = err.Error()
+			continue
+		}
+
+		PhoneNumbers[i] = PhoneNumber
+	}
+
+	if len(errResp) > 0 {
+
+		c.JSON(http.StatusBadRequest, errResp)
+
+		return nil, false
+	}
+
+	return PhoneNumbers, true
+}
+
 func (app *App) CreateUser(c *gin.Context) {
 
 	var Payload CreateUserPayload
@@ -106,6 +179,11 @@ func (app *App) CreateUser(c *gin.Context) {
 		return
 	}
 
+	// Check password against our password policy.
+	if ok := app.checkPasswordPolicy(c, Payload.Password, Payload.Name, Payload.PreferredName, Payload.Mail); !ok {
+		return
+	}
+
 	var User db.User
 
 	User.ID = fmt.Sprintf("%s", uuid.NewV4())
@@ -114,23 +192,16 @@ func (app *App) CreateUser(c *gin.Context) {
 	User.Mail = Payload.Mail
 	User.MailVerified = false
 
-	jsonPhoneNumbers := new(db.PhoneNumbers)
-	err = jsonPhoneNumbers.Scan(Payload.PhoneNumbers)
-	if err != nil {
-
-		// Signal client that the supplied phone numbers contained some kind of error.
-		c.JSON(http.StatusBadRequest, gin.H{
-			"PhoneNumbers": "Are not valid",
-		})
-
+	PhoneNumbers, ok := app.parsePhoneNumbers(c, Payload.PhoneNumbers)
+	if !ok {
 		return
 	}
 
-	User.PhoneNumbers = *jsonPhoneNumbers
+	User.PhoneNumbers = PhoneNumbers
 
 	// Password hash generation.
-	hash, err := bcrypt.GenerateFromPassword([]byte(Payload.Password), app.HashCost)
-	User.PasswordHash = string(hash)
+	hash, err := app.Passwords.Hash(Payload.Password)
+	User.PasswordHash = hash
 	if err != nil {
 		// If there was an error during hash creation - terminate immediately.
 		log.Fatal("[CreateUser] Error while generating hash in user creation. Terminating.")
@@ -146,6 +217,9 @@ func (app *App) CreateUser(c *gin.Context) {
 	// Create user object in database.
 	app.DB.Create(&User)
 
+	// Ask user to verify the supplied mail address.
+	go app.sendVerificationMail(User)
+
 	model := CopyNestedModel(User, fieldsUser)
 
 	c.JSON(http.StatusOK, model)
@@ -153,7 +227,10 @@ func (app *App) CreateUser(c *gin.Context) {
 
 // This function is not thought be used as handler, it updates a given user
 // object with no permission checking. Used by UpdateMe and UpdateUser.
-func (app *App) UpdateUserObject(User *db.User, c *gin.Context, updateGroups bool) {
+// Actor is the user performing the update and recorded in our audit trail.
+func (app *App) UpdateUserObject(actor *db.User, User *db.User, c *gin.Context, updateGroups bool) {
+
+	before := CopyNestedModel(*User, fieldsUser)
 
 	var Payload UpdateUserPayload
 
@@ -191,15 +268,15 @@ func (app *App) UpdateUserObject(User *db.User, c *gin.Context, updateGroups boo
 
 	if Payload.Password != "" {
 
-		passwordPayload := PasswordPayload{Payload.Password}
-		errs, isErr = app.Validator.Struct(&passwordPayload).(validator.ValidationErrors)
-		if isErr {
-			CheckErrors(errs, c)
+		// Check password against the user's name and mail
+		// address as they will be after this update.
+		context := []string{User.Name, User.PreferredName, User.Mail, Payload.Name, Payload.PreferredName, Payload.Mail}
+		if ok := app.checkPasswordPolicy(c, Payload.Password, context...); !ok {
 			return
 		}
 
-		hash, hashErr := bcrypt.GenerateFromPassword([]byte(Payload.Password), app.HashCost)
-		updatedUser.PasswordHash = string(hash)
+		hash, hashErr := app.Passwords.Hash(Payload.Password)
+		updatedUser.PasswordHash = hash
 		if hashErr != nil {
 			// If there was an error during hash creation - terminate immediately.
 			log.Fatal("[UpdateUserObject] Error while generating hash in user creation. Terminating.")
@@ -209,27 +286,35 @@ func (app *App) UpdateUserObject(User *db.User, c *gin.Context, updateGroups boo
 	updatedUser.Name = Payload.Name
 	updatedUser.PreferredName = Payload.PreferredName
 	updatedUser.Mail = Payload.Mail
-	updatedUser.MailVerified = false
 
 	if len(Payload.PhoneNumbers) > 0 {
 
-		jsonPhoneNumbers := new(db.PhoneNumbers)
-		err = jsonPhoneNumbers.Scan(Payload.PhoneNumbers)
-		if err != nil {
-
-			// Signal client that the supplied phone numbers contained some kind of error.
-			c.JSON(http.StatusBadRequest, gin.H{
-				"PhoneNumbers": "Are not valid",
-			})
-
+		PhoneNumbers, ok := app.parsePhoneNumbers(c, Payload.PhoneNumbers)
+		if !ok {
 			return
 		}
 
-		updatedUser.PhoneNumbers = *jsonPhoneNumbers
+		updatedUser.PhoneNumbers = PhoneNumbers
 	}
 
+	// Remember whether the mail address is about to change.
+	mailChanged := (Payload.Mail != "") && (Payload.Mail != User.Mail)
+
 	// Update user.
 	app.DB.Model(&User).Updates(updatedUser)
+	app.Principals.Invalidate(User.ID)
+
+	if mailChanged {
+
+		// A changed mail address has to be verified again. Update
+		// explicitly because Updates() skips zero values like false.
+		app.DB.Model(&User).Update("mail_verified", false)
+
+		var changedUser db.User
+		app.DB.First(&changedUser, "id = ?", User.ID)
+
+		go app.sendVerificationMail(changedUser)
+	}
 
 	if len(Payload.Groups) > 0 && updateGroups {
 
@@ -255,12 +340,44 @@ func (app *App) UpdateUserObject(User *db.User, c *gin.Context, updateGroups boo
 			updatedUser.Groups[i] = group
 		}
 
+		tx := app.DB.Begin()
+
+		// Dropping the system admin groups of the last system
+		// admin is refused, like demoting them.
+		_, systemAdminGroupIDs := lockSystemAdminGroups(tx)
+
+		keepsSystemAdminGroup := false
+		for _, group := range updatedUser.Groups {
+
+			for _, groupID := range systemAdminGroupIDs {
+
+				if group.ID == groupID {
+					keepsSystemAdminGroup = true
+				}
+			}
+		}
+
+		var CountSystemAdminGroups int
+		if len(systemAdminGroupIDs) > 0 {
+			tx.Table("user_groups").Where("\"group_id\" IN (?) AND \"user_id\" = ?", systemAdminGroupIDs, User.ID).Count(&CountSystemAdminGroups)
+		}
+
+		if CountSystemAdminGroups > 0 && !keepsSystemAdminGroup {
+
+			if ok := keepsSystemAdmin(c, tx, systemAdminGroupIDs, User.ID); !ok {
+				return
+			}
+		}
+
 		// Delete all prior groups.
-		app.DB.Exec("DELETE FROM user_groups WHERE user_id = ?", updatedUser.ID)
+		tx.Exec("DELETE FROM user_groups WHERE user_id = ?", updatedUser.ID)
 		//app.DB.Delete(&User.Groups)
 		// Save all current groups
 		//app.DB.Save(&updatedUser.Groups)
-		app.DB.Model(&User).Updates(updatedUser)
+		tx.Model(&User).Updates(updatedUser)
+		tx.Commit()
+
+		app.Principals.Invalidate(User.ID)
 	}
 
 	// Return updated user.
@@ -275,9 +392,156 @@ func (app *App) UpdateUserObject(User *db.User, c *gin.Context, updateGroups boo
 	// Marshal only required fields.
 	model := CopyNestedModel(checkUser, fieldsUser)
 
-	c.JSON(http.StatusOK, model)
+	app.audit(app.DB, c, actor, db.AuditUserUpdate, "user", checkUser.ID, "", before, model)
+
+	c.JSON(http.StatusOK, app.protectContacts(actor, model))
+}
+
+// Applies search, filters, sorting and cursor supplied as query
+// parameters to a query on users and loads one page of matching
+// users with their groups. If more users follow, the cursor to
+// the next page is sent in header X-Next-Cursor. On invalid
+// parameters writes an error response and returns false.
+func (app *App) findUsers(c *gin.Context, query *gorm.DB) ([]db.User, bool) {
+
+	if search := strings.ToLower(strings.TrimSpace(c.Query("q"))); search != "" {
+
+		// Mail addresses are only found by the full address, so that
+		// masked addresses can not be guessed character by character.
+		pattern := "%" + likeEscaper.Replace(search) + "%"
+		query = query.Where("(LOWER(\"name\") LIKE ? OR LOWER(\"preferred_name\") LIKE ? OR LOWER(\"mail\") = ?)", pattern, pattern, search)
+	}
+
+	if groupID := c.Query("group"); groupID != "" {
+		query = query.Where("\"id\" IN (SELECT \"user_id\" FROM \"user_groups\" WHERE \"group_id\" = ?)", groupID)
+	}
+
+	flags := map[string]string{
+		"enabled":  "\"enabled\" = ?",
+		"verified": "\"mail_verified\" = ?",
+	}
+
+	for parameter, condition := range flags {
+
+		if value := c.Query(parameter); value != "" {
+
+			flag, err := strconv.ParseBool(value)
+			if err != nil {
+
+				c.JSON(http.StatusBadRequest, gin.H{
+					parameter: "Needs to be either true or false",
+				})
+
+				return nil, false
+			}
+
+			query = query.Where(condition, flag)
+		}
+	}
+
+	sortParam := c.Query("sort")
+	if sortParam == "" {
+		sortParam = "name"
+	}
+
+	// A leading minus sorts descending.
+	direction, comparison := "ASC", ">"
+	if strings.HasPrefix(sortParam, "-") {
+		direction, comparison = "DESC", "<"
+	}
+
+	column, ok := userSortColumns[strings.TrimPrefix(sortParam, "-")]
+	if !ok {
+
+		c.JSON(http.StatusBadRequest, gin.H{
+			"sort": "Needs to be one of name, mail, -name or -mail",
+		})
+
+		return nil, false
+	}
+
+	// Cursors point behind the last user of the previous page.
+	// The ID breaks ties between users with equal values.
+	if cursor := c.Query("cursor"); cursor != "" {
+
+		cursorSort, id, ok := decodeUserCursor(cursor)
+		if !ok || cursorSort != sortParam {
+
+			c.JSON(http.StatusBadRequest, gin.H{
+				"cursor": "Is invalid or does not match sort",
+			})
+
+			return nil, false
+		}
+
+		query = query.Where(fmt.Sprintf("(\"%s\", \"id\") %s (SELECT \"%s\", \"id\" FROM \"users\" WHERE \"id\" = ?)", column, comparison, column), id)
+	}
+
+	limit := 100
+
+	if limitParam := c.Query("limit"); limitParam != "" {
+
+		var err error
+		limit, err = strconv.Atoi(limitParam)
+		if err != nil || limit < 1 || limit > 1000 {
+
+			c.JSON(http.StatusBadRequest, gin.H{
+				"limit": "Needs to be a number between 1 and 1000",
+			})
+
+			return nil, false
+		}
+	}
+
+	// Load one more user than requested to know if another page follows.
+	Users := []db.User{}
+	query.Preload("Groups").Order(fmt.Sprintf("\"%s\" %s, \"id\" %s", column, direction, direction)).Limit((limit + 1)).Find(&Users)
+
+	if len(Users) > limit {
+
+		Users = Users[:limit]
+
+		c.Header("X-Next-Cursor", encodeUserCursor(sortParam, Users[(limit-1)].ID))
+	}
+
+	for userLoop := range Users {
+
+		for groupLoop := range Users[userLoop].Groups {
+			app.DB.Model(&Users[userLoop].Groups[groupLoop]).Related(&Users[userLoop].Groups[groupLoop].Region)
+		}
+	}
+
+	return Users, true
 }
 
+// Cursors are opaque to clients, but only carry the sort and
+// the ID of the last listed user. They do not carry its sorted
+// value, which could be a mail address the client may not see.
+func encodeUserCursor(sort string, id string) string {
+
+	raw, _ := json.Marshal([]string{sort, id})
+
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeUserCursor(cursor string) (sort string, id string, ok bool) {
+
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", "", false
+	}
+
+	var parts []string
+	if err := json.Unmarshal(raw, &parts); err != nil || len(parts) != 2 {
+		return "", "", false
+	}
+
+	return parts[0], parts[1], true
+}
+
+// Lists users page by page, see findUsers for the supported
+// query parameters. Parameter region additionally restricts
+// the listing to users active in that region.
 func (app *App) ListUsers(c *gin.Context) {
 
 	// Check authorization for this function.
@@ -292,7 +556,7 @@ func (app *App) ListUsers(c *gin.Context) {
 	}
 
 	// Check if user permissions are sufficient (user is admin).
-	if ok := app.CheckScope(User, db.Region{}, "superadmin"); !ok {
+	if ok := app.CheckScope(User, db.Region{}, db.PermissionUserRead); !ok {
 
 		// Signal client that the provided authorization was not sufficient.
 		c.Header("WWW-Authenticate", "Bearer realm=\"CaTUstrophy\", error=\"authentication_failed\", error_description=\"Could not authenticate the request\"")
@@ -301,18 +565,19 @@ func (app *App) ListUsers(c *gin.Context) {
 		return
 	}
 
-	// Load all groups for an user.
-	var Users []db.User
-	app.DB.Preload("Groups").Find(&Users)
+	query := app.DB.Model(&db.User{})
 
-	for userLoop, _ := range Users {
+	if regionID := c.Query("region"); regionID != "" {
+		query = query.Where(usersActiveInRegion, regionID, regionID, regionID)
+	}
 
-		for groupLoop, _ := range Users[userLoop].Groups {
-			app.DB.Model(&Users[userLoop].Groups[groupLoop]).Related(&Users[userLoop].Groups[groupLoop].Region)
-		}
+	Users, ok := app.findUsers(c, query)
+	if !ok {
+		return
 	}
 
-	model := CopyNestedModel(Users, fieldsUser)
+	// Admins see contact details only after revealing them.
+	model := app.protectContacts(User, CopyNestedModel(Users, fieldsUser))
 
 	c.JSON(http.StatusOK, model)
 }
@@ -331,7 +596,7 @@ func (app *App) GetUser(c *gin.Context) {
 	}
 
 	// Check if user permissions are sufficient (user is admin).
-	if ok := app.CheckScope(User, db.Region{}, "superadmin"); !ok {
+	if ok := app.CheckScope(User, db.Region{}, db.PermissionUserRead); !ok {
 
 		// Signal client that the provided authorization was not sufficient.
 		c.Header("WWW-Authenticate", "Bearer realm=\"CaTUstrophy\", error=\"authentication_failed\", error_description=\"Could not authenticate the request\"")
@@ -352,7 +617,10 @@ func (app *App) GetUser(c *gin.Context) {
 		app.DB.Model(&requestUser.Groups[groupLoop]).Related(&requestUser.Groups[groupLoop].Region)
 	}
 
-	model := CopyNestedModel(requestUser, fieldsUser)
+	model := CopyNestedModel(requestUser, fieldsUser).(map[string]interface{})
+	model["Reputation"] = app.reputation(requestUser.ID)
+
+	app.protectContacts(User, model)
 
 	c.JSON(http.StatusOK, model)
 }
@@ -371,7 +639,7 @@ func (app *App) UpdateUser(c *gin.Context) {
 	}
 
 	// Check if user permissions are sufficient (user is admin).
-	if ok := app.CheckScope(User, db.Region{}, "superadmin"); !ok {
+	if ok := app.CheckScope(User, db.Region{}, db.PermissionUserUpdate); !ok {
 
 		// Signal client that the provided authorization was not sufficient.
 		c.Header("WWW-Authenticate", "Bearer realm=\"CaTUstrophy\", error=\"authentication_failed\", error_description=\"Could not authenticate the request\"")
@@ -401,7 +669,7 @@ func (app *App) UpdateUser(c *gin.Context) {
 		app.DB.Model(&updateUser.Groups[groupLoop]).Related(&updateUser.Groups[groupLoop].Region)
 	}
 
-	if app.CheckScope(&updateUser, db.Region{}, "superadmin") && updateUser.ID != User.ID {
+	if app.HasPermission(&updateUser, db.Region{}, db.PermissionUserUpdate) && updateUser.ID != User.ID {
 
 		c.JSON(http.StatusForbidden, gin.H{
 			"Error": "You tried to update a system admin. But as you are equal bosses, you have to respect that your power is limited where the power of the other boss starts.",
@@ -410,5 +678,154 @@ func (app *App) UpdateUser(c *gin.Context) {
 		return
 	}
 
-	app.UpdateUserObject(&updateUser, c, true)
+	app.UpdateUserObject(User, &updateUser, c, true)
+}
+
+// This function is not thought be used as handler, it suspends or
+// re-enables a given user with no permission checking.
+// Used by the suspension endpoints for system and region admins,
+// the latter pass their region for our audit trail.
+func (app *App) SetUserSuspension(actor *db.User, User *db.User, region db.Region, c *gin.Context, suspend bool) {
+
+	if suspend {
+
+		var Payload SuspensionPayload
+
+		// Expect reason for suspension in JSON request body.
+		if ok := app.ValidatePayloadShort(c, &Payload); !ok {
+			return
+		}
+
+		// Disable user and revoke all sessions, JWTs and refresh
+		// tokens so that the suspension applies immediately.
+		app.DB.Model(User).Updates(map[string]interface{}{
+			"enabled":             false,
+			"suspension_reason":   Payload.Reason,
+			"sessions_revoked_at": time.Now(),
+		})
+		app.DB.Model(&db.Session{}).Where("\"user_id\" = ?", User.ID).Update("revoked", true)
+		app.DB.Model(&db.RefreshToken{}).Where("\"user_id\" = ?", User.ID).Update("revoked", true)
+	} else {
+
+		app.DB.Model(User).Updates(map[string]interface{}{
+			"enabled":           true,
+			"suspension_reason": "",
+		})
+	}
+
+	app.Principals.Invalidate(User.ID)
+
+	action := db.AuditUserEnable
+	if suspend {
+		action = db.AuditUserSuspend
+	}
+
+	app.audit(app.DB, c, actor, action, "user", User.ID, region.ID, gin.H{"Enabled": User.Enabled}, gin.H{"Enabled": !suspend})
+
+	// Offers and requests of this user appear or disappear in
+	// recommendations, so these have to be recalculated.
+	app.outdateRecommendationsOfUser(app.DB, User.ID)
+
+	// Return updated user.
+	var checkUser db.User
+	app.DB.Preload("Groups").First(&checkUser, "id = ?", User.ID)
+
+	for i, _ := range checkUser.Groups {
+		app.DB.Model(&checkUser.Groups[i]).Related(&checkUser.Groups[i].Region)
+	}
+
+	model := app.protectContacts(actor, CopyNestedModel(checkUser, fieldsUser))
+
+	c.JSON(http.StatusOK, model)
+}
+
+// Marks recommendations of all regions supplied user has
+// offers or requests in as outdated, so they get recalculated.
+func (app *App) outdateRecommendationsOfUser(database *gorm.DB, userID string) {
+	database.Model(&db.Region{}).Where("\"id\" IN (SELECT \"region_id\" FROM \"region_offers\" WHERE \"offer_id\" IN (SELECT \"id\" FROM \"offers\" WHERE \"user_id\" = ?)) OR \"id\" IN (SELECT \"region_id\" FROM \"region_requests\" WHERE \"request_id\" IN (SELECT \"id\" FROM \"requests\" WHERE \"user_id\" = ?))", userID, userID).Update("recommendation_updated", false)
+}
+
+// Loads the user referenced in request URL for suspension
+// related endpoints. On fail writes an error response.
+func (app *App) getSuspensionUser(c *gin.Context, User *db.User) *db.User {
+
+	userID := app.getUUID(c, "userID")
+	if userID == "" {
+		return nil
+	}
+
+	var suspendUser db.User
+	app.DB.Preload("Groups").First(&suspendUser, "id = ?", userID)
+
+	if suspendUser.ID == "" {
+
+		c.JSON(http.StatusNotFound, gin.H{
+			"User": "The user you tried to suspend or enable does not exist.",
+		})
+
+		return nil
+	}
+
+	if suspendUser.ID == User.ID {
+
+		c.JSON(http.StatusForbidden, gin.H{
+			"Error": "You can not suspend or enable yourself.",
+		})
+
+		return nil
+	}
+
+	if suspendUser.Deleted {
+
+		c.JSON(http.StatusBadRequest, gin.H{
+			"Error": "You tried to suspend or enable a deleted user.",
+		})
+
+		return nil
+	}
+
+	if app.HasPermission(&suspendUser, db.Region{}, db.PermissionUserSuspend) {
+
+		c.JSON(http.StatusForbidden, gin.H{
+			"Error": "You tried to suspend or enable a system admin. Revoke the system admin rights first.",
+		})
+
+		return nil
+	}
+
+	return &suspendUser
+}
+
+func (app *App) suspendOrEnableUser(c *gin.Context, suspend bool) {
+
+	// Check authorization for this function.
+	User := app.AuthorizeShort(c)
+	if User == nil {
+		return
+	}
+
+	// Check if user permissions are sufficient (user is admin).
+	if ok := app.CheckScope(User, db.Region{}, db.PermissionUserSuspend); !ok {
+
+		// Signal client that the provided authorization was not sufficient.
+		c.Header("WWW-Authenticate", "Bearer realm=\"CaTUstrophy\", error=\"authentication_failed\", error_description=\"Could not authenticate the request\"")
+		c.Status(http.StatusUnauthorized)
+
+		return
+	}
+
+	suspendUser := app.getSuspensionUser(c, User)
+	if suspendUser == nil {
+		return
+	}
+
+	app.SetUserSuspension(User, suspendUser, db.Region{}, c, suspend)
+}
+
+func (app *App) SuspendUser(c *gin.Context) {
+	app.suspendOrEnableUser(c, true)
+}
+
+func (app *App) EnableUser(c *gin.Context) {
+	app.suspendOrEnableUser(c, false)
 }
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"net/http"
+
+	"github.com/caTUstrophy/backend/db"
+	"github.com/gin-gonic/gin"
+)
+
+// Structs
+
+type VerificationPayload struct {
+	Token string `conform:"trim" validate:"required"`
+}
+
+// Functions
+
+// Creates a new mail verification token for supplied user
+// and sends a mail containing the verification link to the
+// user's current mail address.
+func (app *App) sendVerificationMail(user db.User) {
+
+	token, expiresAt := app.makeOneTimeToken(user, db.OneTimeTokenMailVerification, app.VerifyValidFor)
+
+	link := fmt.Sprintf("%s/verify?token=%s", app.FrontendURL, token)
+	body := fmt.Sprintf("Hello %s,\n\nplease confirm your mail address for CaTUstrophy by opening the following link:\n\n%s\n\nThe link is valid until %s. If you did not register at CaTUstrophy, you can ignore this mail.\n", user.Name, link, expiresAt.Format(time.RFC1123))
+
+	err := app.Mailer.Send(user.Mail, "Please verify your mail address", body)
+	if err != nil {
+		log.Printf("[sendVerificationMail] Sending verification mail to user %s failed: %s\n", user.ID, err)
+	}
+}
+
+// Checks if supplied user is allowed to create offers and
+// requests with respect to the mail verification setting.
+// On fail writes a forbidden response.
+func (app *App) CheckMailVerified(user *db.User, c *gin.Context) bool {
+
+	if !app.RequireVerifiedMail || user.MailVerified {
+		return true
+	}
+
+	c.JSON(http.StatusForbidden, gin.H{
+		"Mail": "Has to be verified first",
+	})
+
+	return false
+}
+
+func (app *App) RequestVerification(c *gin.Context) {
+
+	// Check authorization for this function.
+	User := app.AuthorizeShort(c)
+	if User == nil {
+		return
+	}
+
+	if User.MailVerified {
+
+		c.JSON(http.StatusBadRequest, gin.H{
+			"Mail": "Is already verified",
+		})
+
+		return
+	}
+
+	// Send a fresh verification link to the user.
+	go app.sendVerificationMail(*User)
+
+	c.JSON(http.StatusOK, gin.H{
+		"Mail": User.Mail,
+	})
+}
+
+func (app *App) ConfirmVerification(c *gin.Context) {
+
+	var Payload VerificationPayload
+
+	// Expect verification token in JSON request body.
+	if ok := app.ValidatePayloadShort(c, &Payload); !ok {
+		return
+	}
+
+	// Check token and mark it as used.
+	User := app.useOneTimeToken(Payload.Token, db.OneTimeTokenMailVerification)
+	if User == nil {
+
+		c.JSON(http.StatusBadRequest, gin.H{
+			"Token": "Is invalid or expired",
+		})
+
+		return
+	}
+
+	// The mail address of this user is verified now.
+	app.DB.Model(User).Update("mail_verified", true)
+	app.Principals.Invalidate(User.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"ID":           User.ID,
+		"Mail":         User.Mail,
+		"MailVerified": true,
+	})
+}
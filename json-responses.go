@@ -1,12 +1,17 @@
 package main
 
 var fieldsUser = map[string]interface{}{
-	"ID":            "ID",
-	"Name":          "Name",
-	"PreferredName": "PreferredName",
-	"Mail":          "Mail",
-	"MailVerified":  "MailVerified",
-	"PhoneNumbers":  "PhoneNumbers",
+	"ID":               "ID",
+	"Name":             "Name",
+	"PreferredName":    "PreferredName",
+	"Mail":             "Mail",
+	"MailVerified":     "MailVerified",
+	"PhoneNumbers":     "PhoneNumbers",
+	"Enabled":          "Enabled",
+	"SuspensionReason": "SuspensionReason",
+	"ServiceAccount":   "ServiceAccount",
+	"TOTPEnabled":      "TwoFactorEnabled",
+	"Deleted":          "Deleted",
 	"Groups": map[string]interface{}{
 		"ID": "ID",
 		"Region": map[string]interface{}{
@@ -19,6 +24,36 @@ var fieldsUser = map[string]interface{}{
 	},
 }
 
+var fieldsAPIKey = map[string]interface{}{
+	"ID":         "ID",
+	"Name":       "Name",
+	"Prefix":     "Prefix",
+	"CreatedAt":  "CreatedAt",
+	"LastUsedAt": "LastUsedAt",
+	"Revoked":    "Revoked",
+}
+
+var fieldsAuditEntry = map[string]interface{}{
+	"ID":         "ID",
+	"CreatedAt":  "CreatedAt",
+	"RequestID":  "RequestID",
+	"ActorID":    "ActorID",
+	"Action":     "Action",
+	"TargetType": "TargetType",
+	"TargetID":   "TargetID",
+	"RegionID":   "RegionID",
+	"Changes":    "Changes",
+}
+
+var fieldsSession = map[string]interface{}{
+	"ID":         "ID",
+	"UserAgent":  "UserAgent",
+	"IP":         "IP",
+	"CreatedAt":  "CreatedAt",
+	"LastSeenAt": "LastSeenAt",
+	"ExpiresAt":  "ExpiresAt",
+}
+
 var fieldsRecommendations = map[string]interface{}{
 	"Region":        fieldsRegion,
 	"Request":       fieldsRequest,
@@ -27,6 +62,13 @@ var fieldsRecommendations = map[string]interface{}{
 	"Recommended":   "Recommended",
 }
 
+var fieldsUserContact = map[string]interface{}{
+	"ID":           "ID",
+	"Name":         "Name",
+	"Mail":         "Mail",
+	"PhoneNumbers": "PhoneNumbers",
+}
+
 var fieldsUserNoGroups = map[string]interface{}{
 	"ID":           "ID",
 	"Name":         "Name",
@@ -53,6 +95,19 @@ var fieldsGroup = map[string]interface{}{
 	"Description": "Description",
 }
 
+var fieldsPermission = map[string]interface{}{
+	"Name":        "Name",
+	"Description": "Description",
+}
+
+var fieldsRole = map[string]interface{}{
+	"ID":          "ID",
+	"Name":        "Name",
+	"Description": "Description",
+	"BuiltIn":     "BuiltIn",
+	"Permissions": fieldsPermission,
+}
+
 var fieldsTag = map[string]interface{}{
 	"Name": "Name",
 }
@@ -72,6 +127,7 @@ var fieldsRequestWithUser = map[string]interface{}{
 	"ValidityPeriod": "ValidityPeriod",
 	"Matched":        "Matched",
 	"Expired":        "Expired",
+	"OrganisationID": "OrganisationID",
 	"User": map[string]interface{}{
 		"ID":           "ID",
 		"Name":         "Name",
@@ -95,6 +151,7 @@ var fieldsRequest = map[string]interface{}{
 	"ValidityPeriod": "ValidityPeriod",
 	"Matched":        "Matched",
 	"Expired":        "Expired",
+	"OrganisationID": "OrganisationID",
 }
 
 var fieldsOfferWithUser = map[string]interface{}{
@@ -112,6 +169,8 @@ var fieldsOfferWithUser = map[string]interface{}{
 	"ValidityPeriod": "ValidityPeriod",
 	"Matched":        "Matched",
 	"Expired":        "Expired",
+	"OrganisationID": "OrganisationID",
+	"TrustLevel":     "TrustLevel",
 	"User": map[string]interface{}{
 		"ID":           "ID",
 		"Name":         "Name",
@@ -135,6 +194,7 @@ var fieldsOffer = map[string]interface{}{
 	"ValidityPeriod": "ValidityPeriod",
 	"Matched":        "Matched",
 	"Expired":        "Expired",
+	"OrganisationID": "OrganisationID",
 }
 
 var fieldsRegion = map[string]interface{}{
@@ -150,31 +210,99 @@ var fieldsRegion = map[string]interface{}{
 }
 
 var fieldsMatching = map[string]interface{}{
-	"ID":       "ID",
-	"RegionId": "RegionId",
-	"Request":  fieldsRequestWithUser,
-	"Offer":    fieldsOfferWithUser,
-	"Invalid":  "Invalid",
+	"ID":               "ID",
+	"RegionId":         "RegionId",
+	"Request":          fieldsRequestWithUser,
+	"Offer":            fieldsOfferWithUser,
+	"Invalid":          "Invalid",
+	"OfferConfirmed":   "OfferConfirmed",
+	"RequestConfirmed": "RequestConfirmed",
+	"Completed":        "Completed",
+}
+
+var fieldsOrganisation = map[string]interface{}{
+	"ID":          "ID",
+	"Name":        "Name",
+	"Description": "Description",
+}
+
+var fieldsOrganisationMember = map[string]interface{}{
+	"Role": "Role",
+	"User": map[string]interface{}{
+		"ID":           "ID",
+		"Name":         "Name",
+		"Mail":         "Mail",
+		"PhoneNumbers": "PhoneNumbers",
+	},
+}
+
+var fieldsOrganisationMembership = map[string]interface{}{
+	"OrganisationID": "OrganisationID",
+	"Role":           "Role",
+}
+
+var fieldsTrustGrant = map[string]interface{}{
+	"ID":          "ID",
+	"UserID":      "UserID",
+	"RegionID":    "RegionID",
+	"Level":       "Level",
+	"Note":        "Note",
+	"GrantedByID": "GrantedByID",
+	"CreatedAt":   "CreatedAt",
+	"ExpiresAt":   "ExpiresAt",
+}
+
+var fieldsTrustRequirement = map[string]interface{}{
+	"TagName": "Tag",
+	"Level":   "Level",
+}
+
+var fieldsFeedback = map[string]interface{}{
+	"ID":         "ID",
+	"MatchingID": "MatchingID",
+	"Side":       "Side",
+	"AuthorID":   "AuthorID",
+	"SubjectID":  "SubjectID",
+	"Rating":     "Rating",
+	"Comment":    "Comment",
+	"CreatedAt":  "CreatedAt",
+}
+
+var fieldsInvitation = map[string]interface{}{
+	"ID":           "ID",
+	"Mail":         "Mail",
+	"RegionID":     "RegionID",
+	"GroupID":      "GroupID",
+	"Role":         "Role",
+	"CreatedByID":  "CreatedByID",
+	"CreatedAt":    "CreatedAt",
+	"ExpiresAt":    "ExpiresAt",
+	"AcceptedByID": "AcceptedByID",
+	"AcceptedAt":   "AcceptedAt",
+	"Revoked":      "Revoked",
 }
 
 var fieldsNotificationWithRead = map[string]interface{}{
-	"ID":     "ID",
-	"Type":   "Type",
-	"ItemID": "ItemID",
-	"Read":   "Read",
+	"ID":             "ID",
+	"Type":           "Type",
+	"ItemID":         "ItemID",
+	"OrganisationID": "OrganisationID",
+	"Read":           "Read",
 }
 
 var fieldsNotification = map[string]interface{}{
-	"ID":     "ID",
-	"Type":   "Type",
-	"ItemID": "ItemID",
+	"ID":             "ID",
+	"Type":           "Type",
+	"ItemID":         "ItemID",
+	"OrganisationID": "OrganisationID",
 }
 
 var fieldsNotificationForMatching = map[string]interface{}{
-	"ID":       "ID",
-	"Type":     "Type",
-	"ItemID":   "ItemID",
-	"Matching": fieldsMatching,
+	"ID":             "ID",
+	"Type":           "Type",
+	"ItemID":         "ItemID",
+	"OrganisationID": "OrganisationID",
+	"Matching":       fieldsMatching,
 }
 
 // Other global response schemes, not thought to be used for CopyNestedModel
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math/big"
+	"sync"
+	"time"
+
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+
+	"github.com/caTUstrophy/backend/db"
+	"github.com/jinzhu/gorm"
+	"github.com/satori/go.uuid"
+)
+
+// Constants
+
+// JWTs with an unknown key ID make us look for keys of other
+// instances in the database at most once in this interval.
+const keyringReloadInterval = 10 * time.Second
+
+// Structs
+
+// Holds all keys used to sign and verify our JWTs. The newest
+// active key signs new JWTs, retired keys are kept for verifying
+// until all JWTs signed with them have expired.
+type Keyring struct {
+	mutex       sync.RWMutex
+	db          *gorm.DB
+	current     *rsa.PrivateKey
+	currentID   string
+	currentAt   time.Time
+	public      map[string]*rsa.PublicKey
+	loadedAt    time.Time
+	RotateAfter time.Duration
+	VerifyFor   time.Duration
+}
+
+// Public part of a signing key as JSON Web Key (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// Functions
+
+func NewKeyring(database *gorm.DB, rotateAfter time.Duration, verifyFor time.Duration) *Keyring {
+
+	return &Keyring{
+		db:          database,
+		public:      make(map[string]*rsa.PublicKey),
+		RotateAfter: rotateAfter,
+		VerifyFor:   verifyFor,
+	}
+}
+
+// Loads all keys that can still be used for verification from
+// database. Keys may have been added by other instances of our
+// backend sharing the same database.
+func (keyring *Keyring) Load() {
+
+	var Keys []db.SigningKey
+	keyring.db.Order("\"created_at\" ASC").Find(&Keys, "\"expires_at\" IS NULL OR \"expires_at\" > ?", time.Now())
+
+	public := make(map[string]*rsa.PublicKey)
+	var current *rsa.PrivateKey
+	var currentID string
+	var currentAt time.Time
+
+	for _, Key := range Keys {
+
+		block, _ := pem.Decode([]byte(Key.PrivateKey))
+		if block == nil {
+			log.Printf("[Keyring] Signing key %s could not be decoded. Skipping it.\n", Key.ID)
+			continue
+		}
+
+		privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			log.Printf("[Keyring] Signing key %s could not be parsed: %s. Skipping it.\n", Key.ID, err)
+			continue
+		}
+
+		public[Key.ID] = &privateKey.PublicKey
+
+		// Newest key that is not yet retired signs new JWTs.
+		if Key.RetiredAt == nil {
+			current = privateKey
+			currentID = Key.ID
+			currentAt = Key.CreatedAt
+		}
+	}
+
+	keyring.mutex.Lock()
+	defer keyring.mutex.Unlock()
+
+	keyring.public = public
+	keyring.current = current
+	keyring.currentID = currentID
+	keyring.currentAt = currentAt
+	keyring.loadedAt = time.Now()
+}
+
+// Creates a new signing key and retires all previous ones.
+// Retired keys stay available for verification as long as
+// JWTs signed with them might still be valid.
+func (keyring *Keyring) Rotate() {
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		log.Fatalf("[Keyring] Generating signing key went wrong: %s.\nTerminating.", err)
+	}
+
+	nowTime := time.Now()
+	expiresAt := nowTime.Add(keyring.VerifyFor)
+
+	// Retire all currently active keys.
+	keyring.db.Model(&db.SigningKey{}).Where("\"retired_at\" IS NULL").Updates(map[string]interface{}{
+		"retired_at": nowTime,
+		"expires_at": expiresAt,
+	})
+
+	Key := db.SigningKey{
+		ID:         fmt.Sprintf("%s", uuid.NewV4()),
+		Algorithm:  "RS256",
+		PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)})),
+		CreatedAt:  nowTime,
+	}
+	keyring.db.Create(&Key)
+
+	log.Printf("[Keyring] Rotated JWT signing key, new key ID is %s.\n", Key.ID)
+
+	keyring.Load()
+}
+
+// Returns the key ID and private key to sign new JWTs with.
+func (keyring *Keyring) Current() (string, *rsa.PrivateKey) {
+
+	keyring.mutex.RLock()
+	defer keyring.mutex.RUnlock()
+
+	return keyring.currentID, keyring.current
+}
+
+// Returns the public key to verify JWTs signed with key ID kid.
+// An unknown key may have just been created by another instance,
+// so keys are reloaded from database, but not too often, as
+// anyone can send JWTs with made up key IDs.
+func (keyring *Keyring) PublicKey(kid string) (*rsa.PublicKey, bool) {
+
+	keyring.mutex.RLock()
+	publicKey, ok := keyring.public[kid]
+	keyring.mutex.RUnlock()
+
+	if ok || kid == "" {
+		return publicKey, ok
+	}
+
+	// Only one caller per interval gets to reload.
+	keyring.mutex.Lock()
+	reload := time.Since(keyring.loadedAt) > keyringReloadInterval
+	if reload {
+		keyring.loadedAt = time.Now()
+	}
+	keyring.mutex.Unlock()
+
+	if !reload {
+		return nil, false
+	}
+
+	keyring.Load()
+
+	keyring.mutex.RLock()
+	defer keyring.mutex.RUnlock()
+
+	publicKey, ok = keyring.public[kid]
+
+	return publicKey, ok
+}
+
+// Returns all public keys that are valid for verification.
+func (keyring *Keyring) JWKs() []JWK {
+
+	keyring.mutex.RLock()
+	defer keyring.mutex.RUnlock()
+
+	keys := make([]JWK, 0, len(keyring.public))
+
+	for kid, publicKey := range keyring.public {
+
+		keys = append(keys, JWK{
+			Kty: "RSA",
+			Use: "sig",
+			Alg: "RS256",
+			Kid: kid,
+			N:   base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes()),
+		})
+	}
+
+	return keys
+}
+
+// Periodically picks up keys of other instances, rotates the
+// signing key once it is too old and deletes expired keys.
+func (keyring *Keyring) Rotator(sleepOffset time.Duration) {
+
+	for {
+
+		time.Sleep(sleepOffset)
+
+		keyring.Load()
+
+		keyring.mutex.RLock()
+		needsRotation := (keyring.current == nil) || (time.Since(keyring.currentAt) > keyring.RotateAfter)
+		keyring.mutex.RUnlock()
+
+		if needsRotation {
+			keyring.Rotate()
+		}
+
+		// Delete all keys no JWT can be verified with anymore.
+		keyring.db.Where("\"expires_at\" < ?", time.Now()).Delete(&db.SigningKey{})
+	}
+}
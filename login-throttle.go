@@ -0,0 +1,174 @@
+package main
+
+import (
+	"log"
+	"math"
+	"sync"
+	"time"
+)
+
+// Structs
+
+// Keeps track of failed login attempts per mail address
+// and per client IP in memory. After too many failures
+// within the attempts window, the affected key is locked
+// for a time that doubles with every further lockout.
+type LoginThrottle struct {
+	mutex          sync.Mutex
+	entries        map[string]*LoginAttempts
+	MaxMailFails   int
+	MaxIPFails     int
+	AttemptsWindow time.Duration
+	BaseLockout    time.Duration
+	MaxLockout     time.Duration
+}
+
+type LoginAttempts struct {
+	Type        string
+	Value       string
+	Failures    int
+	Lockouts    int
+	LastFailure time.Time
+	LockedUntil time.Time
+}
+
+// Functions
+
+func NewLoginThrottle(maxMailFails int, maxIPFails int, attemptsWindow time.Duration, baseLockout time.Duration, maxLockout time.Duration) *LoginThrottle {
+
+	return &LoginThrottle{
+		entries:        make(map[string]*LoginAttempts),
+		MaxMailFails:   maxMailFails,
+		MaxIPFails:     maxIPFails,
+		AttemptsWindow: attemptsWindow,
+		BaseLockout:    baseLockout,
+		MaxLockout:     maxLockout,
+	}
+}
+
+// Returns the time the caller has to wait before another
+// login attempt for supplied mail and IP will be accepted.
+// Zero means that a login attempt may be made right now.
+func (throttle *LoginThrottle) RetryAfter(mail string, ip string) time.Duration {
+
+	throttle.mutex.Lock()
+	defer throttle.mutex.Unlock()
+
+	nowTime := time.Now()
+	var wait time.Duration
+
+	for _, key := range []string{("Mail:" + mail), ("IP:" + ip)} {
+
+		if entry, ok := throttle.entries[key]; ok && entry.LockedUntil.After(nowTime) {
+
+			if entryWait := entry.LockedUntil.Sub(nowTime); entryWait > wait {
+				wait = entryWait
+			}
+		}
+	}
+
+	return wait
+}
+
+// Counts a failed login attempt for supplied mail and IP.
+func (throttle *LoginThrottle) Fail(mail string, ip string) {
+
+	throttle.mutex.Lock()
+	defer throttle.mutex.Unlock()
+
+	throttle.fail("Mail", mail, throttle.MaxMailFails)
+	throttle.fail("IP", ip, throttle.MaxIPFails)
+}
+
+// Forgets previous failures of supplied mail after a successful
+// login. Failures of the IP are kept on purpose, otherwise an
+// attacker could reset them by logging into an own account.
+func (throttle *LoginThrottle) Succeed(mail string) {
+
+	throttle.mutex.Lock()
+	defer throttle.mutex.Unlock()
+
+	delete(throttle.entries, ("Mail:" + mail))
+}
+
+// Must be called with locked mutex.
+func (throttle *LoginThrottle) fail(keyType string, value string, maxFails int) {
+
+	nowTime := time.Now()
+	key := keyType + ":" + value
+
+	entry, ok := throttle.entries[key]
+	if !ok {
+		entry = &LoginAttempts{
+			Type:  keyType,
+			Value: value,
+		}
+		throttle.entries[key] = entry
+	}
+
+	// Failures that lie too far in the past are not counted anymore.
+	if nowTime.Sub(entry.LastFailure) > throttle.AttemptsWindow {
+		entry.Failures = 0
+	}
+
+	entry.Failures++
+	entry.LastFailure = nowTime
+
+	if entry.Failures >= maxFails {
+
+		// Lock key for a progressively longer time, limited by maximum.
+		lockout := time.Duration(float64(throttle.BaseLockout) * math.Pow(2, float64(entry.Lockouts)))
+		if lockout > throttle.MaxLockout || lockout <= 0 {
+			lockout = throttle.MaxLockout
+		}
+
+		entry.LockedUntil = nowTime.Add(lockout)
+		entry.Lockouts++
+		entry.Failures = 0
+
+		log.Printf("[LoginThrottle] Locked %s %s for %s after too many failed login attempts.\n", keyType, value, lockout.String())
+	}
+}
+
+// Returns copies of all entries that are currently locked.
+func (throttle *LoginThrottle) Locked() []LoginAttempts {
+
+	throttle.mutex.Lock()
+	defer throttle.mutex.Unlock()
+
+	nowTime := time.Now()
+	locked := make([]LoginAttempts, 0)
+
+	for _, entry := range throttle.entries {
+
+		if entry.LockedUntil.After(nowTime) {
+			locked = append(locked, *entry)
+		}
+	}
+
+	return locked
+}
+
+// Periodically removes entries that are neither locked nor had
+// a failure within the maximum lockout time, so that memory
+// consumption stays bounded.
+func (throttle *LoginThrottle) Reaper(sleepOffset time.Duration) {
+
+	for {
+
+		throttle.mutex.Lock()
+
+		nowTime := time.Now()
+
+		for key, entry := range throttle.entries {
+
+			if entry.LockedUntil.Before(nowTime) && (nowTime.Sub(entry.LastFailure) > throttle.MaxLockout) {
+				delete(throttle.entries, key)
+			}
+		}
+
+		throttle.mutex.Unlock()
+
+		time.Sleep(sleepOffset)
+	}
+}
@@ -0,0 +1,49 @@
+package mail
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Structs
+
+// Writes every mail as a file into an outbox directory
+// instead of delivering it. Meant for local development
+// and testing, never use this on a production system.
+type OutboxSender struct {
+	Dir  string
+	From string
+}
+
+// Functions
+
+func (o *OutboxSender) Send(to string, subject string, body string) error {
+
+	message := buildMessage(o.From, to, subject, body)
+
+	// Remove characters from recipient that might cause trouble in file names.
+	recipient := strings.Map(func(r rune) rune {
+
+		if r == '/' || r == '\\' || r == ':' {
+			return '_'
+		}
+
+		return r
+	}, to)
+
+	fileName := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), recipient)
+
+	return ioutil.WriteFile(filepath.Join(o.Dir, fileName), message, 0600)
+}
+
+// Assembles a minimal plain text mail including headers.
+func buildMessage(from string, to string, subject string, body string) []byte {
+
+	message := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nMIME-Version: 1.0\r\nContent-Type: text/plain; charset=\"utf-8\"\r\n\r\n%s\r\n",
+		from, to, subject, time.Now().Format(time.RFC1123Z), body)
+
+	return []byte(message)
+}
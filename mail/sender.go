@@ -0,0 +1,58 @@
+package mail
+
+import (
+	"log"
+	"os"
+	"strconv"
+)
+
+// Structs
+
+// Every way of delivering mails to users of our
+// system has to implement this interface.
+type Sender interface {
+	Send(to string, subject string, body string) error
+}
+
+// Functions
+
+// Create the mail sender configured in environment file.
+func InitSender() Sender {
+
+	// Fetch from environment how mails should be delivered.
+	senderType := os.Getenv("MAIL_SENDER")
+
+	if senderType == "smtp" {
+
+		port, err := strconv.Atoi(os.Getenv("SMTP_PORT"))
+		if err != nil {
+			log.Fatal("[InitSender] Unrecognized SMTP port type in .env file. Integer expected.")
+		}
+
+		return &SMTPSender{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     port,
+			User:     os.Getenv("SMTP_USER"),
+			Password: os.Getenv("SMTP_PW"),
+			From:     os.Getenv("MAIL_FROM"),
+		}
+	} else if senderType == "outbox" {
+
+		dir := os.Getenv("MAIL_OUTBOX_DIR")
+
+		// Make sure outbox directory exists.
+		err := os.MkdirAll(dir, 0700)
+		if err != nil {
+			log.Fatalf("[InitSender] Could not create mail outbox directory: %s", err)
+		}
+
+		return &OutboxSender{
+			Dir:  dir,
+			From: os.Getenv("MAIL_FROM"),
+		}
+	}
+
+	log.Fatal("[InitSender] Unsupported mail sender type in environment file, please use 'smtp' or 'outbox'. Did you forget to specify MAIL_SENDER in your .env file?")
+
+	return nil
+}
@@ -0,0 +1,33 @@
+package mail
+
+import (
+	"fmt"
+	"net/smtp"
+)
+
+// Structs
+
+// Delivers mails via an SMTP server.
+type SMTPSender struct {
+	Host     string
+	Port     int
+	User     string
+	Password string
+	From     string
+}
+
+// Functions
+
+func (s *SMTPSender) Send(to string, subject string, body string) error {
+
+	var auth smtp.Auth
+
+	// Only authenticate if credentials were configured.
+	if s.User != "" {
+		auth = smtp.PlainAuth("", s.User, s.Password, s.Host)
+	}
+
+	message := buildMessage(s.From, to, subject, body)
+
+	return smtp.SendMail(fmt.Sprintf("%s:%d", s.Host, s.Port), auth, s.From, []string{to}, message)
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/caTUstrophy/backend/db"
+	"github.com/caTUstrophy/backend/mail"
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator"
 	"github.com/itsjamie/gin-cors"
@@ -15,18 +16,37 @@ import (
 // Structs
 
 type App struct {
-	IP                string
-	Port              string
-	Router            *gin.Engine
-	DB                *gorm.DB
-	HashCost          int
-	SessionValidFor   time.Duration
-	Validator         *validator.Validate
-	OffReqSleepOffset time.Duration
-	NotifExpOffset    time.Duration
-	NotifSleepOffset  time.Duration
-	TagsWeightAlpha   float64
-	DescWeightBeta    float64
+	IP                  string
+	Port                string
+	Router              *gin.Engine
+	DB                  *gorm.DB
+	Passwords           *PasswordHashing
+	PasswordPolicy      *PasswordPolicy
+	SessionValidFor     time.Duration
+	Validator           *validator.Validate
+	OffReqSleepOffset   time.Duration
+	NotifExpOffset      time.Duration
+	NotifSleepOffset    time.Duration
+	RefreshValidFor     time.Duration
+	TokensSleepOffset   time.Duration
+	Mailer              mail.Sender
+	FrontendURL         string
+	PhoneRegion         string
+	VerifyValidFor      time.Duration
+	ResetValidFor       time.Duration
+	InviteValidFor      time.Duration
+	LoginThrottle       *LoginThrottle
+	Principals          *PrincipalCache
+	Keyring             *Keyring
+	KeysSleepOffset     time.Duration
+	JWTIssuer           string
+	JWTAudience         string
+	JWTEmbedScopes      bool
+	Require2FAForAdmins bool
+	RequireVerifiedMail bool
+	TagsWeightAlpha     float64
+	DescWeightBeta      float64
+	TrustWeightGamma    float64
 }
 
 // Functions
@@ -40,27 +60,53 @@ func InitApp() *App {
 	app.Router.Use(cors.Middleware(cors.Config{
 		Origins:         "*",
 		Methods:         "GET, PUT, POST, DELETE",
-		RequestHeaders:  "Origin, Authorization, Content-Type",
-		ExposedHeaders:  "",
+		RequestHeaders:  "Origin, Authorization, Content-Type, X-API-Key, X-Request-ID",
+		ExposedHeaders:  "X-Request-ID, X-Next-Cursor",
 		MaxAge:          2 * time.Hour,
 		Credentials:     true,
 		ValidateHeaders: false,
 	}))
 
+	// Trace every request through logs and audit trail.
+	app.Router.Use(RequestID())
+
 	// Define our endpoints.
 
 	app.Router.POST("/auth", app.Login)
 	app.Router.GET("/auth", app.RenewToken)
 	app.Router.DELETE("/auth", app.Logout)
+	app.Router.POST("/auth/refresh", app.RefreshToken)
+	app.Router.POST("/auth/2fa", app.LoginSecondFactor)
+	app.Router.GET("/.well-known/jwks.json", app.GetJWKS)
+
+	app.Router.POST("/verification", app.RequestVerification)
+	app.Router.PUT("/verification", app.ConfirmVerification)
+
+	app.Router.POST("/password-reset", app.RequestPasswordReset)
+	app.Router.PUT("/password-reset", app.ConfirmPasswordReset)
+
+	app.Router.PUT("/invitations", app.AcceptInvitation)
 
 	app.Router.POST("/users", app.CreateUser)
 	app.Router.GET("/users", app.ListUsers)
 	app.Router.GET("/users/:userID", app.GetUser)
 	app.Router.PUT("/users/:userID", app.UpdateUser)
+	app.Router.POST("/users/:userID/suspension", app.SuspendUser)
+	app.Router.DELETE("/users/:userID/suspension", app.EnableUser)
 	// This endpoint might change.
 	app.Router.POST("/users/admins", app.PromoteToSystemAdmin)
 
+	app.Router.POST("/service-accounts", app.CreateServiceAccount)
+	app.Router.GET("/service-accounts", app.ListServiceAccounts)
+	app.Router.GET("/service-accounts/:userID/keys", app.ListAPIKeys)
+	app.Router.POST("/service-accounts/:userID/keys", app.CreateAPIKey)
+	app.Router.DELETE("/service-accounts/:userID/keys/:keyID", app.RevokeAPIKey)
+
 	app.Router.GET("/groups", app.GetGroups)
+	app.Router.GET("/permissions", app.ListPermissions)
+	app.Router.GET("/roles", app.ListRoles)
+	app.Router.POST("/roles", app.CreateRole)
+	app.Router.PUT("/roles/:roleID", app.UpdateRole)
 	app.Router.GET("/tags", app.GetTags)
 
 	app.Router.POST("/offers", app.CreateOffer)
@@ -71,9 +117,21 @@ func InitApp() *App {
 	app.Router.GET("/requests/:requestID", app.GetRequest)
 	app.Router.PUT("/requests/:requestID", app.UpdateRequest)
 
+	app.Router.POST("/organisations", app.CreateOrganisation)
+	app.Router.GET("/organisations/:organisationID", app.GetOrganisation)
+	app.Router.PUT("/organisations/:organisationID", app.UpdateOrganisation)
+	app.Router.GET("/organisations/:organisationID/members", app.ListOrganisationMembers)
+	app.Router.POST("/organisations/:organisationID/members", app.SetOrganisationMember)
+	app.Router.DELETE("/organisations/:organisationID/members/:userID", app.RemoveOrganisationMember)
+	app.Router.GET("/organisations/:organisationID/offers", app.ListOrganisationOffers)
+	app.Router.GET("/organisations/:organisationID/requests", app.ListOrganisationRequests)
+
 	app.Router.POST("/matchings", app.CreateMatching)
 	app.Router.GET("/matchings/:matchingID", app.GetMatching)
 	app.Router.PUT("/matchings/:matchingID", app.UpdateMatching)
+	app.Router.PUT("/matchings/:matchingID/completion", app.CompleteMatching)
+	app.Router.GET("/matchings/:matchingID/feedback", app.ListFeedbackForMatching)
+	app.Router.POST("/matchings/:matchingID/feedback", app.CreateFeedback)
 
 	app.Router.POST("/regions", app.CreateRegion)
 	app.Router.GET("/regions", app.ListRegions)
@@ -84,6 +142,26 @@ func InitApp() *App {
 	app.Router.GET("/regions/:regionID/matchings", app.ListMatchingsForRegion)
 	app.Router.GET("/regions/:regionID/admins", app.ListAdminsForRegion)
 	app.Router.POST("/regions/:regionID/admins", app.PromoteToRegionAdmin)
+	app.Router.DELETE("/regions/:regionID/admins/:userID", app.DemoteRegionAdmin)
+	app.Router.POST("/regions/:regionID/roles", app.GrantRoleInRegion)
+	app.Router.POST("/regions/:regionID/organisations", app.GrantRoleToOrganisationInRegion)
+	app.Router.DELETE("/regions/:regionID/roles/:role/users/:userID", app.RevokeRoleInRegion)
+	app.Router.DELETE("/regions/:regionID/roles/:role/organisations/:organisationID", app.RevokeRoleFromOrganisationInRegion)
+	app.Router.GET("/regions/:regionID/invitations", app.ListInvitationsForRegion)
+	app.Router.POST("/regions/:regionID/invitations", app.CreateInvitationInRegion)
+	app.Router.DELETE("/regions/:regionID/invitations/:invitationID", app.RevokeInvitationInRegion)
+	app.Router.GET("/regions/:regionID/audit", app.ListAuditEntriesForRegion)
+	app.Router.GET("/regions/:regionID/users", app.ListUsersInRegion)
+	app.Router.POST("/regions/:regionID/users/:userID/contact", app.RevealContactInRegion)
+	app.Router.POST("/regions/:regionID/users/:userID/suspension", app.SuspendUserInRegion)
+	app.Router.DELETE("/regions/:regionID/users/:userID/suspension", app.EnableUserInRegion)
+	app.Router.PUT("/regions/:regionID/users/:userID/trust", app.GrantTrustInRegion)
+	app.Router.DELETE("/regions/:regionID/users/:userID/trust", app.RevokeTrustInRegion)
+	app.Router.GET("/regions/:regionID/users/:userID/feedback", app.ListFeedbackForUserInRegion)
+	app.Router.GET("/regions/:regionID/flagged-users", app.ListFlaggedUsersInRegion)
+	app.Router.GET("/regions/:regionID/trust", app.ListTrustInRegion)
+	app.Router.GET("/regions/:regionID/trust-requirements", app.ListTrustRequirementsForRegion)
+	app.Router.PUT("/regions/:regionID/trust-requirements", app.SetTrustRequirementInRegion)
 	app.Router.GET("/regions/:regionID/recommendations", app.ListRecommendationsForRegion)
 	app.Router.GET("/regions/:regionID/requests/:requestID/recommendations", app.ListOffersForRequest)
 	app.Router.GET("/regions/:regionID/offers/:offerID/recommendations", app.ListRequestsForOffer)
@@ -91,12 +169,24 @@ func InitApp() *App {
 	// This endpoint might change.
 	app.Router.GET("/system/admins", app.ListSystemAdmins)
 	app.Router.POST("/system/admins", app.PromoteToSystemAdmin)
+	app.Router.DELETE("/system/admins/:userID", app.DemoteSystemAdmin)
+	app.Router.GET("/system/lockouts", app.ListLockouts)
+	app.Router.GET("/audit", app.ListAuditEntries)
 
 	app.Router.GET("/me", app.GetMe)
 	app.Router.PUT("/me", app.UpdateMe)
+	app.Router.DELETE("/me", app.DeleteMe)
+	app.Router.GET("/me/export", app.ExportMe)
 	app.Router.GET("/me/offers", app.ListUserOffers)
 	app.Router.GET("/me/requests", app.ListUserRequests)
 	app.Router.GET("/me/matchings", app.ListUserMatchings)
+	app.Router.GET("/me/organisations", app.ListUserOrganisations)
+	app.Router.GET("/me/sessions", app.ListSessions)
+	app.Router.DELETE("/me/sessions", app.LogoutAll)
+	app.Router.DELETE("/me/sessions/:sessionID", app.DeleteSession)
+	app.Router.POST("/me/2fa", app.StartTwoFactorEnrollment)
+	app.Router.PUT("/me/2fa", app.ConfirmTwoFactorEnrollment)
+	app.Router.DELETE("/me/2fa", app.DisableTwoFactor)
 
 	app.Router.GET("/notifications", app.ListNotifications)
 	app.Router.PUT("/notifications/:notificationID", app.UpdateNotification)
@@ -119,9 +209,25 @@ func main() {
 	go db.OfferRequestReaper(app.DB, "Requests", app.OffReqSleepOffset)
 	log.Printf("\n[main] Dispatched requests reaper with %s sleep time.", app.OffReqSleepOffset.String())
 
+	// Start goroutine that recalculates matching scores once trust levels expire.
+	go app.TrustExpiryReaper(app.OffReqSleepOffset)
+	log.Printf("\n[main] Dispatched trust expiry reaper with %s sleep time.", app.OffReqSleepOffset.String())
+
 	// Start goroutine to delete old notifications.
 	go db.NotificationReaper(app.DB, app.NotifExpOffset, app.NotifSleepOffset)
-	log.Printf("\n[main] Dispatched notification reaper with %s expiry time and %s sleep time.\n\n", app.NotifExpOffset.String(), app.NotifSleepOffset.String())
+	log.Printf("\n[main] Dispatched notification reaper with %s expiry time and %s sleep time.", app.NotifExpOffset.String(), app.NotifSleepOffset.String())
+
+	// Start goroutine to delete expired revocation entries and refresh tokens.
+	go db.TokenReaper(app.DB, app.TokensSleepOffset)
+	log.Printf("\n[main] Dispatched tokens reaper with %s sleep time.", app.TokensSleepOffset.String())
+
+	// Start goroutine to rotate JWT signing keys.
+	go app.Keyring.Rotator(app.KeysSleepOffset)
+	log.Printf("\n[main] Dispatched signing key rotator with %s rotation interval and %s sleep time.", app.Keyring.RotateAfter.String(), app.KeysSleepOffset.String())
+
+	// Start goroutine to forget old failed login attempts.
+	go app.LoginThrottle.Reaper(app.LoginThrottle.AttemptsWindow)
+	log.Printf("\n[main] Dispatched login throttle reaper with %s sleep time.\n\n", app.LoginThrottle.AttemptsWindow.String())
 
 	// Run our application.
 	app.Router.Run(fmt.Sprintf("%s:%s", app.IP, app.Port))
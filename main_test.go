@@ -2,12 +2,18 @@ package main
 
 import (
 	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 
+	"crypto/sha1"
+
 	"github.com/caTUstrophy/backend/db"
+	"github.com/dgrijalva/jwt-go"
 	"github.com/nferruzzi/gormGIS"
 	"github.com/satori/go.uuid"
 )
@@ -224,7 +230,21 @@ func DistanceFactorTest(t *testing.T, request db.Request, offer db.Offer, Assert
 // [X] Login a: N - check if returns JWT
 // [] Authorize : L
 // [] Renew Token : L - check if returns new JWT
-// [] Logout : L -
+// [X] Refresh Token : N - check if refresh tokens are single-use
+// [X] Logout : L - check if JWT is revoked afterwards
+// [X] LogoutAll : L - check if all JWTs are revoked afterwards
+// [X] ListSessions : L - check if the current session is marked
+// [X] DeleteSession : L - check if JWTs of the signed out session are revoked
+// [X] RequestVerification : L - check if verified users are rejected
+// [X] ConfirmVerification : U - check if unknown tokens are rejected
+// [X] RequestPasswordReset : N - check if unknown mails are not revealed
+// [X] ConfirmPasswordReset : N - check if unknown tokens are rejected
+// [X] JWT claims : N - check if standard libraries can validate our JWTs
+// [X] GetJWKS : N - check if public signing keys are published
+// [X] LoginThrottle : N - check if mail and IP are locked after too many failures
+// [X] PrincipalCache : N - check if entries are evicted, invalidated and expire
+// [X] TwoFactor : L - check if enrolled users need a second factor to log in
+// [X] LoginSecondFactor : N - check if unknown challenge tokens are rejected
 
 func LoginTest(t *testing.T, Email string, Password string, AssertCode int) string {
 	loginParams := LoginPayload{
@@ -239,6 +259,22 @@ func LoginTest(t *testing.T, Email string, Password string, AssertCode int) stri
 		return ""
 	}
 
+	// expecting login to be throttled
+	if AssertCode == 429 {
+		if resp.Code != 429 || resp.Header().Get("Retry-After") == "" {
+			t.Error(fmt.Printf("User login should be throttled, but response was %d", resp.Code))
+		}
+		return ""
+	}
+
+	// expecting login to be refused for suspended user
+	if AssertCode == 403 {
+		if resp.Code != 403 {
+			t.Error(fmt.Printf("User login should be forbidden, but response was %d", resp.Code))
+		}
+		return ""
+	}
+
 	// expecting login to fail
 	if AssertCode == 400 {
 		if resp.Code != 400 {
@@ -258,84 +294,1083 @@ func LoginTest(t *testing.T, Email string, Password string, AssertCode int) stri
 	return dat["AccessToken"].(string)
 }
 
-// ----------------------------------------------------------------- USERS
+func LoginRefreshTokenTest(t *testing.T, Email string, Password string) string {
+	loginParams := LoginPayload{
+		Email,
+		Password,
+	}
+	resp := app.Request("POST", "/auth", loginParams)
 
-// [X] CreateUser : U
-// [X] UpdateUser : S
-// [X] ListUsers : A
-// [X] GetUser : A
-// [] PromoteToSystemAdmin : S
+	if resp.Code != 200 {
+		t.Error("User login failed", resp.Body.String())
+		return ""
+	}
 
-func CreateUserTest(t *testing.T, Email string, Password string, Name string, AssertCode int) {
-	// Create User
-	createParams := CreateUserPayload{
-		Name:          Name,
-		PreferredName: Name + " Pref",
-		Mail:          Email,
-		Password:      Password,
-		PhoneNumbers:  make([]string, 1),
+	// check if refresh token exists
+	dat := parseResponse(resp)
+	if dat["RefreshToken"] == nil {
+		t.Error("User Refresh Token is empty")
+		return ""
 	}
-	resp := app.Request("POST", "/users", createParams)
+
+	return dat["RefreshToken"].(string)
+}
+
+func RefreshTokenTest(t *testing.T, RefreshToken string, AssertCode int) string {
+	refreshParams := RefreshPayload{
+		RefreshToken,
+	}
+	resp := app.Request("POST", "/auth/refresh", refreshParams)
 
 	if AssertCode == 200 && resp.Code != 200 {
-		t.Error("User creation failed")
+		t.Error("Refreshing token failed ", resp.Body.String())
+		return ""
+	}
+	if AssertCode == 400 {
+		if resp.Code != 400 {
+			t.Error(fmt.Printf("RefreshToken unexpected response %d", resp.Code))
+		}
+		return ""
 	}
 
-	if AssertCode == 400 && resp.Code != 400 {
-		t.Error("User should already exist")
+	// check if both tokens exist
+	dat := parseResponse(resp)
+	if dat["AccessToken"] == nil || dat["RefreshToken"] == nil {
+		t.Error("RefreshToken did not return a new token pair")
+		return ""
 	}
+
+	return dat["RefreshToken"].(string)
 }
 
-func UpdateUserTest(t *testing.T, jwt string, User string, Name string, PreferredName string, Mail string,
-	PhoneNumbers []string, Password string, Groups []GroupPayload, AssertCode int) map[string]interface{} {
+// Validates a JWT like a third-party consumer with a standard
+// JWT library would do and returns its claims.
+func ParseJWTTest(t *testing.T, token string) jwt.MapClaims {
+	parsed, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		publicKey, _ := app.Keyring.PublicKey(kid)
+		return publicKey, nil
+	})
 
-	updateParams := UpdateUserPayload{
-		Name,
-		PreferredName,
-		Mail,
-		PhoneNumbers,
-		Password,
-		Groups,
+	if err != nil || !parsed.Valid {
+		t.Error("JWT could not be validated by standard library ", err)
+		return jwt.MapClaims{}
 	}
 
-	resp := app.RequestWithJWT("PUT", "/users/"+User, updateParams, jwt)
+	claims := parsed.Claims.(jwt.MapClaims)
+	if !claims.VerifyIssuer(app.JWTIssuer, true) || !claims.VerifyAudience(app.JWTAudience, true) {
+		t.Error("JWT contained wrong issuer or audience")
+	}
+
+	return claims
+}
+
+func GetJWKSTest(t *testing.T, AssertCode int) []interface{} {
+	resp := app.Request("GET", "/.well-known/jwks.json", nil)
 
 	if AssertCode == 200 && resp.Code != 200 {
-		t.Error("Could not update user")
-		return map[string]interface{}{}
+		t.Error("GetJWKS failed ", resp.Body.String())
+		return []interface{}{}
 	}
-	if AssertCode == 400 {
-		if resp.Code != 400 {
-			t.Error(fmt.Printf("UpdateUser should return BadRequest, but didnt"))
-		}
-		return map[string]interface{}{}
+
+	dat := parseResponse(resp)
+	keys, ok := dat["keys"].([]interface{})
+	if !ok {
+		t.Error("GetJWKS did not return a list of keys")
+		return []interface{}{}
+	}
+
+	return keys
+}
+
+func LogoutTest(t *testing.T, jwt string, AssertCode int) {
+	resp := app.RequestWithJWT("DELETE", "/auth", nil, jwt)
+
+	if AssertCode == 200 && resp.Code != 200 {
+		t.Error("Logout failed ", resp.Body.String())
+	}
+	if AssertCode == 401 && resp.Code != 401 {
+		t.Error("Logout should return Unauthorized, but didnt")
+	}
+}
+
+func LogoutAllTest(t *testing.T, jwt string, AssertCode int) {
+	resp := app.RequestWithJWT("DELETE", "/me/sessions", nil, jwt)
+
+	if AssertCode == 200 && resp.Code != 200 {
+		t.Error("LogoutAll failed ", resp.Body.String())
+	}
+	if AssertCode == 401 && resp.Code != 401 {
+		t.Error("LogoutAll should return Unauthorized, but didnt")
+	}
+}
+
+func ListSessionsTest(t *testing.T, jwt string, AssertCode int) []map[string]interface{} {
+	resp := app.RequestWithJWT("GET", "/me/sessions", nil, jwt)
+
+	if AssertCode == 200 && resp.Code != 200 {
+		t.Error("ListSessions failed ", resp.Body.String())
+		return []map[string]interface{}{}
 	}
 	if AssertCode == 401 {
 		if resp.Code != 401 {
-			t.Error(fmt.Printf("UpdateUser should return Unauthorized, but didnt"))
+			t.Error("ListSessions should return Unauthorized, but didnt")
+		}
+		return []map[string]interface{}{}
+	}
+
+	data := parseResponseToArray(resp)
+	return data
+}
+
+func DeleteSessionTest(t *testing.T, jwt string, Session string, AssertCode int) {
+	resp := app.RequestWithJWT("DELETE", "/me/sessions/"+Session, nil, jwt)
+
+	if AssertCode == 200 && resp.Code != 200 {
+		t.Error("DeleteSession failed ", resp.Body.String())
+	}
+	if AssertCode != 200 && resp.Code != AssertCode {
+		t.Error(fmt.Printf("DeleteSession unexpected response %d", resp.Code))
+	}
+}
+
+func ExportMeTest(t *testing.T, jwt string, Format string, AssertCode int) map[string]interface{} {
+	resp := app.RequestWithJWT("GET", "/me/export?format="+Format, nil, jwt)
+
+	if AssertCode == 200 && resp.Code != 200 {
+		t.Error("ExportMe failed ", resp.Body.String())
+		return map[string]interface{}{}
+	}
+	if AssertCode != 200 {
+		if resp.Code != AssertCode {
+			t.Error(fmt.Printf("ExportMe unexpected response %d", resp.Code))
 		}
 		return map[string]interface{}{}
 	}
-	if AssertCode == 403 {
-		if resp.Code != 403 {
-			t.Error(fmt.Printf("UpdateUser should return Forbidden, but didnt"))
+
+	if Format == "zip" {
+		if resp.Header().Get("Content-Type") != "application/zip" {
+			t.Error("ExportMe did not return a ZIP archive")
 		}
 		return map[string]interface{}{}
 	}
 
-	return parseResponse(resp)
+	data := parseResponse(resp)
+	return data
+}
+
+func DeleteMeTest(t *testing.T, jwt string, Password string, Code string, AssertCode int) {
+	deleteParams := DeleteMePayload{
+		Password,
+		Code,
+	}
+	resp := app.RequestWithJWT("DELETE", "/me", deleteParams, jwt)
+
+	if AssertCode == 200 && resp.Code != 200 {
+		t.Error("DeleteMe failed ", resp.Body.String())
+	}
+	if AssertCode != 200 && resp.Code != AssertCode {
+		t.Error(fmt.Printf("DeleteMe unexpected response %d", resp.Code))
+	}
 }
 
-func ListUsersTest(t *testing.T, jwt string, AssertCode int) []map[string]interface{} {
-	resp := app.RequestWithJWT("GET", "/users", nil, jwt)
+func RequestVerificationTest(t *testing.T, jwt string, AssertCode int) {
+	resp := app.RequestWithJWT("POST", "/verification", nil, jwt)
 
 	if AssertCode == 200 && resp.Code != 200 {
-		t.Error("ListUsers fail ", resp.Body.String())
+		t.Error("RequestVerification failed ", resp.Body.String())
+	}
+	if AssertCode == 400 && resp.Code != 400 {
+		t.Error(fmt.Printf("RequestVerification unexpected response %d", resp.Code))
+	}
+}
+
+func ConfirmVerificationTest(t *testing.T, Token string, AssertCode int) {
+	verificationParams := VerificationPayload{
+		Token,
+	}
+	resp := app.Request("PUT", "/verification", verificationParams)
+
+	if AssertCode == 200 && resp.Code != 200 {
+		t.Error("ConfirmVerification failed ", resp.Body.String())
+	}
+	if AssertCode == 400 && resp.Code != 400 {
+		t.Error(fmt.Printf("ConfirmVerification unexpected response %d", resp.Code))
+	}
+}
+
+func RequestPasswordResetTest(t *testing.T, Email string, AssertCode int) {
+	resetParams := PasswordResetRequestPayload{
+		Email,
+	}
+	resp := app.Request("POST", "/password-reset", resetParams)
+
+	if AssertCode == 200 && resp.Code != 200 {
+		t.Error("RequestPasswordReset failed ", resp.Body.String())
+	}
+	if AssertCode == 400 && resp.Code != 400 {
+		t.Error(fmt.Printf("RequestPasswordReset unexpected response %d", resp.Code))
+	}
+}
+
+func ConfirmPasswordResetTest(t *testing.T, Token string, Password string, AssertCode int) {
+	resetParams := PasswordResetPayload{
+		Token,
+		Password,
+	}
+	resp := app.Request("PUT", "/password-reset", resetParams)
+
+	if AssertCode == 200 && resp.Code != 200 {
+		t.Error("ConfirmPasswordReset failed ", resp.Body.String())
+	}
+	if AssertCode == 400 && resp.Code != 400 {
+		t.Error(fmt.Printf("ConfirmPasswordReset unexpected response %d", resp.Code))
+	}
+}
+
+func StartTwoFactorEnrollmentTest(t *testing.T, jwt string, AssertCode int) string {
+	resp := app.RequestWithJWT("POST", "/me/2fa", nil, jwt)
+
+	if AssertCode == 200 && resp.Code != 200 {
+		t.Error("StartTwoFactorEnrollment failed ", resp.Body.String())
+		return ""
+	}
+	if AssertCode == 400 && resp.Code != 400 {
+		t.Error(fmt.Printf("StartTwoFactorEnrollment unexpected response %d", resp.Code))
+	}
+
+	if resp.Code != 200 {
+		return ""
+	}
+
+	dat := parseResponse(resp)
+	return dat["Secret"].(string)
+}
+
+func ConfirmTwoFactorEnrollmentTest(t *testing.T, jwt string, Code string, AssertCode int) []interface{} {
+	confirmParams := TwoFactorCodePayload{
+		Code,
+	}
+	resp := app.RequestWithJWT("PUT", "/me/2fa", confirmParams, jwt)
+
+	if AssertCode == 200 && resp.Code != 200 {
+		t.Error("ConfirmTwoFactorEnrollment failed ", resp.Body.String())
+		return nil
+	}
+	if AssertCode == 400 && resp.Code != 400 {
+		t.Error(fmt.Printf("ConfirmTwoFactorEnrollment unexpected response %d", resp.Code))
+	}
+
+	if resp.Code != 200 {
+		return nil
+	}
+
+	dat := parseResponse(resp)
+	return dat["RecoveryCodes"].([]interface{})
+}
+
+func LoginChallengeTest(t *testing.T, Email string, Password string) string {
+	loginParams := LoginPayload{
+		Email,
+		Password,
+	}
+	resp := app.Request("POST", "/auth", loginParams)
+
+	if resp.Code != 200 {
+		t.Error("User login failed", resp.Body.String())
+		return ""
+	}
+
+	// check if a second factor is demanded instead of issuing tokens
+	dat := parseResponse(resp)
+	if dat["TwoFactorRequired"] != true || dat["AccessToken"] != nil {
+		t.Error("User login did not require a second factor")
+		return ""
+	}
+
+	return dat["ChallengeToken"].(string)
+}
+
+func LoginSecondFactorTest(t *testing.T, ChallengeToken string, Code string, AssertCode int) string {
+	secondFactorParams := LoginSecondFactorPayload{
+		ChallengeToken,
+		Code,
+	}
+	resp := app.Request("POST", "/auth/2fa", secondFactorParams)
+
+	if AssertCode == 200 && resp.Code != 200 {
+		t.Error("LoginSecondFactor failed ", resp.Body.String())
+		return ""
+	}
+	if AssertCode == 400 && resp.Code != 400 {
+		t.Error(fmt.Printf("LoginSecondFactor unexpected response %d", resp.Code))
+	}
+
+	if resp.Code != 200 {
+		return ""
+	}
+
+	dat := parseResponse(resp)
+	return dat["AccessToken"].(string)
+}
+
+func TestTOTPCode(t *testing.T) {
+	// test vector of RFC 6238 for SHA1 at 59 seconds, truncated to six digits
+	code, ok := totpCode("GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", 1)
+	if !ok || code != "287082" {
+		t.Error("TOTP code does not match RFC 6238 test vector")
+	}
+
+	if _, ok := verifyTOTP("GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", "287082", time.Unix(59, 0)); !ok {
+		t.Error("TOTP code of current time step was not accepted")
+	}
+	if _, ok := verifyTOTP("GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", "287082", time.Unix(599, 0)); ok {
+		t.Error("TOTP code of an old time step was accepted")
+	}
+}
+
+func TestPrincipalCache(t *testing.T) {
+	cache := NewPrincipalCache(2, time.Minute)
+
+	cache.Put(&Principal{User: db.User{ID: "first"}}, cache.Generation("first"))
+	cache.Put(&Principal{User: db.User{ID: "second"}}, cache.Generation("second"))
+	if _, ok := cache.Get("first"); !ok {
+		t.Error("PrincipalCache lost an entry before being full")
+	}
+
+	// least recently used entry is evicted when full
+	cache.Put(&Principal{User: db.User{ID: "third"}}, cache.Generation("third"))
+	if _, ok := cache.Get("second"); ok {
+		t.Error("PrincipalCache did not evict least recently used entry")
+	}
+	if _, ok := cache.Get("first"); !ok {
+		t.Error("PrincipalCache evicted recently used entry")
+	}
+
+	cache.Invalidate("first")
+	if _, ok := cache.Get("first"); ok {
+		t.Error("PrincipalCache returned invalidated entry")
+	}
+
+	// principals loaded before an invalidation are not stored
+	generation := cache.Generation("first")
+	cache.Invalidate("first")
+	cache.Put(&Principal{User: db.User{ID: "first"}}, generation)
+	if _, ok := cache.Get("first"); ok {
+		t.Error("PrincipalCache stored principal loaded before invalidation")
+	}
+	generation = cache.Generation("first")
+	cache.Clear()
+	cache.Put(&Principal{User: db.User{ID: "first"}}, generation)
+	if _, ok := cache.Get("first"); ok {
+		t.Error("PrincipalCache stored principal loaded before clear")
+	}
+
+	// expired entries are not returned
+	cache = NewPrincipalCache(2, time.Millisecond)
+	cache.Put(&Principal{User: db.User{ID: "first"}}, cache.Generation("first"))
+	time.Sleep(5 * time.Millisecond)
+	if _, ok := cache.Get("first"); ok {
+		t.Error("PrincipalCache returned expired entry")
+	}
+}
+
+func TestPasswordHashing(t *testing.T) {
+	bcryptHasher := BcryptHasher{Cost: 4}
+	argonHasher := Argon2idHasher{Memory: 1024, Time: 1, Threads: 1, SaltLen: 16, KeyLen: 32}
+	hashing := NewPasswordHashing(argonHasher, bcryptHasher)
+
+	argonHash, _ := hashing.Hash("CorrectHorseBatteryStaple666!")
+	if ok, upgrade := hashing.Verify(argonHash, "CorrectHorseBatteryStaple666!"); !ok || upgrade {
+		t.Error("Current Argon2id hash was not verified or should be upgraded")
+	}
+	if ok, _ := hashing.Verify(argonHash, "WrongHorseBatteryStaple666!"); ok {
+		t.Error("Argon2id hash verified wrong password")
+	}
+
+	// Existing bcrypt hashes keep working, but should be upgraded.
+	bcryptHash, _ := bcryptHasher.Hash("CorrectHorseBatteryStaple666!")
+	if ok, upgrade := hashing.Verify(bcryptHash, "CorrectHorseBatteryStaple666!"); !ok || !upgrade {
+		t.Error("bcrypt hash was not verified or should not be upgraded")
+	}
+
+	// Hashes with outdated parameters should be upgraded as well.
+	strongerHashing := NewPasswordHashing(Argon2idHasher{Memory: 2048, Time: 1, Threads: 1, SaltLen: 16, KeyLen: 32})
+	if ok, upgrade := strongerHashing.Verify(argonHash, "CorrectHorseBatteryStaple666!"); !ok || !upgrade {
+		t.Error("Argon2id hash with outdated parameters was not verified or should not be upgraded")
+	}
+
+	// Unknown users and accounts without password never verify.
+	if ok, _ := hashing.Verify("", ""); ok {
+		t.Error("Empty hash was verified")
+	}
+	if ok, _ := hashing.Verify("!service-account", "!service-account"); ok {
+		t.Error("Invalid hash was verified")
+	}
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	policy := PasswordPolicy{MinLength: 16, RequireDigit: true, RequireSpecial: true}
+
+	if message := policy.Check("CorrectHorseBatteryStaple666!", "Alexandra Namia", "alex.namia@example.com"); message != "" {
+		t.Errorf("PasswordPolicy rejected valid password: %s", message)
+	}
+	if message := policy.Check("Short666!"); message != "Is too short" {
+		t.Errorf("PasswordPolicy unexpected message for short password: %s", message)
+	}
+	if message := policy.Check("CorrectHorseBatteryStaple!!!"); message != "Does not contain a number" {
+		t.Errorf("PasswordPolicy unexpected message for password without number: %s", message)
+	}
+
+	// Parts of name and mail address are banned, short ones are not.
+	if message := policy.Check("IAmNamiaAndThatIsFine666!", "Alexandra Namia"); message != "Must not contain your name or mail address" {
+		t.Errorf("PasswordPolicy unexpected message for password containing name: %s", message)
+	}
+	if message := policy.Check("AlexIsMyFriend666!", "al.ex@example.com"); message != "" {
+		t.Errorf("PasswordPolicy rejected password containing only short words: %s", message)
+	}
+	if message := policy.Check("ExampleForEveryone666!", "someone@example.com"); message != "" {
+		t.Errorf("PasswordPolicy rejected password containing mail domain: %s", message)
+	}
+
+	// Breached passwords are looked up in a sorted list of SHA-1 hashes.
+	passwords := []string{"password", "123456", "CorrectHorseBatteryStaple666!", "qwerty", "letmein"}
+	hashes := make([]string, len(passwords))
+	for i, password := range passwords {
+		sum := sha1.Sum([]byte(password))
+		hashes[i] = fmt.Sprintf("%X:%d", sum, (i + 1))
+	}
+	sort.Strings(hashes)
+
+	file, err := ioutil.TempFile("", "breached")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString(strings.Join(hashes, "\n"))
+	file.Close()
+
+	policy.Breached = &BreachedPasswords{Path: file.Name()}
+
+	for _, password := range passwords {
+		if !policy.Breached.Contains(password) {
+			t.Errorf("BreachedPasswords did not find %s", password)
+		}
+	}
+	if policy.Breached.Contains("NobodyWouldEverGuessThis666!") {
+		t.Error("BreachedPasswords found password not on list")
+	}
+	if message := policy.Check("CorrectHorseBatteryStaple666!"); message != "Appeared in a data breach, please choose another one" {
+		t.Errorf("PasswordPolicy unexpected message for breached password: %s", message)
+	}
+}
+
+func TestPhoneNumbers(t *testing.T) {
+	number, err := db.NewPhoneNumber(" 030 / 231 250-00 ", "SMS", "DE")
+	if err != nil || number.Number != "+493023125000" || number.Label != db.PhoneLabelSMS {
+		t.Errorf("NewPhoneNumber did not normalise national number: %v %v", number, err)
+	}
+	number, err = db.NewPhoneNumber("+44 20 7219 3000", "", "DE")
+	if err != nil || number.Number != "+442072193000" {
+		t.Errorf("NewPhoneNumber did not keep country code of international number: %v %v", number, err)
+	}
+	if _, err := db.NewPhoneNumber("0123\"", "", "DE"); err != db.ErrPhoneNumberInvalid {
+		t.Error("NewPhoneNumber accepted invalid number")
+	}
+	if _, err := db.NewPhoneNumber("030 23125000", "pager", "DE"); err != db.ErrPhoneLabelInvalid {
+		t.Error("NewPhoneNumber accepted unknown label")
+	}
+
+	// Numbers stored before labels existed are plain strings.
+	var numbers db.PhoneNumbers
+	if err := numbers.Scan([]byte(`["+493023125000", {"Number": "+4915123456789", "Label": "mobile"}]`)); err != nil {
+		t.Fatal(err)
+	}
+	if len(numbers) != 2 || numbers[0].Number != "+493023125000" || numbers[1].Label != db.PhoneLabelMobile {
+		t.Errorf("PhoneNumbers scanned wrongly: %v", numbers)
+	}
+	if value, _ := db.PhoneNumbers(nil).Value(); value != "[]" {
+		t.Errorf("PhoneNumbers stored nil as %v", value)
+	}
+}
+
+func TestMaskContacts(t *testing.T) {
+	model := []interface{}{
+		map[string]interface{}{
+			"ID":           "visible",
+			"Mail":         "visible@test.org",
+			"PhoneNumbers": db.PhoneNumbers{{Number: "+493023125000", Label: db.PhoneLabelLandline}},
+		},
+		map[string]interface{}{
+			"ID": "offer",
+			"User": map[string]interface{}{
+				"ID":           "hidden",
+				"Mail":         "hidden@test.org",
+				"PhoneNumbers": db.PhoneNumbers{{Number: "+493023125000", Label: db.PhoneLabelLandline}},
+			},
+		},
+	}
+	maskContacts(model, map[string]bool{"visible": true})
+
+	visible := model[0].(map[string]interface{})
+	if visible["Mail"] != "visible@test.org" || visible["ContactMasked"] != nil {
+		t.Errorf("maskContacts masked visible user: %v", visible)
+	}
+	hidden := model[1].(map[string]interface{})["User"].(map[string]interface{})
+	if hidden["Mail"] != "h***@test.org" || hidden["ContactMasked"] != true {
+		t.Errorf("maskContacts did not mask nested user: %v", hidden)
+	}
+	numbers := hidden["PhoneNumbers"].(db.PhoneNumbers)
+	if numbers[0].Number != "+49********00" || numbers[0].Label != db.PhoneLabelLandline {
+		t.Errorf("maskContacts did not mask phone numbers: %v", numbers)
+	}
+	if model[1].(map[string]interface{})["ContactMasked"] != nil {
+		t.Error("maskContacts marked offer without contact details")
+	}
+}
+
+func TestLoginThrottle(t *testing.T) {
+	throttle := NewLoginThrottle(2, 3, time.Minute, time.Minute, time.Hour)
+
+	// mail gets locked after two failures
+	throttle.Fail("throttled@test.org", "192.0.2.1")
+	if throttle.RetryAfter("throttled@test.org", "192.0.2.1") > 0 {
+		t.Error("LoginThrottle locked mail too early")
+	}
+	throttle.Fail("throttled@test.org", "192.0.2.1")
+	if throttle.RetryAfter("throttled@test.org", "192.0.2.99") == 0 {
+		t.Error("LoginThrottle did not lock mail after too many failures")
+	}
+
+	// IP gets locked after three failures, regardless of mail
+	if throttle.RetryAfter("other@test.org", "192.0.2.1") > 0 {
+		t.Error("LoginThrottle locked IP too early")
+	}
+	throttle.Fail("other@test.org", "192.0.2.1")
+	if throttle.RetryAfter("other@test.org", "192.0.2.1") == 0 {
+		t.Error("LoginThrottle did not lock IP after too many failures")
+	}
+
+	if len(throttle.Locked()) != 2 {
+		t.Error("LoginThrottle should list locked mail and IP")
+	}
+
+	// second lockout of the same mail lasts longer
+	firstWait := throttle.RetryAfter("throttled@test.org", "192.0.2.99")
+	throttle.Fail("throttled@test.org", "192.0.2.99")
+	throttle.Fail("throttled@test.org", "192.0.2.99")
+	if throttle.RetryAfter("throttled@test.org", "192.0.2.99") <= firstWait {
+		t.Error("LoginThrottle did not increase lockout time")
+	}
+}
+
+// ----------------------------------------------------------------- USERS
+
+// [X] CreateUser : U
+// [X] UpdateUser : S
+// [X] ListUsers : A
+// [X] GetUser : A
+// [] PromoteToSystemAdmin : S
+// [X] SuspendUser : S
+// [X] EnableUser : S
+
+func CreateUserTest(t *testing.T, Email string, Password string, Name string, AssertCode int) {
+	// Create User
+	createParams := CreateUserPayload{
+		Name:          Name,
+		PreferredName: Name + " Pref",
+		Mail:          Email,
+		Password:      Password,
+		PhoneNumbers:  []PhoneNumberPayload{{Number: "+49 30 23125000"}},
+	}
+	resp := app.Request("POST", "/users", createParams)
+
+	if AssertCode == 200 && resp.Code != 200 {
+		t.Error("User creation failed")
+	}
+
+	if AssertCode == 400 && resp.Code != 400 {
+		t.Error("User should already exist")
+	}
+}
+
+func UpdateUserTest(t *testing.T, jwt string, User string, Name string, PreferredName string, Mail string,
+	PhoneNumbers []PhoneNumberPayload, Password string, Groups []GroupPayload, AssertCode int) map[string]interface{} {
+
+	updateParams := UpdateUserPayload{
+		Name,
+		PreferredName,
+		Mail,
+		PhoneNumbers,
+		Password,
+		Groups,
+	}
+
+	resp := app.RequestWithJWT("PUT", "/users/"+User, updateParams, jwt)
+
+	if AssertCode == 200 && resp.Code != 200 {
+		t.Error("Could not update user")
+		return map[string]interface{}{}
+	}
+	if AssertCode == 400 {
+		if resp.Code != 400 {
+			t.Error(fmt.Printf("UpdateUser should return BadRequest, but didnt"))
+		}
+		return map[string]interface{}{}
+	}
+	if AssertCode == 401 {
+		if resp.Code != 401 {
+			t.Error(fmt.Printf("UpdateUser should return Unauthorized, but didnt"))
+		}
+		return map[string]interface{}{}
+	}
+	if AssertCode == 403 {
+		if resp.Code != 403 {
+			t.Error(fmt.Printf("UpdateUser should return Forbidden, but didnt"))
+		}
+		return map[string]interface{}{}
+	}
+
+	return parseResponse(resp)
+}
+
+func ListUsersTest(t *testing.T, jwt string, Query string, AssertCode int) ([]map[string]interface{}, string) {
+	resp := app.RequestWithJWT("GET", "/users?"+Query, nil, jwt)
+
+	if AssertCode == 200 && resp.Code != 200 {
+		t.Error("ListUsers fail ", resp.Body.String())
+		return []map[string]interface{}{}, ""
+	}
+	if AssertCode != 200 {
+		if resp.Code != AssertCode {
+			t.Error(fmt.Printf("ListUsers unexpected response %d", resp.Code))
+		}
+		return []map[string]interface{}{}, ""
+	}
+
+	return parseResponseToArray(resp), resp.Header().Get("X-Next-Cursor")
+}
+
+func ListUsersInRegionTest(t *testing.T, jwt string, Region string, Query string, AssertCode int) []map[string]interface{} {
+	resp := app.RequestWithJWT("GET", "/regions/"+Region+"/users?"+Query, nil, jwt)
+
+	if AssertCode == 200 && resp.Code != 200 {
+		t.Error("Could not list users of region: ", resp.Body.String())
+		return []map[string]interface{}{}
+	}
+	if AssertCode != 200 {
+		if resp.Code != AssertCode {
+			t.Error(fmt.Printf("ListUsersInRegion unexpected response %d", resp.Code))
+		}
+		return []map[string]interface{}{}
+	}
+
+	data := parseResponseToArray(resp)
+	return data
+}
+
+func RevealContactInRegionTest(t *testing.T, jwt string, Region string, User string, Reason string, AssertCode int) map[string]interface{} {
+	revealParams := RevealContactPayload{
+		Reason,
+	}
+	resp := app.RequestWithJWT("POST", "/regions/"+Region+"/users/"+User+"/contact", revealParams, jwt)
+
+	if AssertCode == 200 && resp.Code != 200 {
+		t.Error("RevealContactInRegion failed ", resp.Body.String())
+		return map[string]interface{}{}
+	}
+	if AssertCode != 200 {
+		if resp.Code != AssertCode {
+			t.Error(fmt.Printf("RevealContactInRegion unexpected response %d", resp.Code))
+		}
+		return map[string]interface{}{}
+	}
+
+	return parseResponse(resp)
+}
+
+func GetUser(t *testing.T, jwt string, User string, AssertCode int) map[string]interface{} {
+	resp := app.RequestWithJWT("GET", "/users/"+User, nil, jwt)
+
+	if AssertCode == 200 && resp.Code != 200 {
+		t.Error("Could not get user")
+		return map[string]interface{}{}
+	}
+	if AssertCode == 400 {
+		if resp.Code != 400 {
+			t.Error(fmt.Printf("GetUser should return BadRequest, but didnt"))
+		}
+		return map[string]interface{}{}
+	}
+	if AssertCode == 401 {
+		if resp.Code != 401 {
+			t.Error(fmt.Printf("GetUser should return Unauthorized, but didnt"))
+		}
+		return map[string]interface{}{}
+	}
+
+	return parseResponse(resp)
+}
+
+func SuspendUserTest(t *testing.T, jwt string, User string, Reason string, AssertCode int) map[string]interface{} {
+	suspensionParams := SuspensionPayload{
+		Reason,
+	}
+	resp := app.RequestWithJWT("POST", "/users/"+User+"/suspension", suspensionParams, jwt)
+
+	if AssertCode == 200 && resp.Code != 200 {
+		t.Error("SuspendUser failed ", resp.Body.String())
+		return map[string]interface{}{}
+	}
+	if AssertCode != 200 {
+		if resp.Code != AssertCode {
+			t.Error(fmt.Printf("SuspendUser unexpected response %d", resp.Code))
+		}
+		return map[string]interface{}{}
+	}
+
+	return parseResponse(resp)
+}
+
+func EnableUserTest(t *testing.T, jwt string, User string, AssertCode int) map[string]interface{} {
+	resp := app.RequestWithJWT("DELETE", "/users/"+User+"/suspension", nil, jwt)
+
+	if AssertCode == 200 && resp.Code != 200 {
+		t.Error("EnableUser failed ", resp.Body.String())
+		return map[string]interface{}{}
+	}
+	if AssertCode != 200 {
+		if resp.Code != AssertCode {
+			t.Error(fmt.Printf("EnableUser unexpected response %d", resp.Code))
+		}
+		return map[string]interface{}{}
+	}
+
+	return parseResponse(resp)
+}
+
+// ------------------------------------------------------- SERVICE ACCOUNTS
+
+// [X] CreateServiceAccount : S
+// [] ListServiceAccounts : S
+// [] ListAPIKeys : S
+// [X] CreateAPIKey : S
+// [X] RevokeAPIKey : S - check if revoked keys are rejected
+
+func CreateServiceAccountTest(t *testing.T, jwt string, Name string, Email string, AssertCode int) string {
+	createParams := CreateServiceAccountPayload{
+		Name: Name,
+		Mail: Email,
+	}
+	resp := app.RequestWithJWT("POST", "/service-accounts", createParams, jwt)
+
+	if AssertCode == 201 && resp.Code != 201 {
+		t.Error("CreateServiceAccount failed ", resp.Body.String())
+		return ""
+	}
+	if AssertCode != 201 {
+		if resp.Code != AssertCode {
+			t.Error(fmt.Printf("CreateServiceAccount unexpected response %d", resp.Code))
+		}
+		return ""
+	}
+
+	dat := parseResponse(resp)
+	if dat["ServiceAccount"] != true {
+		t.Error("CreateServiceAccount did not create a service account")
+	}
+
+	return dat["ID"].(string)
+}
+
+func CreateAPIKeyTest(t *testing.T, jwt string, ServiceAccount string, Name string, AssertCode int) (string, string) {
+	createParams := CreateAPIKeyPayload{
+		Name,
+	}
+	resp := app.RequestWithJWT("POST", "/service-accounts/"+ServiceAccount+"/keys", createParams, jwt)
+
+	if AssertCode == 201 && resp.Code != 201 {
+		t.Error("CreateAPIKey failed ", resp.Body.String())
+		return "", ""
+	}
+	if AssertCode != 201 {
+		if resp.Code != AssertCode {
+			t.Error(fmt.Printf("CreateAPIKey unexpected response %d", resp.Code))
+		}
+		return "", ""
+	}
+
+	dat := parseResponse(resp)
+	return dat["ID"].(string), dat["Key"].(string)
+}
+
+func RevokeAPIKeyTest(t *testing.T, jwt string, ServiceAccount string, Key string, AssertCode int) {
+	resp := app.RequestWithJWT("DELETE", "/service-accounts/"+ServiceAccount+"/keys/"+Key, nil, jwt)
+
+	if resp.Code != AssertCode {
+		t.Error(fmt.Printf("RevokeAPIKey unexpected response %d", resp.Code))
+	}
+}
+
+func GetMeWithAPIKeyTest(t *testing.T, apiKey string, AssertCode int) map[string]interface{} {
+	resp := app.RequestWithAPIKey("GET", "/me", nil, apiKey)
+
+	if resp.Code != AssertCode {
+		t.Error(fmt.Printf("GetMe with API key unexpected response %d", resp.Code))
+		return map[string]interface{}{}
+	}
+	if AssertCode != 200 {
+		return map[string]interface{}{}
+	}
+
+	return parseResponse(resp)
+}
+
+// ----------------------------------------------------------------- ROLES
+
+// [X] ListPermissions : S
+// [X] ListRoles : S
+// [X] CreateRole : S
+// [] UpdateRole : S
+// [X] GrantRoleInRegion : A - check if no permissions beyond own ones can be granted
+
+func ListPermissionsTest(t *testing.T, jwt string, AssertCode int) []map[string]interface{} {
+	resp := app.RequestWithJWT("GET", "/permissions", nil, jwt)
+
+	if AssertCode == 200 && resp.Code != 200 {
+		t.Error("Could not get permissions")
+		return []map[string]interface{}{}
+	}
+	if AssertCode == 401 {
+		if resp.Code != 401 {
+			t.Error(fmt.Printf("ListPermissions should return Unauthorized, but didnt"))
+		}
+		return []map[string]interface{}{}
+	}
+
+	data := parseResponseToArray(resp)
+	return data
+}
+
+func ListRolesTest(t *testing.T, jwt string, AssertCode int) []map[string]interface{} {
+	resp := app.RequestWithJWT("GET", "/roles", nil, jwt)
+
+	if AssertCode == 200 && resp.Code != 200 {
+		t.Error("Could not get roles")
+		return []map[string]interface{}{}
+	}
+	if AssertCode == 401 {
+		if resp.Code != 401 {
+			t.Error(fmt.Printf("ListRoles should return Unauthorized, but didnt"))
+		}
+		return []map[string]interface{}{}
+	}
+
+	data := parseResponseToArray(resp)
+	return data
+}
+
+func CreateRoleTest(t *testing.T, jwt string, Name string, Permissions []string, AssertCode int) string {
+	createParams := RolePayload{
+		Name:        Name,
+		Description: "Role created by tests",
+		Permissions: Permissions,
+	}
+	resp := app.RequestWithJWT("POST", "/roles", createParams, jwt)
+
+	if AssertCode == 201 && resp.Code != 201 {
+		t.Error("CreateRole failed ", resp.Body.String())
+		return ""
+	}
+	if AssertCode != 201 {
+		if resp.Code != AssertCode {
+			t.Error(fmt.Printf("CreateRole unexpected response %d", resp.Code))
+		}
+		return ""
+	}
+
+	dat := parseResponse(resp)
+	return dat["ID"].(string)
+}
+
+// ----------------------------------------------------------------- GROUPS
+
+// [X] GetGroups : S
+// [X] ListSystemAdmins : S
+// [X] DemoteSystemAdmin : S - check if the last system admin stays
+// [X] ListLockouts : S
+// [X] ListAuditEntries : S - check if privileged actions are recorded
+
+func GetGroupsTest(t *testing.T, jwt string, AssertCode int) []map[string]interface{} {
+	resp := app.RequestWithJWT("GET", "/groups", nil, jwt)
+
+	if AssertCode == 200 && resp.Code != 200 {
+		t.Error("Could not get groups")
+		return []map[string]interface{}{}
+	}
+	if AssertCode == 401 {
+		if resp.Code != 401 {
+			t.Error(fmt.Printf("GetGroups should return Unauthorized, but didnt"))
+		}
+		return []map[string]interface{}{}
+	}
+
+	data := parseResponseToArray(resp)
+	return data
+}
+
+func ListSystemAdminsTest(t *testing.T, jwt string, AssertCode int) []map[string]interface{} {
+	resp := app.RequestWithJWT("GET", "/system/admins", nil, jwt)
+
+	if AssertCode == 200 && resp.Code != 200 {
+		t.Error("Could not get System  admin list")
+		return []map[string]interface{}{}
+	}
+	if AssertCode == 401 {
+		if resp.Code != 401 {
+			t.Error(fmt.Printf("ListSystemAdmins should return Unauthorized, but didnt"))
+		}
+		return []map[string]interface{}{}
+	}
+
+	data := parseResponseToArray(resp)
+	return data
+}
+
+func DemoteSystemAdminTest(t *testing.T, jwt string, User string, AssertCode int) {
+	resp := app.RequestWithJWT("DELETE", "/system/admins/"+User, nil, jwt)
+
+	if AssertCode == 200 && resp.Code != 200 {
+		t.Error("Demoting system admin did not work, but should: ", resp.Body.String())
+	}
+	if AssertCode != 200 && resp.Code != AssertCode {
+		t.Error(fmt.Printf("DemoteSystemAdmin unexpected response %d", resp.Code))
+	}
+}
+
+func ListLockoutsTest(t *testing.T, jwt string, AssertCode int) []map[string]interface{} {
+	resp := app.RequestWithJWT("GET", "/system/lockouts", nil, jwt)
+
+	if AssertCode == 200 && resp.Code != 200 {
+		t.Error("Could not get lockout list")
+		return []map[string]interface{}{}
+	}
+	if AssertCode == 401 {
+		if resp.Code != 401 {
+			t.Error(fmt.Printf("ListLockouts should return Unauthorized, but didnt"))
+		}
+		return []map[string]interface{}{}
+	}
+
+	data := parseResponseToArray(resp)
+	return data
+}
+
+func ListAuditEntriesTest(t *testing.T, jwt string, Query string, AssertCode int) ([]map[string]interface{}, string) {
+	resp := app.RequestWithJWT("GET", "/audit?"+Query, nil, jwt)
+
+	if AssertCode == 200 && resp.Code != 200 {
+		t.Error("Could not get audit trail: ", resp.Body.String())
+		return []map[string]interface{}{}, ""
+	}
+	if AssertCode != 200 {
+		if resp.Code != AssertCode {
+			t.Error(fmt.Printf("ListAuditEntries unexpected response %d", resp.Code))
+		}
+		return []map[string]interface{}{}, ""
+	}
+
+	if resp.Header().Get("X-Request-ID") == "" {
+		t.Error("ListAuditEntries response carries no request ID")
+	}
+
+	return parseResponseToArray(resp), resp.Header().Get("X-Next-Cursor")
+}
+
+func TestDiffStates(t *testing.T) {
+	before := map[string]interface{}{"Name": "Old", "Description": "Same", "Removed": true}
+	after := map[string]interface{}{"Name": "New", "Description": "Same", "Added": 1}
+
+	changes := diffStates(before, after)
+	if len(changes) != 3 {
+		t.Error("diffStates did not return exactly the changed fields")
+	}
+	if changes["Name"].Before != "Old" || changes["Name"].After != "New" {
+		t.Error("diffStates did not record old and new value")
+	}
+	if changes["Removed"].After != nil || changes["Added"].Before != nil {
+		t.Error("diffStates recorded values of missing fields")
+	}
+
+	if len(diffStates(nil, after)) != 3 {
+		t.Error("diffStates did not record all fields of a created object")
+	}
+}
+
+// ----------------------------------------------------------- ORGANISATIONS
+
+// [X] CreateOrganisation - L
+// [X] SetOrganisationMember - O - check if the last owner stays
+// [X] RemoveOrganisationMember - O, M
+// [X] ListOrganisationMembers - O, M
+// [X] ListOrganisationOffers - O, M
+// [X] GrantRoleToOrganisationInRegion - A
+
+func CreateOrganisationTest(t *testing.T, jwt string, Name string, AssertCode int) string {
+	createParams := OrganisationPayload{
+		Name,
+		"We help wherever help is needed.",
+	}
+	resp := app.RequestWithJWT("POST", "/organisations", createParams, jwt)
+
+	if AssertCode == 201 && resp.Code != 201 {
+		t.Error("Could not create organisation ", resp.Body.String())
+		return ""
+	}
+	if AssertCode != 201 {
+		if resp.Code != AssertCode {
+			t.Error(fmt.Printf("CreateOrganisation unexpected response %d", resp.Code))
+		}
+		return ""
+	}
+
+	data := parseResponse(resp)
+	return data["ID"].(string)
+}
+
+func SetOrganisationMemberTest(t *testing.T, jwt string, Organisation string, Email string, Role string, AssertCode int) {
+	memberParams := OrganisationMemberPayload{Email, Role}
+	resp := app.RequestWithJWT("POST", "/organisations/"+Organisation+"/members", memberParams, jwt)
+
+	if AssertCode == 200 && resp.Code != 200 {
+		t.Error("SetOrganisationMember failed ", resp.Body.String())
+	}
+	if AssertCode != 200 && resp.Code != AssertCode {
+		t.Error(fmt.Printf("SetOrganisationMember unexpected response %d", resp.Code))
+	}
+}
+
+func RemoveOrganisationMemberTest(t *testing.T, jwt string, Organisation string, User string, AssertCode int) {
+	resp := app.RequestWithJWT("DELETE", "/organisations/"+Organisation+"/members/"+User, nil, jwt)
+
+	if AssertCode == 200 && resp.Code != 200 {
+		t.Error("RemoveOrganisationMember failed ", resp.Body.String())
+	}
+	if AssertCode != 200 && resp.Code != AssertCode {
+		t.Error(fmt.Printf("RemoveOrganisationMember unexpected response %d", resp.Code))
+	}
+}
+
+func ListOrganisationMembersTest(t *testing.T, jwt string, Organisation string, AssertCode int) []map[string]interface{} {
+	resp := app.RequestWithJWT("GET", "/organisations/"+Organisation+"/members", nil, jwt)
+
+	if AssertCode == 200 && resp.Code != 200 {
+		t.Error("Could not list organisation members")
 		return []map[string]interface{}{}
 	}
-	if AssertCode == 401 {
-		if resp.Code != 401 {
-			t.Error("ListUsers should return UnAuthorized but didnt")
+	if AssertCode != 200 {
+		if resp.Code != AssertCode {
+			t.Error(fmt.Printf("ListOrganisationMembers unexpected response %d", resp.Code))
 		}
 		return []map[string]interface{}{}
 	}
@@ -343,68 +1378,44 @@ func ListUsersTest(t *testing.T, jwt string, AssertCode int) []map[string]interf
 	return parseResponseToArray(resp)
 }
 
-func GetUser(t *testing.T, jwt string, User string, AssertCode int) map[string]interface{} {
-	resp := app.RequestWithJWT("GET", "/users/"+User, nil, jwt)
+func ListOrganisationOffersTest(t *testing.T, jwt string, Organisation string, AssertCode int) []map[string]interface{} {
+	resp := app.RequestWithJWT("GET", "/organisations/"+Organisation+"/offers", nil, jwt)
 
 	if AssertCode == 200 && resp.Code != 200 {
-		t.Error("Could not get user")
-		return map[string]interface{}{}
-	}
-	if AssertCode == 400 {
-		if resp.Code != 400 {
-			t.Error(fmt.Printf("GetUser should return BadRequest, but didnt"))
-		}
-		return map[string]interface{}{}
+		t.Error("Could not list organisation offers")
+		return []map[string]interface{}{}
 	}
-	if AssertCode == 401 {
-		if resp.Code != 401 {
-			t.Error(fmt.Printf("GetUser should return Unauthorized, but didnt"))
+	if AssertCode != 200 {
+		if resp.Code != AssertCode {
+			t.Error(fmt.Printf("ListOrganisationOffers unexpected response %d", resp.Code))
 		}
-		return map[string]interface{}{}
+		return []map[string]interface{}{}
 	}
 
-	return parseResponse(resp)
+	return parseResponseToArray(resp)
 }
 
-// ----------------------------------------------------------------- GROUPS
-
-// [X] GetGroups : S
-// [X] ListSystemAdmins : S
-
-func GetGroupsTest(t *testing.T, jwt string, AssertCode int) []map[string]interface{} {
-	resp := app.RequestWithJWT("GET", "/groups", nil, jwt)
+func GrantRoleToOrganisationInRegionTest(t *testing.T, jwt string, Region string, Organisation string, Role string, AssertCode int) {
+	grantParams := GrantOrganisationRolePayload{Organisation, Role}
+	resp := app.RequestWithJWT("POST", "/regions/"+Region+"/organisations", grantParams, jwt)
 
 	if AssertCode == 200 && resp.Code != 200 {
-		t.Error("Could not get groups")
-		return []map[string]interface{}{}
+		t.Error("Granting role to organisation did not work, but should: ", resp.Body.String())
 	}
-	if AssertCode == 401 {
-		if resp.Code != 401 {
-			t.Error(fmt.Printf("GetGroups should return Unauthorized, but didnt"))
-		}
-		return []map[string]interface{}{}
+	if AssertCode != 200 && resp.Code != AssertCode {
+		t.Error(fmt.Printf("GrantRoleToOrganisationInRegion unexpected response %d", resp.Code))
 	}
-
-	data := parseResponseToArray(resp)
-	return data
 }
 
-func ListSystemAdminsTest(t *testing.T, jwt string, AssertCode int) []map[string]interface{} {
-	resp := app.RequestWithJWT("GET", "/system/admins", nil, jwt)
+func RevokeRoleFromOrganisationInRegionTest(t *testing.T, jwt string, Region string, Role string, Organisation string, AssertCode int) {
+	resp := app.RequestWithJWT("DELETE", "/regions/"+Region+"/roles/"+Role+"/organisations/"+Organisation, nil, jwt)
 
 	if AssertCode == 200 && resp.Code != 200 {
-		t.Error("Could not get System  admin list")
-		return []map[string]interface{}{}
+		t.Error("Revoking role from organisation did not work, but should: ", resp.Body.String())
 	}
-	if AssertCode == 401 {
-		if resp.Code != 401 {
-			t.Error(fmt.Printf("ListSystemAdmins should return Unauthorized, but didnt"))
-		}
-		return []map[string]interface{}{}
+	if AssertCode != 200 && resp.Code != AssertCode {
+		t.Error(fmt.Printf("RevokeRoleFromOrganisationInRegion unexpected response %d", resp.Code))
 	}
-
-	data := parseResponseToArray(resp)
-	return data
 }
 
 // ----------------------------------------------------------------- OFFERS
@@ -413,7 +1424,7 @@ func ListSystemAdminsTest(t *testing.T, jwt string, AssertCode int) []map[string
 // [X] GetOffer - C
 // [X] UpdateOffer - C
 
-func CreateOfferTest(t *testing.T, jwt string, Name string, Location gormGIS.GeoPoint, Radius float64, Validity string, AssertCode int) string {
+func CreateOfferTest(t *testing.T, jwt string, Name string, Location gormGIS.GeoPoint, Radius float64, Validity string, Organisation string, AssertCode int) string {
 
 	plCreateOffer := CreateOfferPayload{
 		Name,
@@ -425,6 +1436,7 @@ func CreateOfferTest(t *testing.T, jwt string, Name string, Location gormGIS.Geo
 		[]string{},
 		"This is a description of itsself because some text is needed for the description field.",
 		Validity,
+		Organisation,
 	}
 
 	// check if offer was created
@@ -535,6 +1547,7 @@ func CreateRequestTest(t *testing.T, jwt string, Name string, Location gormGIS.G
 		Tags,
 		Description,
 		Validity,
+		"",
 	}
 
 	resp := app.RequestWithJWT("POST", "/requests", plCreateRequest, jwt)
@@ -621,6 +1634,9 @@ func UpdateRequestTest(t *testing.T, jwt string, Request string, Name string, Lo
 // [X] CreateMatching - A
 // [X] GetMatching - C
 // [X] UpdateMatching - C
+// [X] CompleteMatching - C
+// [X] CreateFeedback - C
+// [X] ListFeedbackForMatching - C
 
 func CreateMatchingTest(t *testing.T, jwt string, Region string, Offer string, Request string, AssertCode int) string {
 	plCreateMatching := CreateMatchingPayload{
@@ -704,6 +1720,52 @@ func UpdateMatchingTest(t *testing.T, jwt string, Matching string, Invalid bool,
 	return data
 }
 
+func CompleteMatchingTest(t *testing.T, jwt string, Matching string, AssertCode int) map[string]interface{} {
+	resp := app.RequestWithJWT("PUT", "/matchings/"+Matching+"/completion", nil, jwt)
+
+	if AssertCode == 200 && resp.Code != 200 {
+		t.Error("CompleteMatching failed ", resp.Body.String())
+		return map[string]interface{}{}
+	}
+	if AssertCode != 200 {
+		if resp.Code != AssertCode {
+			t.Error(fmt.Printf("CompleteMatching unexpected response %d", resp.Code))
+		}
+		return map[string]interface{}{}
+	}
+
+	return parseResponse(resp)
+}
+
+func CreateFeedbackTest(t *testing.T, jwt string, Matching string, Rating int, Comment string, AssertCode int) {
+	feedbackParams := FeedbackPayload{Rating, Comment}
+	resp := app.RequestWithJWT("POST", "/matchings/"+Matching+"/feedback", feedbackParams, jwt)
+
+	if AssertCode == 201 && resp.Code != 201 {
+		t.Error("CreateFeedback failed ", resp.Body.String())
+	}
+	if AssertCode != 201 && resp.Code != AssertCode {
+		t.Error(fmt.Printf("CreateFeedback unexpected response %d", resp.Code))
+	}
+}
+
+func ListFeedbackForMatchingTest(t *testing.T, jwt string, Matching string, AssertCode int) []map[string]interface{} {
+	resp := app.RequestWithJWT("GET", "/matchings/"+Matching+"/feedback", nil, jwt)
+
+	if AssertCode == 200 && resp.Code != 200 {
+		t.Error("Could not list feedback for matching")
+		return []map[string]interface{}{}
+	}
+	if AssertCode != 200 {
+		if resp.Code != AssertCode {
+			t.Error(fmt.Printf("ListFeedbackForMatching unexpected response %d", resp.Code))
+		}
+		return []map[string]interface{}{}
+	}
+
+	return parseResponseToArray(resp)
+}
+
 // ----------------------------------------------------------------- REGIONS
 
 // [X] CreateRegion - L
@@ -715,6 +1777,8 @@ func UpdateMatchingTest(t *testing.T, jwt string, Matching string, Invalid bool,
 // [X] ListMatchingsForRegion - A
 // [X] PromoteUserToAdminForRegion - A
 // [X] ListAdminsForRegion - A
+// [X] DemoteRegionAdmin - A
+// [X] ListAuditEntriesForRegion - A
 
 func CreateRegionTest(t *testing.T, jwt string, Name string, Desc string, Locations []Location, AssertCode int) string {
 	// create region
@@ -874,6 +1938,35 @@ func PromoteUserToAdminForRegionTest(t *testing.T, jwt string, Email string, Reg
 	return true
 }
 
+func DemoteRegionAdminTest(t *testing.T, jwt string, User string, Region string, AssertCode int) {
+	resp := app.RequestWithJWT("DELETE", "/regions/"+Region+"/admins/"+User, nil, jwt)
+
+	if AssertCode == 200 && resp.Code != 200 {
+		t.Error("Demoting region admin did not work, but should: ", resp.Body.String())
+	}
+	if AssertCode != 200 && resp.Code != AssertCode {
+		t.Error(fmt.Printf("DemoteRegionAdmin unexpected response %d", resp.Code))
+	}
+}
+
+func ListAuditEntriesForRegionTest(t *testing.T, jwt string, Region string, Query string, AssertCode int) []map[string]interface{} {
+	resp := app.RequestWithJWT("GET", "/regions/"+Region+"/audit?"+Query, nil, jwt)
+
+	if AssertCode == 200 && resp.Code != 200 {
+		t.Error("Could not get audit trail of region: ", resp.Body.String())
+		return []map[string]interface{}{}
+	}
+	if AssertCode != 200 {
+		if resp.Code != AssertCode {
+			t.Error(fmt.Printf("ListAuditEntriesForRegion unexpected response %d", resp.Code))
+		}
+		return []map[string]interface{}{}
+	}
+
+	data := parseResponseToArray(resp)
+	return data
+}
+
 func ListAdminsForRegionTest(t *testing.T, jwt string, Region string, AssertCode int) []map[string]interface{} {
 	resp := app.RequestWithJWT("GET", "/regions/"+Region+"/admins", nil, jwt)
 
@@ -892,6 +1985,223 @@ func ListAdminsForRegionTest(t *testing.T, jwt string, Region string, AssertCode
 	return data
 }
 
+func GrantRoleInRegionTest(t *testing.T, jwt string, Email string, Role string, Region string, AssertCode int) map[string]interface{} {
+	grantParams := GrantRolePayload{Email, Role}
+	resp := app.RequestWithJWT("POST", "/regions/"+Region+"/roles", grantParams, jwt)
+
+	if AssertCode == 200 && resp.Code != 200 {
+		t.Error("Granting role in region did not work, but should: ", resp.Body.String())
+		return map[string]interface{}{}
+	}
+	if AssertCode != 200 {
+		if resp.Code != AssertCode {
+			t.Error(fmt.Printf("GrantRoleInRegion unexpected response %d", resp.Code))
+		}
+		return map[string]interface{}{}
+	}
+
+	return parseResponse(resp)
+}
+
+func RevokeRoleInRegionTest(t *testing.T, jwt string, Region string, Role string, User string, AssertCode int) {
+	resp := app.RequestWithJWT("DELETE", "/regions/"+Region+"/roles/"+Role+"/users/"+User, nil, jwt)
+
+	if AssertCode == 200 && resp.Code != 200 {
+		t.Error("Revoking role in region did not work, but should: ", resp.Body.String())
+	}
+	if AssertCode != 200 && resp.Code != AssertCode {
+		t.Error(fmt.Printf("RevokeRoleInRegion unexpected response %d", resp.Code))
+	}
+}
+
+func GrantTrustInRegionTest(t *testing.T, jwt string, Region string, User string, Level string, ExpiresAt string, AssertCode int) map[string]interface{} {
+	grantParams := GrantTrustPayload{Level, "Checked ID card in person", ExpiresAt}
+	resp := app.RequestWithJWT("PUT", "/regions/"+Region+"/users/"+User+"/trust", grantParams, jwt)
+
+	if AssertCode == 200 && resp.Code != 200 {
+		t.Error("GrantTrustInRegion failed ", resp.Body.String())
+		return map[string]interface{}{}
+	}
+	if AssertCode != 200 {
+		if resp.Code != AssertCode {
+			t.Error(fmt.Printf("GrantTrustInRegion unexpected response %d", resp.Code))
+		}
+		return map[string]interface{}{}
+	}
+
+	return parseResponse(resp)
+}
+
+func RevokeTrustInRegionTest(t *testing.T, jwt string, Region string, User string, AssertCode int) {
+	resp := app.RequestWithJWT("DELETE", "/regions/"+Region+"/users/"+User+"/trust", nil, jwt)
+
+	if AssertCode == 200 && resp.Code != 200 {
+		t.Error("RevokeTrustInRegion failed ", resp.Body.String())
+	}
+	if AssertCode != 200 && resp.Code != AssertCode {
+		t.Error(fmt.Printf("RevokeTrustInRegion unexpected response %d", resp.Code))
+	}
+}
+
+func ListTrustInRegionTest(t *testing.T, jwt string, Region string, AssertCode int) []map[string]interface{} {
+	resp := app.RequestWithJWT("GET", "/regions/"+Region+"/trust", nil, jwt)
+
+	if AssertCode == 200 && resp.Code != 200 {
+		t.Error("Could not list trust in region")
+		return []map[string]interface{}{}
+	}
+	if AssertCode != 200 {
+		if resp.Code != AssertCode {
+			t.Error(fmt.Printf("ListTrustInRegion unexpected response %d", resp.Code))
+		}
+		return []map[string]interface{}{}
+	}
+
+	return parseResponseToArray(resp)
+}
+
+func SetTrustRequirementInRegionTest(t *testing.T, jwt string, Region string, Tag string, Level string, AssertCode int) {
+	requirementParams := TrustRequirementPayload{Tag, Level}
+	resp := app.RequestWithJWT("PUT", "/regions/"+Region+"/trust-requirements", requirementParams, jwt)
+
+	if AssertCode == 200 && resp.Code != 200 {
+		t.Error("SetTrustRequirementInRegion failed ", resp.Body.String())
+	}
+	if AssertCode != 200 && resp.Code != AssertCode {
+		t.Error(fmt.Printf("SetTrustRequirementInRegion unexpected response %d", resp.Code))
+	}
+}
+
+func ListTrustRequirementsForRegionTest(t *testing.T, jwt string, Region string, AssertCode int) []map[string]interface{} {
+	resp := app.RequestWithJWT("GET", "/regions/"+Region+"/trust-requirements", nil, jwt)
+
+	if AssertCode == 200 && resp.Code != 200 {
+		t.Error("Could not list trust requirements of region")
+		return []map[string]interface{}{}
+	}
+	if AssertCode != 200 {
+		if resp.Code != AssertCode {
+			t.Error(fmt.Printf("ListTrustRequirementsForRegion unexpected response %d", resp.Code))
+		}
+		return []map[string]interface{}{}
+	}
+
+	return parseResponseToArray(resp)
+}
+
+func ListFlaggedUsersInRegionTest(t *testing.T, jwt string, Region string, AssertCode int) []map[string]interface{} {
+	resp := app.RequestWithJWT("GET", "/regions/"+Region+"/flagged-users", nil, jwt)
+
+	if AssertCode == 200 && resp.Code != 200 {
+		t.Error("Could not list flagged users in region")
+		return []map[string]interface{}{}
+	}
+	if AssertCode != 200 {
+		if resp.Code != AssertCode {
+			t.Error(fmt.Printf("ListFlaggedUsersInRegion unexpected response %d", resp.Code))
+		}
+		return []map[string]interface{}{}
+	}
+
+	return parseResponseToArray(resp)
+}
+
+func ListFeedbackForUserInRegionTest(t *testing.T, jwt string, Region string, User string, AssertCode int) []map[string]interface{} {
+	resp := app.RequestWithJWT("GET", "/regions/"+Region+"/users/"+User+"/feedback", nil, jwt)
+
+	if AssertCode == 200 && resp.Code != 200 {
+		t.Error("Could not list feedback for user in region")
+		return []map[string]interface{}{}
+	}
+	if AssertCode != 200 {
+		if resp.Code != AssertCode {
+			t.Error(fmt.Printf("ListFeedbackForUserInRegion unexpected response %d", resp.Code))
+		}
+		return []map[string]interface{}{}
+	}
+
+	return parseResponseToArray(resp)
+}
+
+func CreateInvitationInRegionTest(t *testing.T, jwt string, Region string, Mail string, Role string, Group string, AssertCode int) (string, string) {
+	invitationParams := InvitationPayload{Mail, Role, Group}
+	resp := app.RequestWithJWT("POST", "/regions/"+Region+"/invitations", invitationParams, jwt)
+
+	if AssertCode == 201 && resp.Code != 201 {
+		t.Error("CreateInvitationInRegion failed ", resp.Body.String())
+		return "", ""
+	}
+	if AssertCode != 201 {
+		if resp.Code != AssertCode {
+			t.Error(fmt.Printf("CreateInvitationInRegion unexpected response %d", resp.Code))
+		}
+		return "", ""
+	}
+
+	data := parseResponse(resp)
+	if _, exists := data["Link"]; exists {
+		t.Error("CreateInvitationInRegion returned invitation link")
+	}
+
+	// The link is only mailed, so we replace its token by one
+	// we know, as if it was read from the invitation mail.
+	token := generateOpaqueToken()
+	app.DB.Model(&db.Invitation{}).Where("\"id\" = ?", data["ID"]).Update("token_hash", hashOpaqueToken(token))
+
+	return data["ID"].(string), token
+}
+
+func ListInvitationsForRegionTest(t *testing.T, jwt string, Region string, AssertCode int) []map[string]interface{} {
+	resp := app.RequestWithJWT("GET", "/regions/"+Region+"/invitations", nil, jwt)
+
+	if AssertCode == 200 && resp.Code != 200 {
+		t.Error("Could not list invitations of region")
+		return []map[string]interface{}{}
+	}
+	if AssertCode != 200 {
+		if resp.Code != AssertCode {
+			t.Error(fmt.Printf("ListInvitationsForRegion unexpected response %d", resp.Code))
+		}
+		return []map[string]interface{}{}
+	}
+
+	return parseResponseToArray(resp)
+}
+
+func RevokeInvitationInRegionTest(t *testing.T, jwt string, Region string, Invitation string, AssertCode int) {
+	resp := app.RequestWithJWT("DELETE", "/regions/"+Region+"/invitations/"+Invitation, nil, jwt)
+
+	if AssertCode == 200 && resp.Code != 200 {
+		t.Error("RevokeInvitationInRegion failed ", resp.Body.String())
+	}
+	if AssertCode != 200 && resp.Code != AssertCode {
+		t.Error(fmt.Printf("RevokeInvitationInRegion unexpected response %d", resp.Code))
+	}
+}
+
+func AcceptInvitationTest(t *testing.T, jwt string, Token string, Name string, Password string, AssertCode int) map[string]interface{} {
+	acceptParams := AcceptInvitationPayload{
+		Token:    Token,
+		Name:     Name,
+		Password: Password,
+	}
+
+	var resp = app.Request("PUT", "/invitations", acceptParams)
+	if jwt != "" {
+		resp = app.RequestWithJWT("PUT", "/invitations", acceptParams, jwt)
+	}
+
+	if resp.Code != AssertCode {
+		t.Error(fmt.Printf("AcceptInvitation unexpected response %d", resp.Code))
+		return map[string]interface{}{}
+	}
+	if AssertCode != 200 && AssertCode != 201 {
+		return map[string]interface{}{}
+	}
+
+	return parseResponse(resp)
+}
+
 // ------------------------------------------------------------------------------- ME
 
 // [X] GetMe - L
@@ -907,13 +2217,19 @@ func GetMeTest(t *testing.T, jwt string, AssertCode int) map[string]interface{}
 		t.Error("GetMe fail ", resp.Body.String())
 		return map[string]interface{}{}
 	}
+	if AssertCode == 401 {
+		if resp.Code != 401 {
+			t.Error("GetMe should return UnAuthorized but didnt")
+		}
+		return map[string]interface{}{}
+	}
 
 	data := parseResponse(resp)
 	return data
 }
 
 func UpdateMeTest(t *testing.T, jwt string, Name string, PreferredName string, Mail string,
-	PhoneNumbers []string, Password string, Groups []GroupPayload, AssertCode int) map[string]interface{} {
+	PhoneNumbers []PhoneNumberPayload, Password string, Groups []GroupPayload, AssertCode int) map[string]interface{} {
 
 	updateParams := UpdateUserPayload{
 		Name,
@@ -1070,17 +2386,189 @@ func TestSetupAlpha(t *testing.T) {
 	CreateUserTest(t, emailRegionAdmin, "LetMeAdminAllYourHelp666!", "AdminMate", 0)
 	userRegionAdmin = LoginTest(t, emailRegionAdmin, "LetMeAdminAllYourHelp666!", 200)
 
+	// INVALID: CreateUser with password violating our password policy
+	CreateUserTest(t, fmt.Sprintf("policy-%s@test.org", uuid.NewV4()), "Short1!", "PolicyPerson", 400)
+	CreateUserTest(t, fmt.Sprintf("policy-%s@test.org", uuid.NewV4()), "IAmPolicyPersonAndProud666!", "PolicyPerson", 400)
+
 	// VALID GetMe
 	regionAdminResp := GetMeTest(t, userRegionAdmin, 200)
 	if regionAdminResp["Mail"] != emailRegionAdmin {
 		t.Error("CreateUser followed by GetUser: comparing email for region admin failed")
 	}
 
+	// INVALID: UpdateMe with invalid phone number
+	UpdateMeTest(t, userRegionAdmin, "", "", "", []PhoneNumberPayload{{Number: "+49 30 23125000"}, {Number: "12"}}, "", nil, 400)
+	UpdateMeTest(t, userRegionAdmin, "", "", "", []PhoneNumberPayload{{Number: "+49 30 23125000", Label: "fax"}}, "", nil, 400)
+	// VALID: UpdateMe stores phone numbers in E.164
+	updatedMe := UpdateMeTest(t, userRegionAdmin, "", "", "", []PhoneNumberPayload{{Number: "+49 (30) 231-25000", Label: "Landline"}}, "", nil, 200)
+	if numbers, ok := updatedMe["PhoneNumbers"].([]interface{}); !ok || len(numbers) != 1 ||
+		numbers[0].(map[string]interface{})["Number"] != "+493023125000" || numbers[0].(map[string]interface{})["Label"] != db.PhoneLabelLandline {
+		t.Error("UpdateMe did not normalise phone number")
+	}
+
+	// VALID: JWT carries ID of user as subject
+	regionAdminClaims := ParseJWTTest(t, userRegionAdmin)
+	if regionAdminClaims["sub"] != regionAdminResp["ID"] {
+		t.Error("JWT subject does not match ID of region admin")
+	}
+
+	// VALID: GetJWKS publishes the current signing key
+	kid, _ := app.Keyring.Current()
+	kidFound := false
+	for _, key := range GetJWKSTest(t, 200) {
+		if key.(map[string]interface{})["kid"] == kid {
+			kidFound = true
+		}
+	}
+	if !kidFound {
+		t.Error("GetJWKS did not contain current signing key")
+	}
+
+	// VALID: Rotating the signing key keeps issued JWTs valid
+	app.Keyring.Rotate()
+	if newKid, _ := app.Keyring.Current(); newKid == kid {
+		t.Error("Keyring rotation did not change signing key")
+	}
+	GetMeTest(t, userRegionAdmin, 200)
+
+	// VALID: Keys created by another instance are picked up on first use
+	otherKeyring := NewKeyring(app.DB, app.Keyring.RotateAfter, app.Keyring.VerifyFor)
+	otherKeyring.Rotate()
+	otherKid, _ := otherKeyring.Current()
+	app.Keyring.loadedAt = time.Time{}
+	if _, ok := app.Keyring.PublicKey(otherKid); !ok {
+		t.Error("Keyring did not reload signing key of other instance")
+	}
+	GetMeTest(t, userRegionAdmin, 200)
+
+	// VALID: Logout revokes the used JWT
+	userLoggedOut := LoginTest(t, emailRegionAdmin, "LetMeAdminAllYourHelp666!", 200)
+	LogoutTest(t, userLoggedOut, 200)
+	// INVALID: Use revoked JWT
+	GetMeTest(t, userLoggedOut, 401)
+	LogoutTest(t, userLoggedOut, 401)
+
+	// VALID: Exchange refresh token
+	refreshFirst := LoginRefreshTokenTest(t, emailRegionAdmin, "LetMeAdminAllYourHelp666!")
+	refreshSecond := RefreshTokenTest(t, refreshFirst, 200)
+	// INVALID: Reuse refresh token, revokes the whole session
+	RefreshTokenTest(t, refreshFirst, 400)
+	RefreshTokenTest(t, refreshSecond, 400)
+	var reusedToken db.RefreshToken
+	var reusedSession db.Session
+	app.DB.First(&reusedToken, "\"token_hash\" = ?", hashOpaqueToken(refreshFirst))
+	app.DB.First(&reusedSession, "\"id\" = ?", reusedToken.FamilyID)
+	if !reusedSession.Revoked {
+		t.Error("Reuse of refresh token did not revoke its session")
+	}
+
+	// VALID: LogoutAll revokes all JWTs of a user
+	CreateUserTest(t, "sessions@test.org", "ManyDevicesManyProblems666!", "SessionGuy", 0)
+	userSessionFirst := LoginTest(t, "sessions@test.org", "ManyDevicesManyProblems666!", 200)
+	userSessionSecond := LoginTest(t, "sessions@test.org", "ManyDevicesManyProblems666!", 200)
+	LogoutAllTest(t, userSessionSecond, 200)
+	// INVALID: Use JWTs issued before LogoutAll
+	GetMeTest(t, userSessionFirst, 401)
+	GetMeTest(t, userSessionSecond, 401)
+	// VALID: Log in again right after LogoutAll
+	userSessionThird := LoginTest(t, "sessions@test.org", "ManyDevicesManyProblems666!", 200)
+	GetMeTest(t, userSessionThird, 200)
+
+	// VALID: ListSessions shows every login of a user
+	deviceMail := fmt.Sprintf("devices-%s@test.org", uuid.NewV4())
+	CreateUserTest(t, deviceMail, "MyPhoneGotLostInTheFlood666!", "DeviceGuy", 0)
+	userPhone := LoginTest(t, deviceMail, "MyPhoneGotLostInTheFlood666!", 200)
+	userLaptop := LoginTest(t, deviceMail, "MyPhoneGotLostInTheFlood666!", 200)
+	sessions := ListSessionsTest(t, userLaptop, 200)
+	if len(sessions) != 2 {
+		t.Error("ListSessions did not return both sessions")
+	}
+	phoneSession := ""
+	for _, session := range sessions {
+		if session["Current"] != true {
+			phoneSession, _ = session["ID"].(string)
+		}
+	}
+	if phoneSession == "" {
+		t.Error("ListSessions did not mark exactly one current session")
+	}
+	// INVALID: DeleteSession of another user
+	DeleteSessionTest(t, userOffering, phoneSession, 404)
+	// VALID: DeleteSession signs out the lost phone only
+	DeleteSessionTest(t, userLaptop, phoneSession, 200)
+	GetMeTest(t, userPhone, 401)
+	GetMeTest(t, userLaptop, 200)
+	DeleteSessionTest(t, userLaptop, phoneSession, 404)
+	if len(ListSessionsTest(t, userLaptop, 200)) != 1 {
+		t.Error("ListSessions still contains signed out session")
+	}
+
+	// VALID: ExportMe contains profile and sessions of user
+	export := ExportMeTest(t, userLaptop, "", 200)
+	if profile, ok := export["Profile"].(map[string]interface{}); !ok || profile["Mail"] != deviceMail {
+		t.Error("ExportMe did not contain profile of user")
+	}
+	if sessions, ok := export["Sessions"].([]interface{}); !ok || len(sessions) != 2 {
+		t.Error("ExportMe did not contain both sessions of user")
+	}
+	ExportMeTest(t, userLaptop, "zip", 200)
+	// INVALID: ExportMe in unknown format
+	ExportMeTest(t, userLaptop, "xml", 400)
+	// INVALID: DeleteMe with wrong password
+	DeleteMeTest(t, userLaptop, "MyLaptopGotLostInTheFlood666!", "", 400)
+	GetMeTest(t, userLaptop, 200)
+	// VALID: DeleteMe anonymises user and signs out everywhere
+	DeleteMeTest(t, userLaptop, "MyPhoneGotLostInTheFlood666!", "", 200)
+	GetMeTest(t, userLaptop, 401)
+	LoginTest(t, deviceMail, "MyPhoneGotLostInTheFlood666!", 400)
+	// Mail address can be used for a new account again
+	CreateUserTest(t, deviceMail, "MyPhoneGotLostInTheFlood666!", "DeviceGuy", 200)
+
+	// VALID: Enroll in two-factor authentication
+	twoFactorMail := fmt.Sprintf("totp-%s@test.org", uuid.NewV4())
+	CreateUserTest(t, twoFactorMail, "TwoFactorsAreBetterThanOne666!", "TwoFactorFan", 0)
+	userTwoFactor := LoginTest(t, twoFactorMail, "TwoFactorsAreBetterThanOne666!", 200)
+	totpSecret := StartTwoFactorEnrollmentTest(t, userTwoFactor, 200)
+	// INVALID: Confirm enrollment with wrong code
+	ConfirmTwoFactorEnrollmentTest(t, userTwoFactor, "000000", 400)
+	totpCurrent, _ := totpCode(totpSecret, (time.Now().Unix() / totpStep))
+	recoveryCodes := ConfirmTwoFactorEnrollmentTest(t, userTwoFactor, totpCurrent, 200)
+	// INVALID: Start enrollment again
+	StartTwoFactorEnrollmentTest(t, userTwoFactor, 400)
+
+	// VALID: Login with recovery code as second factor
+	challengeToken := LoginChallengeTest(t, twoFactorMail, "TwoFactorsAreBetterThanOne666!")
+	if len(recoveryCodes) > 0 {
+		LoginSecondFactorTest(t, challengeToken, recoveryCodes[0].(string), 200)
+		// INVALID: Reuse recovery code
+		challengeToken = LoginChallengeTest(t, twoFactorMail, "TwoFactorsAreBetterThanOne666!")
+		LoginSecondFactorTest(t, challengeToken, recoveryCodes[0].(string), 400)
+	}
+	// INVALID: Reuse challenge token
+	LoginSecondFactorTest(t, challengeToken, totpCurrent, 400)
+	// INVALID: LoginSecondFactor with unknown challenge token
+	LoginSecondFactorTest(t, "thisisnotavalidtoken", totpCurrent, 400)
+
 	// INVALID: Login superadmin
 	LoginTest(t, "admin@example.org", "nonononooo", 400)
 	// VALID: Login superadmin
 	userSuperAdmin = LoginTest(t, "admin@example.org", "CaTUstrophyAdmin123$", 200)
 
+	// VALID: RequestVerification for unverified user
+	RequestVerificationTest(t, userOffering, 200)
+	// INVALID: RequestVerification for already verified superadmin
+	RequestVerificationTest(t, userSuperAdmin, 400)
+	// INVALID: ConfirmVerification with unknown token
+	ConfirmVerificationTest(t, "thisisnotavalidtoken", 400)
+
+	// VALID: RequestPasswordReset, same response for known and unknown mails
+	RequestPasswordResetTest(t, "offering@test.org", 200)
+	RequestPasswordResetTest(t, "nobody@donotexist.com", 200)
+	// INVALID: RequestPasswordReset without mail
+	RequestPasswordResetTest(t, "", 400)
+	// INVALID: ConfirmPasswordReset with unknown token
+	ConfirmPasswordResetTest(t, "thisisnotavalidtoken", "ICanOfferAllThemHelp777!", 400)
+
 	// INVALID: CreateRegion
 	CreateRegionTest(t, userRegionAdmin, "", "", []Location{}, 400)
 	// VALID: CreateRegion
@@ -1118,20 +2606,384 @@ func TestSetupAlpha(t *testing.T) {
 	// VALID: PromoteUserToAdminForRegion
 	PromoteUserToAdminForRegionTest(t, userSuperAdmin, emailRegionAdmin, regionID, 200)
 
+	// VALID: ListPermissions and ListRoles contain the built-in ones
+	ListPermissionsTest(t, userRegionAdmin, 401)
+	if len(ListPermissionsTest(t, userSuperAdmin, 200)) != len(db.DefaultPermissions) {
+		t.Error("ListPermissions did not return all permissions")
+	}
+	ListRolesTest(t, userRegionAdmin, 401)
+	if len(ListRolesTest(t, userSuperAdmin, 200)) < len(db.DefaultRoles) {
+		t.Error("ListRoles did not return all built-in roles")
+	}
+
+	// INVALID: CreateRole
+	roleName := fmt.Sprintf("auditor-%s", uuid.NewV4())
+	CreateRoleTest(t, userRegionAdmin, roleName, []string{db.PermissionItemRead}, 401)
+	CreateRoleTest(t, userSuperAdmin, roleName, []string{"nothing:everywhere"}, 400)
+	// VALID: CreateRole
+	CreateRoleTest(t, userSuperAdmin, roleName, []string{db.PermissionItemRead}, 201)
+	// INVALID: CreateRole with existing name
+	CreateRoleTest(t, userSuperAdmin, roleName, []string{db.PermissionItemRead}, 400)
+
+	// VALID: GrantRoleInRegion lets observers view a region without changing it
+	CreateUserTest(t, "observer@test.org", "IOnlyWatchAllThemHelp666!", "Watcher", 0)
+	userObserver := LoginTest(t, "observer@test.org", "IOnlyWatchAllThemHelp666!", 200)
+	ListOffersForRegionTest(t, userObserver, regionID, 401)
+	// INVALID: GrantRoleInRegion
+	GrantRoleInRegionTest(t, userOffering, "observer@test.org", db.RoleObserver, regionID, 401)
+	GrantRoleInRegionTest(t, userRegionAdmin, "observer@test.org", db.RoleSuperadmin, regionID, 403)
+	GrantRoleInRegionTest(t, userRegionAdmin, "nobody@donotexist.com", db.RoleObserver, regionID, 404)
+	if GrantRoleInRegionTest(t, userRegionAdmin, "observer@test.org", db.RoleObserver, regionID, 200)["Mail"] == "observer@test.org" {
+		t.Error("GrantRoleInRegion revealed contact details of granted user")
+	}
+	ListOffersForRegionTest(t, userObserver, regionID, 200)
+	PromoteUserToAdminForRegionTest(t, userObserver, "observer@test.org", regionID, 401)
+
+	// INVALID: RevokeRoleInRegion
+	observerID, _ := GetMeTest(t, userObserver, 200)["ID"].(string)
+	RevokeRoleInRegionTest(t, userOffering, regionID, db.RoleObserver, observerID, 401)
+	RevokeRoleInRegionTest(t, userRegionAdmin, regionID, "nosuchrole", observerID, 404)
+	RevokeRoleInRegionTest(t, userRegionAdmin, regionID, db.RoleCoordinator, observerID, 404)
+	// VALID: RevokeRoleInRegion takes privileges away immediately
+	RevokeRoleInRegionTest(t, userRegionAdmin, regionID, db.RoleObserver, observerID, 200)
+	ListOffersForRegionTest(t, userObserver, regionID, 401)
+	RevokeRoleInRegionTest(t, userRegionAdmin, regionID, db.RoleObserver, observerID, 404)
+	GrantRoleInRegionTest(t, userRegionAdmin, "observer@test.org", db.RoleObserver, regionID, 200)
+
+	// VALID: DemoteRegionAdmin takes privileges away immediately
+	PromoteUserToAdminForRegionTest(t, userRegionAdmin, "observer@test.org", regionID, 200)
+	// INVALID: DemoteRegionAdmin
+	DemoteRegionAdminTest(t, userOffering, observerID, regionID, 401)
+	DemoteRegionAdminTest(t, userRegionAdmin, observerID+"a", regionID, 400)
+	DemoteRegionAdminTest(t, userRegionAdmin, observerID, regionID, 200)
+	DemoteRegionAdminTest(t, userRegionAdmin, observerID, regionID, 404)
+	PromoteUserToAdminForRegionTest(t, userObserver, "observer@test.org", regionID, 401)
+
+	// VALID: ListAuditEntriesForRegion shows who promoted and demoted whom
+	regionAdminID, _ := GetMeTest(t, userRegionAdmin, 200)["ID"].(string)
+	ListAuditEntriesForRegionTest(t, userOffering, regionID, "", 401)
+	ListAuditEntriesForRegionTest(t, userRegionAdmin, regionID, "limit=0", 400)
+	promotions := ListAuditEntriesForRegionTest(t, userRegionAdmin, regionID, "action="+db.AuditRegionAdminPromote+"&target="+observerID, 200)
+	if len(promotions) == 0 || promotions[0]["ActorID"] != regionAdminID {
+		t.Error("ListAuditEntriesForRegion did not record promotion by region admin")
+	}
+	demotions := ListAuditEntriesForRegionTest(t, userRegionAdmin, regionID, "action="+db.AuditRegionAdminDemote+"&target="+observerID, 200)
+	if len(demotions) == 0 || demotions[0]["ActorID"] != regionAdminID {
+		t.Error("ListAuditEntriesForRegion did not record demotion by region admin")
+	}
+	// INVALID: ListAuditEntries is only available to system admins
+	ListAuditEntriesTest(t, userRegionAdmin, "", 401)
+	ListAuditEntriesTest(t, userSuperAdmin, "before=yesterday", 400)
+	ListAuditEntriesTest(t, userSuperAdmin, "cursor=yesterday", 400)
+	// VALID: ListAuditEntries
+	firstAuditPage, auditCursor := ListAuditEntriesTest(t, userSuperAdmin, "region="+regionID+"&limit=1", 200)
+	if len(firstAuditPage) != 1 {
+		t.Error("ListAuditEntries did not respect limit or region")
+	}
+	if auditCursor == "" {
+		t.Error("ListAuditEntries did not send cursor to next page")
+	}
+	// VALID: ListAuditEntries continues behind cursor
+	secondAuditPage, _ := ListAuditEntriesTest(t, userSuperAdmin, "region="+regionID+"&limit=1&cursor="+auditCursor, 200)
+	if len(firstAuditPage) == 1 && len(secondAuditPage) == 1 && secondAuditPage[0]["ID"] == firstAuditPage[0]["ID"] {
+		t.Error("ListAuditEntries did not continue after cursor")
+	}
+
+	// VALID: ListUsersInRegion finds observer with groups of this region only
+	ListUsersInRegionTest(t, userOffering, regionID, "", 401)
+	ListUsersInRegionTest(t, userRegionAdmin, regionID, "sort=age", 400)
+	regionUsers := ListUsersInRegionTest(t, userRegionAdmin, regionID, "q=OBSERVER@test.org", 200)
+	if len(regionUsers) != 1 || regionUsers[0]["ID"] != observerID {
+		t.Error("ListUsersInRegion did not find observer by mail")
+	}
+	// VALID: ListUsersInRegion does not find masked mail by part of it
+	if len(ListUsersInRegionTest(t, userRegionAdmin, regionID, "q=observer@test.o", 200)) != 0 {
+		t.Error("ListUsersInRegion found user by part of mail address")
+	}
+	for _, user := range regionUsers {
+		groups, _ := user["Groups"].([]interface{})
+		for _, group := range groups {
+			if group.(map[string]interface{})["Region"].(map[string]interface{})["ID"] != regionID {
+				t.Error("ListUsersInRegion contained group of other region")
+			}
+		}
+		if user["ContactMasked"] != true || user["Mail"] == "observer@test.org" {
+			t.Error("ListUsersInRegion did not mask contact details of unmatched user")
+		}
+	}
+	// INVALID: RevealContactInRegion
+	RevealContactInRegionTest(t, userOffering, regionID, observerID, "Needs to be reached", 401)
+	RevealContactInRegionTest(t, userRegionAdmin, regionID, observerID, " ", 400)
+	RevealContactInRegionTest(t, userRegionAdmin, regionID, fmt.Sprintf("%s", uuid.NewV4()), "Needs to be reached", 404)
+	// VALID: RevealContactInRegion is recorded in audit trail
+	contact := RevealContactInRegionTest(t, userRegionAdmin, regionID, observerID, "Needs to be reached", 200)
+	if contact["Mail"] != "observer@test.org" {
+		t.Error("RevealContactInRegion did not reveal mail")
+	}
+	if len(ListAuditEntriesForRegionTest(t, userRegionAdmin, regionID, "action="+db.AuditUserContactReveal+"&target="+observerID, 200)) == 0 {
+		t.Error("ListAuditEntriesForRegion did not record contact reveal")
+	}
+	// VALID: CreateOrganisation makes creator its owner
+	ownerMail := fmt.Sprintf("org-owner-%s@test.org", uuid.NewV4())
+	memberMail := fmt.Sprintf("org-member-%s@test.org", uuid.NewV4())
+	CreateUserTest(t, ownerMail, "WeHelpTogether666!", "Owner", 0)
+	CreateUserTest(t, memberMail, "WeHelpTogether666!", "Member", 0)
+	userOwner := LoginTest(t, ownerMail, "WeHelpTogether666!", 200)
+	userMember := LoginTest(t, memberMail, "WeHelpTogether666!", 200)
+	ownerID, _ := GetMeTest(t, userOwner, 200)["ID"].(string)
+	memberID, _ := GetMeTest(t, userMember, 200)["ID"].(string)
+	organisationName := fmt.Sprintf("Relief Team %s", uuid.NewV4())
+	organisationID := CreateOrganisationTest(t, userOwner, organisationName, 201)
+	// INVALID: CreateOrganisation
+	CreateOrganisationTest(t, userMember, organisationName, 400)
+	CreateOrganisationTest(t, userMember, "", 400)
+	// INVALID: SetOrganisationMember
+	SetOrganisationMemberTest(t, userMember, organisationID, memberMail, db.OrganisationRoleMember, 401)
+	SetOrganisationMemberTest(t, userOwner, organisationID, memberMail, "chief", 400)
+	SetOrganisationMemberTest(t, userOwner, organisationID, "nobody@test.org", db.OrganisationRoleMember, 404)
+	ListOrganisationMembersTest(t, userMember, organisationID, 401)
+	// VALID: SetOrganisationMember
+	SetOrganisationMemberTest(t, userOwner, organisationID, memberMail, db.OrganisationRoleMember, 200)
+	if len(ListOrganisationMembersTest(t, userMember, organisationID, 200)) != 2 {
+		t.Error("ListOrganisationMembers did not list all members")
+	}
+	for _, member := range ListOrganisationMembersTest(t, userOwner, organisationID, 200) {
+		if member["User"].(map[string]interface{})["ID"] == memberID && member["User"].(map[string]interface{})["Mail"] == memberMail {
+			t.Error("ListOrganisationMembers revealed contact details of fellow member")
+		}
+	}
+	// INVALID: The last owner can neither leave nor be demoted
+	RemoveOrganisationMemberTest(t, userOwner, organisationID, ownerID, 400)
+	SetOrganisationMemberTest(t, userOwner, organisationID, ownerMail, db.OrganisationRoleMember, 400)
+	// INVALID: Offer on behalf of an organisation one is no member of
+	validity := time.Now().Add(48 * time.Hour).Format(time.RFC3339)
+	CreateOfferTest(t, userOffering, "Blankets x20", gormGIS.GeoPoint{10.2, .0}, 20.3, validity, organisationID, 400)
+	// VALID: Every member may handle offers of the organisation
+	organisationOfferID := CreateOfferTest(t, userMember, "Blankets x20", gormGIS.GeoPoint{10.2, .0}, 20.3, validity, organisationID, 201)
+	GetOfferTest(t, userOwner, organisationOfferID, 200)
+	GetOfferTest(t, userOffering, organisationOfferID, 401)
+	if len(ListOrganisationOffersTest(t, userOwner, organisationID, 200)) != 1 {
+		t.Error("ListOrganisationOffers did not list offer of organisation")
+	}
+	// INVALID: GrantRoleToOrganisationInRegion
+	GrantRoleToOrganisationInRegionTest(t, userOwner, regionID, organisationID, db.RoleObserver, 401)
+	GrantRoleToOrganisationInRegionTest(t, userRegionAdmin, regionID, fmt.Sprintf("%s", uuid.NewV4()), db.RoleObserver, 404)
+	// VALID: Members inherit roles of their organisation
+	ListOffersForRegionTest(t, userMember, regionID, 401)
+	GrantRoleToOrganisationInRegionTest(t, userRegionAdmin, regionID, organisationID, db.RoleObserver, 200)
+	ListOffersForRegionTest(t, userMember, regionID, 200)
+	// VALID: Members may leave and lose the roles of their organisation
+	RemoveOrganisationMemberTest(t, userMember, organisationID, memberID, 200)
+	ListOffersForRegionTest(t, userMember, regionID, 401)
+	RemoveOrganisationMemberTest(t, userMember, organisationID, memberID, 404)
+	// INVALID: Owners can not hand out roles of their organisation they can not grant
+	SetOrganisationMemberTest(t, userOwner, organisationID, memberMail, db.OrganisationRoleMember, 403)
+	// VALID: Those who may grant the roles can add members
+	SetOrganisationMemberTest(t, userSuperAdmin, organisationID, memberMail, db.OrganisationRoleMember, 200)
+	ListOffersForRegionTest(t, userMember, regionID, 200)
+	// INVALID: RevokeRoleFromOrganisationInRegion
+	RevokeRoleFromOrganisationInRegionTest(t, userOwner, regionID, db.RoleObserver, organisationID, 401)
+	RevokeRoleFromOrganisationInRegionTest(t, userRegionAdmin, regionID, db.RoleObserver, fmt.Sprintf("%s", uuid.NewV4()), 404)
+	// VALID: RevokeRoleFromOrganisationInRegion takes roles away from all members
+	RevokeRoleFromOrganisationInRegionTest(t, userRegionAdmin, regionID, db.RoleObserver, organisationID, 200)
+	ListOffersForRegionTest(t, userMember, regionID, 401)
+	RevokeRoleFromOrganisationInRegionTest(t, userRegionAdmin, regionID, db.RoleObserver, organisationID, 404)
+	GrantRoleToOrganisationInRegionTest(t, userRegionAdmin, regionID, organisationID, db.RoleObserver, 200)
+	RemoveOrganisationMemberTest(t, userMember, organisationID, memberID, 200)
+	// VALID: DeleteMe moves offers made on behalf of an organisation to an owner
+	leaverMail := fmt.Sprintf("org-leaver-%s@test.org", uuid.NewV4())
+	CreateUserTest(t, leaverMail, "WeHelpTogether666!", "Leaver", 0)
+	userLeaver := LoginTest(t, leaverMail, "WeHelpTogether666!", 200)
+	SetOrganisationMemberTest(t, userSuperAdmin, organisationID, leaverMail, db.OrganisationRoleMember, 200)
+	leaverOfferID := CreateOfferTest(t, userLeaver, "Tents x5", gormGIS.GeoPoint{10.2, .0}, 20.3, validity, organisationID, 201)
+	DeleteMeTest(t, userLeaver, "WeHelpTogether666!", "", 200)
+	var leaverOffer db.Offer
+	app.DB.First(&leaverOffer, "\"id\" = ?", leaverOfferID)
+	if leaverOffer.UserID != ownerID {
+		t.Error("DeleteMe did not move offer of organisation to its owner")
+	}
+
+	// INVALID: GrantTrustInRegion
+	trustExpiry := time.Now().Add(30 * 24 * time.Hour).Format(time.RFC3339)
+	GrantTrustInRegionTest(t, userOffering, regionID, memberID, db.TrustLevelVerified, trustExpiry, 401)
+	GrantTrustInRegionTest(t, userRegionAdmin, regionID, memberID, "trustworthy", trustExpiry, 400)
+	GrantTrustInRegionTest(t, userRegionAdmin, regionID, memberID, db.TrustLevelVerified, "2016-11-01T22:08:41+00:00", 400)
+	GrantTrustInRegionTest(t, userRegionAdmin, regionID, fmt.Sprintf("%s", uuid.NewV4()), db.TrustLevelVerified, trustExpiry, 404)
+	// VALID: GrantTrustInRegion replaces the current trust level
+	GrantTrustInRegionTest(t, userRegionAdmin, regionID, memberID, db.TrustLevelVerified, trustExpiry, 200)
+	grant := GrantTrustInRegionTest(t, userRegionAdmin, regionID, memberID, db.TrustLevelVetted, trustExpiry, 200)
+	trustedCount := 0
+	for _, trusted := range ListTrustInRegionTest(t, userRegionAdmin, regionID, 200) {
+		if trusted["UserID"] == memberID {
+			trustedCount++
+			if trusted["ID"] != grant["ID"] || trusted["Level"] != db.TrustLevelVetted {
+				t.Error("ListTrustInRegion did not list newest trust level")
+			}
+		}
+	}
+	if trustedCount != 1 {
+		t.Error("ListTrustInRegion did not list exactly one trust level per user")
+	}
+	// VALID: RevokeTrustInRegion
+	RevokeTrustInRegionTest(t, userRegionAdmin, regionID, memberID, 200)
+	RevokeTrustInRegionTest(t, userRegionAdmin, regionID, memberID, 404)
+	// INVALID: SetTrustRequirementInRegion
+	SetTrustRequirementInRegionTest(t, userOffering, regionID, "Children", db.TrustLevelVerified, 401)
+	SetTrustRequirementInRegionTest(t, userRegionAdmin, regionID, "Children", "trustworthy", 400)
+	SetTrustRequirementInRegionTest(t, userRegionAdmin, regionID, "NoSuchTag", db.TrustLevelVerified, 404)
+	// VALID: SetTrustRequirementInRegion and drop it again
+	SetTrustRequirementInRegionTest(t, userRegionAdmin, regionID, "Children", db.TrustLevelVerified, 200)
+	if requirements := ListTrustRequirementsForRegionTest(t, userRegionAdmin, regionID, 200); len(requirements) != 1 || requirements[0]["Tag"] != "Children" {
+		t.Error("ListTrustRequirementsForRegion did not list requirement")
+	}
+	SetTrustRequirementInRegionTest(t, userRegionAdmin, regionID, "Children", "", 200)
+	if len(ListTrustRequirementsForRegionTest(t, userRegionAdmin, regionID, 200)) != 0 {
+		t.Error("SetTrustRequirementInRegion did not drop requirement")
+	}
+
+	// INVALID: CreateInvitationInRegion
+	inviteMail := fmt.Sprintf("invited-%s@test.org", uuid.NewV4())
+	CreateInvitationInRegionTest(t, userOffering, regionID, inviteMail, db.RoleObserver, "", 401)
+	CreateInvitationInRegionTest(t, userRegionAdmin, regionID, inviteMail, "", "", 400)
+	CreateInvitationInRegionTest(t, userRegionAdmin, regionID, inviteMail, db.RoleSuperadmin, "", 403)
+	CreateInvitationInRegionTest(t, userRegionAdmin, regionID, inviteMail, "", fmt.Sprintf("%s", uuid.NewV4()), 404)
+	// VALID: CreateInvitationInRegion for mail without account
+	invitationID, inviteToken := CreateInvitationInRegionTest(t, userRegionAdmin, regionID, inviteMail, db.RoleObserver, "", 201)
+	// INVALID: AcceptInvitation
+	AcceptInvitationTest(t, "", "thisisnotavalidtoken", "Invited", "WeHelpTogether666!", 400)
+	AcceptInvitationTest(t, "", inviteToken, "", "WeHelpTogether666!", 400)
+	// VALID: AcceptInvitation creates verified account holding the role
+	invited := AcceptInvitationTest(t, "", inviteToken, "Invited", "WeHelpTogether666!", 201)
+	if invited["Mail"] != inviteMail || invited["MailVerified"] != true {
+		t.Error("AcceptInvitation did not create verified account for invited mail")
+	}
+	userInvited := LoginTest(t, inviteMail, "WeHelpTogether666!", 200)
+	ListOffersForRegionTest(t, userInvited, regionID, 200)
+	// INVALID: AcceptInvitation and RevokeInvitationInRegion after acceptance
+	AcceptInvitationTest(t, "", inviteToken, "Invited", "WeHelpTogether666!", 400)
+	RevokeInvitationInRegionTest(t, userRegionAdmin, regionID, invitationID, 400)
+	// INVALID: AcceptInvitation by logged-in user with other mail
+	_, inviteToken = CreateInvitationInRegionTest(t, userRegionAdmin, regionID, fmt.Sprintf("other-%s@test.org", uuid.NewV4()), db.RoleObserver, "", 201)
+	AcceptInvitationTest(t, userMember, inviteToken, "", "", 403)
+	ListOffersForRegionTest(t, userMember, regionID, 401)
+	// VALID: AcceptInvitation attaches role to logged-in user with invited mail
+	_, inviteToken = CreateInvitationInRegionTest(t, userRegionAdmin, regionID, strings.ToUpper(inviteMail), db.RoleCoordinator, "", 201)
+	AcceptInvitationTest(t, userInvited, inviteToken, "", "", 200)
+	// VALID: RevokeInvitationInRegion
+	invitationID, inviteToken = CreateInvitationInRegionTest(t, userRegionAdmin, regionID, fmt.Sprintf("revoked-%s@test.org", uuid.NewV4()), db.RoleObserver, "", 201)
+	RevokeInvitationInRegionTest(t, userOffering, regionID, invitationID, 401)
+	RevokeInvitationInRegionTest(t, userRegionAdmin, regionID, invitationID, 200)
+	RevokeInvitationInRegionTest(t, userRegionAdmin, regionID, invitationID, 404)
+	AcceptInvitationTest(t, "", inviteToken, "Revoked", "WeHelpTogether666!", 400)
+	// VALID: ListInvitationsForRegion
+	ListInvitationsForRegionTest(t, userOffering, regionID, 401)
+	if len(ListInvitationsForRegionTest(t, userRegionAdmin, regionID, 200)) < 3 {
+		t.Error("ListInvitationsForRegion did not list all invitations")
+	}
+
+	// INVALID: ListUsers is only available to system admins
+	ListUsersTest(t, userRegionAdmin, "", 401)
+	ListUsersTest(t, userSuperAdmin, "enabled=maybe", 400)
+	// VALID: ListUsers pages through users with cursor
+	firstPage, cursor := ListUsersTest(t, userSuperAdmin, "sort=-mail&limit=1", 200)
+	if len(firstPage) != 1 || cursor == "" {
+		t.Error("ListUsers did not respect limit or return cursor")
+	}
+	secondPage, _ := ListUsersTest(t, userSuperAdmin, "sort=-mail&limit=1&cursor="+cursor, 200)
+	if len(firstPage) == 1 && len(secondPage) == 1 && secondPage[0]["ID"] == firstPage[0]["ID"] {
+		t.Error("ListUsers did not continue after cursor")
+	}
+	// INVALID: ListUsers with cursor of other sort
+	ListUsersTest(t, userSuperAdmin, "sort=mail&cursor="+cursor, 400)
+
 	// VALID ListSystemAdmins
 	admins := ListSystemAdminsTest(t, userSuperAdmin, 200)
 	if len(admins) == 0 {
 		t.Error("ListSystemAdmins returned no SuperAdmins")
 	}
+
+	// INVALID: DemoteSystemAdmin
+	superAdminID, _ := GetMeTest(t, userSuperAdmin, 200)["ID"].(string)
+	DemoteSystemAdminTest(t, userRegionAdmin, superAdminID, 401)
+	DemoteSystemAdminTest(t, userSuperAdmin, regionAdminID, 404)
+	// INVALID: Demote the last system admin
+	if len(admins) == 1 {
+		DemoteSystemAdminTest(t, userSuperAdmin, superAdminID, 400)
+
+		// INVALID: Last system admin drops own system admin group
+		var otherGroup db.Group
+		app.DB.First(&otherGroup, "\"access_right\" <> ?", db.RoleSuperadmin)
+		UpdateUserTest(t, userSuperAdmin, superAdminID, "", "", "", nil, "", []GroupPayload{{otherGroup.ID}}, 400)
+		if len(ListSystemAdminsTest(t, userSuperAdmin, 200)) != 1 {
+			t.Error("UpdateUser removed the last system admin")
+		}
+	}
+
+	// VALID: SuspendUser revokes JWTs and refuses login
+	CreateUserTest(t, "suspended@test.org", "IWillBehaveBadly666!", "BadGuy", 0)
+	userSuspended := LoginTest(t, "suspended@test.org", "IWillBehaveBadly666!", 200)
+	suspendedID, _ := GetMeTest(t, userSuspended, 200)["ID"].(string)
+	// INVALID: SuspendUser
+	SuspendUserTest(t, userOffering, suspendedID, "Spam", 401)
+	SuspendUserTest(t, userSuperAdmin, suspendedID, "", 400)
+	suspendedUser := SuspendUserTest(t, userSuperAdmin, suspendedID, "Spam", 200)
+	if suspendedUser["Enabled"] != false || suspendedUser["SuspensionReason"] != "Spam" {
+		t.Error("SuspendUser did not disable user")
+	}
+	GetMeTest(t, userSuspended, 401)
+	LoginTest(t, "suspended@test.org", "IWillBehaveBadly666!", 403)
+	// VALID: EnableUser allows login again
+	EnableUserTest(t, userSuperAdmin, suspendedID, 200)
+	LoginTest(t, "suspended@test.org", "IWillBehaveBadly666!", 200)
+
+	// INVALID: CreateServiceAccount
+	serviceMail := fmt.Sprintf("integration-%s@test.org", uuid.NewV4())
+	CreateServiceAccountTest(t, userOffering, "Partner NGO", serviceMail, 401)
+	CreateServiceAccountTest(t, userSuperAdmin, "", serviceMail, 400)
+	// VALID: CreateServiceAccount and authenticate with API key
+	serviceAccountID := CreateServiceAccountTest(t, userSuperAdmin, "Partner NGO", serviceMail, 201)
+	// VALID: Audit trail records that the mail was set, but not the mail itself
+	serviceAudit, _ := ListAuditEntriesTest(t, userSuperAdmin, "action="+db.AuditServiceAccountCreate+"&target="+serviceAccountID, 200)
+	if len(serviceAudit) != 1 {
+		t.Error("CreateServiceAccount was not recorded in audit trail")
+	} else {
+		changes, _ := serviceAudit[0]["Changes"].(map[string]interface{})
+		mailChange, _ := changes["Mail"].(map[string]interface{})
+		if mailChange["After"] != "[redacted]" {
+			t.Error("Audit trail contained mail address of service account")
+		}
+		nameChange, _ := changes["Name"].(map[string]interface{})
+		if nameChange["After"] != "[redacted]" {
+			t.Error("Audit trail contained name of service account")
+		}
+	}
+	apiKeyID, apiKey := CreateAPIKeyTest(t, userSuperAdmin, serviceAccountID, "Import job", 201)
+	serviceAccount := GetMeWithAPIKeyTest(t, apiKey, 200)
+	if serviceAccount["ID"] != serviceAccountID {
+		t.Error("API key did not authenticate service account")
+	}
+	// INVALID: Service account can not log in with password
+	LoginTest(t, serviceMail, "NoPasswordForMachines666!", 400)
+	// VALID: RequestPasswordReset for service account responds as usual, but sends no mail
+	RequestPasswordResetTest(t, serviceMail, 200)
+	// INVALID: Use unknown and revoked API key
+	GetMeWithAPIKeyTest(t, "ctk_thisisnotavalidkey", 401)
+	RevokeAPIKeyTest(t, userSuperAdmin, serviceAccountID, apiKeyID, 200)
+	GetMeWithAPIKeyTest(t, apiKey, 401)
+
+	// INVALID: ListLockouts
+	ListLockoutsTest(t, userOffering, 401)
+	// VALID: ListLockouts
+	ListLockoutsTest(t, userSuperAdmin, 200)
 }
 
 func TestMatchingAlpha(t *testing.T) {
 	fmt.Println("\n--------------------- MatchingTestAlpha ---------------------\n")
 
 	// INVALID CreateOffer
-	CreateOfferTest(t, userOffering, "", gormGIS.GeoPoint{10.2, .0}, 10.4, "2017-11-01T22:08:41+00:00", 400)
+	CreateOfferTest(t, userOffering, "", gormGIS.GeoPoint{10.2, .0}, 10.4, "2017-11-01T22:08:41+00:00", "", 400)
 	// VALID CreateOffer
-	offerID = CreateOfferTest(t, userOffering, "Milk x10", gormGIS.GeoPoint{10.2, .0}, 20.3, "2017-11-01T22:08:41+00:00", 201)
+	offerID = CreateOfferTest(t, userOffering, "Milk x10", gormGIS.GeoPoint{10.2, .0}, 20.3, "2017-11-01T22:08:41+00:00", "", 201)
 
 	// INVALID GetOffer
 	GetOfferTest(t, userOffering, offerID+"a", 400)
@@ -1259,6 +3111,57 @@ func TestMatchingAlpha(t *testing.T) {
 		}
 	}
 
+	// INVALID: CreateFeedback before matching was completed
+	CreateFeedbackTest(t, userRequesting, matchingID, 1, "Never showed up", 400)
+	// INVALID: CompleteMatching
+	CompleteMatchingTest(t, userRequesting, matchingID+"a", 400)
+	// VALID: CompleteMatching by one party only confirms its side
+	confirmed := CompleteMatchingTest(t, userRequesting, matchingID, 200)
+	if confirmed["RequestConfirmed"] != true || confirmed["Completed"] != false {
+		t.Error("CompleteMatching by one party did not only confirm its side")
+	}
+	CreateFeedbackTest(t, userRequesting, matchingID, 1, "Never showed up", 400)
+	// VALID: CompleteMatching by both parties
+	completed := CompleteMatchingTest(t, userOffering, matchingID, 200)
+	if completed["OfferConfirmed"] != true || completed["Completed"] != true {
+		t.Error("CompleteMatching did not complete matching")
+	}
+	// INVALID: CreateFeedback
+	CreateFeedbackTest(t, userRegionAdmin, matchingID, 3, "", 401)
+	CreateFeedbackTest(t, userRequesting, matchingID, 6, "", 400)
+	// VALID: CreateFeedback once per side
+	CreateFeedbackTest(t, userRequesting, matchingID, 1, "Never showed up", 201)
+	CreateFeedbackTest(t, userRequesting, matchingID, 1, "Never showed up", 400)
+	CreateFeedbackTest(t, userOffering, matchingID, 5, "Thanks a lot", 201)
+	if len(ListFeedbackForMatchingTest(t, userOffering, matchingID, 200)) != 2 {
+		t.Error("ListFeedbackForMatching did not list feedback of both sides")
+	}
+
+	// VALID: second bad rating flags offering user to region admins
+	secondOfferID := CreateOfferTest(t, userOffering, "Bread x5", gormGIS.GeoPoint{10.2, .0}, 20.3, "2017-11-01T22:08:41+00:00", "", 201)
+	secondRequestID := CreateRequestTest(t, userRequesting, "Me hungry", gormGIS.GeoPoint{10.3, 0.2}, 1000.2, "2016-11-01T22:08:41+00:00", []string{"Food"}, "", 201)
+	secondMatchingID := CreateMatchingTest(t, userRegionAdmin, regionID, secondOfferID, secondRequestID, 201)
+	CompleteMatchingTest(t, userRegionAdmin, secondMatchingID, 200)
+	CreateFeedbackTest(t, userRequesting, secondMatchingID, 2, "Again too late", 201)
+
+	offeringID, _ := GetMeTest(t, userOffering, 200)["ID"].(string)
+	if reputation, ok := GetMeTest(t, userOffering, 200)["Reputation"].(map[string]interface{}); !ok || reputation["BadRatings"].(float64) < 2 {
+		t.Error("GetMe did not contain reputation with bad ratings")
+	}
+	ListFlaggedUsersInRegionTest(t, userOffering, regionID, 401)
+	flagged := false
+	for _, user := range ListFlaggedUsersInRegionTest(t, userRegionAdmin, regionID, 200) {
+		if user["ID"] == offeringID {
+			flagged = true
+		}
+	}
+	if !flagged {
+		t.Error("ListFlaggedUsersInRegion did not list user with repeated bad ratings")
+	}
+	if len(ListFeedbackForUserInRegionTest(t, userRegionAdmin, regionID, offeringID, 200)) < 2 {
+		t.Error("ListFeedbackForUserInRegion did not list feedback user received")
+	}
+
 	// Distance test:
 	// Create offer and request with distance 11.132km and very large Radius
 	distRequest := db.Request{Location: gormGIS.GeoPoint{0.0, 0.0}, Radius: 10000}
@@ -114,7 +114,9 @@ func CalculateLocationDistance(distChannel chan float64, offer db.Offer, request
 
 // This function calculates the possible matching score
 // between an offer and a request in a specified region.
-func (app *App) CalculateMatchingScore(done chan bool, region db.Region, offer db.Offer, request db.Request) {
+// Trust levels and requirements of the region have to be
+// loaded beforehand, as they are the same for all pairs.
+func (app *App) CalculateMatchingScore(done chan bool, region db.Region, trust *regionTrust, offer db.Offer, request db.Request) {
 
 	// Create channels for synchronization of goroutines.
 	tagChannel := make(chan float64)
@@ -160,6 +162,17 @@ func (app *App) CalculateMatchingScore(done chan bool, region db.Region, offer d
 		finalScore = 20
 	}
 
+	// Users lacking a trust level the request's tags require in this
+	// region must not be matched, more trusted users rank higher.
+	offerTrust := trustRank(trust.level(offer.UserID))
+	trustMissing := offerTrust < trustRank(trust.requiredLevel(request.Tags))
+
+	if trustMissing {
+		finalScore = 0
+	} else {
+		finalScore = finalScore * (1 + (app.TrustWeightGamma * float64(offerTrust) / maxTrustRank))
+	}
+
 	MatchingScore := db.MatchingScore{
 		RegionID:      region.ID,
 		Region:        region,
@@ -168,6 +181,7 @@ func (app *App) CalculateMatchingScore(done chan bool, region db.Region, offer d
 		RequestID:     request.ID,
 		Request:       request,
 		MatchingScore: finalScore,
+		TrustMissing:  trustMissing,
 	}
 
 	// Check if matching score element already exists in table.
@@ -208,11 +222,13 @@ func (app *App) CalcMatchScoreForOffer(offer db.Offer) {
 		// Preload needed tags.
 		app.DB.Preload("Tags").Find(&Region.Requests)
 
+		trust := app.loadRegionTrust(Region.ID)
+
 		for _, request := range Region.Requests {
 
 			// Calculate pair-wise matching score between
 			// offer and all reasonable requests in region.
-			go app.CalculateMatchingScore(calcDone, Region, offer, request)
+			go app.CalculateMatchingScore(calcDone, Region, trust, offer, request)
 		}
 
 		// Wait for all goroutines to finish.
@@ -246,11 +262,13 @@ func (app *App) CalcMatchScoreForRequest(request db.Request) {
 		// Preload needed tags.
 		app.DB.Preload("Tags").Find(&Region.Offers)
 
+		trust := app.loadRegionTrust(Region.ID)
+
 		for _, offer := range Region.Offers {
 
 			// Calculate pair-wise matching score between
 			// request and all reasonable offers in region.
-			go app.CalculateMatchingScore(calcDone, Region, offer, request)
+			go app.CalculateMatchingScore(calcDone, Region, trust, offer, request)
 		}
 
 		// Wait for all goroutines to finish.
@@ -263,6 +281,29 @@ func (app *App) CalcMatchScoreForRequest(request db.Request) {
 	}
 }
 
+// Returns the IDs of all offers and requests
+// that were created by currently suspended users.
+func (app *App) suspendedItems() map[string]bool {
+
+	var offerIDs []string
+	var requestIDs []string
+
+	app.DB.Model(&db.Offer{}).Where("\"user_id\" IN (SELECT \"id\" FROM \"users\" WHERE \"enabled\" = ?)", false).Pluck("id", &offerIDs)
+	app.DB.Model(&db.Request{}).Where("\"user_id\" IN (SELECT \"id\" FROM \"users\" WHERE \"enabled\" = ?)", false).Pluck("id", &requestIDs)
+
+	suspended := make(map[string]bool)
+
+	for _, id := range offerIDs {
+		suspended[id] = true
+	}
+
+	for _, id := range requestIDs {
+		suspended[id] = true
+	}
+
+	return suspended
+}
+
 // Caclulate assignment problem for offers und requests of
 // this region and set recommended flag to matching scores.
 func (app *App) RecommendMatching(region db.Region) {
@@ -303,11 +344,13 @@ func (app *App) RecommendMatching(region db.Region) {
 		// to be able to wait for end of that function.
 		calcDone := make(chan bool)
 
+		trust := app.loadRegionTrust(region.ID)
+
 		// Calculate all matching scores.
 		for _, request := range region.Requests {
 
 			for _, offer := range region.Offers {
-				go app.CalculateMatchingScore(calcDone, region, offer, request)
+				go app.CalculateMatchingScore(calcDone, region, trust, offer, request)
 			}
 		}
 
@@ -330,9 +373,18 @@ func (app *App) RecommendMatching(region db.Region) {
 
 	size := Max(numOffers, numRequests)
 
+	// Offers and requests of suspended users must not be recommended,
+	// neither may offers of users lacking a required trust level.
+	suspended := app.suspendedItems()
+
 	scoreValues := make([]int64, len(scores))
 	for i, score := range scores {
-		scoreValues[i] = 100 - int64(score.MatchingScore)
+
+		if suspended[score.OfferID] || suspended[score.RequestID] || score.TrustMissing {
+			scoreValues[i] = 100
+		} else {
+			scoreValues[i] = 100 - int64(score.MatchingScore)
+		}
 	}
 
 	// create dummy rows and cols; rows: request; cols: offers
@@ -365,6 +417,11 @@ func (app *App) RecommendMatching(region db.Region) {
 		if recommendation.Row < numRequests && recommendation.Col < numOffers {
 
 			index := (recommendation.Row * numOffers) + recommendation.Col
+
+			if suspended[scores[index].OfferID] || suspended[scores[index].RequestID] || scores[index].TrustMissing {
+				continue
+			}
+
 			scores[index].Recommended = true
 
 			app.DB.Model(&scores[index]).Select("recommended").Update("Recommended", true)
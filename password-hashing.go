@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Structs
+
+// An algorithm to hash passwords with. Every hasher stores
+// its parameters in the encoded hash, so that hashes can be
+// verified after the configured parameters changed.
+type PasswordHasher interface {
+
+	// Hashes supplied password with the configured parameters.
+	Hash(password string) (string, error)
+
+	// Reports whether supplied hash was produced by this algorithm.
+	Handles(encodedHash string) bool
+
+	// Compares supplied password with supplied hash in constant time.
+	Verify(encodedHash string, password string) bool
+
+	// Reports whether supplied hash was produced with
+	// the parameters currently configured.
+	IsCurrent(encodedHash string) bool
+}
+
+type BcryptHasher struct {
+	Cost int
+}
+
+// Argon2id as recommended by RFC 9106. Hashes are encoded in
+// the PHC string format, e.g. "$argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>".
+type Argon2idHasher struct {
+	Memory  uint32
+	Time    uint32
+	Threads uint8
+	SaltLen int
+	KeyLen  uint32
+}
+
+// Hashes new passwords with the current hasher and verifies
+// existing ones with whichever known hasher produced them.
+type PasswordHashing struct {
+	Current   PasswordHasher
+	Known     []PasswordHasher
+	dummyHash string
+}
+
+// Functions
+
+func NewPasswordHashing(current PasswordHasher, known ...PasswordHasher) *PasswordHashing {
+
+	hashing := &PasswordHashing{
+		Current: current,
+		Known:   append([]PasswordHasher{current}, known...),
+	}
+
+	// Hash of a password nobody knows, verified for unknown
+	// users so that a login takes equally long for them.
+	dummyHash, err := current.Hash(generateOpaqueToken())
+	if err != nil {
+		log.Fatalf("[NewPasswordHashing] Could not hash dummy password: %s.\nTerminating.", err)
+	}
+	hashing.dummyHash = dummyHash
+
+	return hashing
+}
+
+// Hashes supplied password with the current hasher.
+func (hashing *PasswordHashing) Hash(password string) (string, error) {
+	return hashing.Current.Hash(password)
+}
+
+// Verifies supplied password against supplied hash. If the
+// password is correct but the hash was produced with another
+// algorithm or other parameters than configured now, upgrade
+// is true and the caller should store the hash from Hash.
+// An empty hash, e.g. of an unknown user, never verifies but
+// takes as long as a regular verification.
+func (hashing *PasswordHashing) Verify(encodedHash string, password string) (ok bool, upgrade bool) {
+
+	if encodedHash == "" {
+		hashing.Current.Verify(hashing.dummyHash, password)
+		return false, false
+	}
+
+	for _, hasher := range hashing.Known {
+
+		if hasher.Handles(encodedHash) {
+
+			if !hasher.Verify(encodedHash, password) {
+				return false, false
+			}
+
+			return true, ((hasher != hashing.Current) || !hasher.IsCurrent(encodedHash))
+		}
+	}
+
+	// E.g. service accounts have no password hash at all.
+	return false, false
+}
+
+func (hasher BcryptHasher) Hash(password string) (string, error) {
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), hasher.Cost)
+
+	return string(hash), err
+}
+
+func (hasher BcryptHasher) Handles(encodedHash string) bool {
+	return strings.HasPrefix(encodedHash, "$2a$") || strings.HasPrefix(encodedHash, "$2b$") || strings.HasPrefix(encodedHash, "$2y$")
+}
+
+func (hasher BcryptHasher) Verify(encodedHash string, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(encodedHash), []byte(password)) == nil
+}
+
+func (hasher BcryptHasher) IsCurrent(encodedHash string) bool {
+
+	cost, err := bcrypt.Cost([]byte(encodedHash))
+
+	return (err == nil) && (cost == hasher.Cost)
+}
+
+func (hasher Argon2idHasher) Hash(password string) (string, error) {
+
+	salt := make([]byte, hasher.SaltLen)
+
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, hasher.Time, hasher.Memory, hasher.Threads, hasher.KeyLen)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, hasher.Memory, hasher.Time, hasher.Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (hasher Argon2idHasher) Handles(encodedHash string) bool {
+	return strings.HasPrefix(encodedHash, "$argon2id$")
+}
+
+// Splits an encoded Argon2id hash into its parameters, salt and key.
+func decodeArgon2id(encodedHash string) (hasher Argon2idHasher, salt []byte, key []byte, ok bool) {
+
+	parts := strings.Split(encodedHash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return hasher, nil, nil, false
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return hasher, nil, nil, false
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &hasher.Memory, &hasher.Time, &hasher.Threads); err != nil || hasher.Time == 0 || hasher.Threads == 0 {
+		return hasher, nil, nil, false
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return hasher, nil, nil, false
+	}
+
+	key, err = base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return hasher, nil, nil, false
+	}
+
+	hasher.SaltLen = len(salt)
+	hasher.KeyLen = uint32(len(key))
+
+	return hasher, salt, key, true
+}
+
+func (hasher Argon2idHasher) Verify(encodedHash string, password string) bool {
+
+	params, salt, key, ok := decodeArgon2id(encodedHash)
+	if !ok {
+		return false
+	}
+
+	// Use the parameters the hash was produced with.
+	candidate := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, params.KeyLen)
+
+	return subtle.ConstantTimeCompare(candidate, key) == 1
+}
+
+func (hasher Argon2idHasher) IsCurrent(encodedHash string) bool {
+
+	params, _, _, ok := decodeArgon2id(encodedHash)
+
+	return ok && (params.Memory == hasher.Memory) && (params.Time == hasher.Time) && (params.Threads == hasher.Threads) &&
+		(params.SaltLen == hasher.SaltLen) && (params.KeyLen == hasher.KeyLen)
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"unicode"
+
+	"crypto/sha1"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Structs
+
+// Rules every new password has to comply with.
+type PasswordPolicy struct {
+	MinLength      int
+	RequireLower   bool
+	RequireUpper   bool
+	RequireDigit   bool
+	RequireSpecial bool
+	Breached       *BreachedPasswords
+}
+
+// Offline list of passwords known from data breaches. The file
+// contains upper case hex SHA-1 hashes of these passwords, one per
+// line and sorted ascending, optionally followed by ':' and a count.
+// This is the format of the downloadable "Pwned Passwords" list
+// ordered by hash. The file is searched on disk and never loaded
+// into memory as a whole.
+type BreachedPasswords struct {
+	Path string
+}
+
+// Functions
+
+// Checks supplied password against our policy. Context words,
+// e.g. name and mail address of the user, must not be part of
+// the password. Returns a message for the client describing the
+// first violation or an empty string if the password complies.
+func (policy *PasswordPolicy) Check(password string, context ...string) string {
+
+	if len([]rune(password)) < policy.MinLength {
+		return "Is too short"
+	}
+
+	var hasLower, hasUpper, hasDigit, hasSpecial bool
+
+	for _, char := range password {
+
+		switch {
+		case unicode.IsLower(char):
+			hasLower = true
+		case unicode.IsUpper(char):
+			hasUpper = true
+		case unicode.IsDigit(char):
+			hasDigit = true
+		case !unicode.IsLetter(char) && !unicode.IsSpace(char):
+			hasSpecial = true
+		}
+	}
+
+	if policy.RequireLower && !hasLower {
+		return "Does not contain a lower case letter"
+	}
+
+	if policy.RequireUpper && !hasUpper {
+		return "Does not contain an upper case letter"
+	}
+
+	if policy.RequireDigit && !hasDigit {
+		return "Does not contain a number"
+	}
+
+	if policy.RequireSpecial && !hasSpecial {
+		return "Does not contain a special character"
+	}
+
+	lowerPassword := strings.ToLower(password)
+
+	for _, word := range passwordContextWords(context) {
+
+		if strings.Contains(lowerPassword, word) {
+			return "Must not contain your name or mail address"
+		}
+	}
+
+	if policy.Breached != nil && policy.Breached.Contains(password) {
+		return "Appeared in a data breach, please choose another one"
+	}
+
+	return ""
+}
+
+// Splits names and mail addresses into the words a password
+// must not contain. Very short words are ignored, as they would
+// forbid too many passwords by chance.
+func passwordContextWords(context []string) []string {
+
+	words := make([]string, 0)
+
+	for _, value := range context {
+
+		value = strings.ToLower(strings.TrimSpace(value))
+
+		// Of mail addresses only the local part is personal.
+		if i := strings.Index(value, "@"); i >= 0 {
+			value = value[:i]
+		}
+
+		// Ban the whole value as well as its parts.
+		parts := strings.FieldsFunc(value, func(char rune) bool {
+			return !unicode.IsLetter(char) && !unicode.IsDigit(char)
+		})
+
+		for _, word := range append(parts, value) {
+
+			if len([]rune(word)) >= 4 {
+				words = append(words, word)
+			}
+		}
+	}
+
+	return words
+}
+
+// Checks with a binary search over the file whether the
+// hash of supplied password is on our list. If the list
+// can not be read, the password is accepted.
+func (list *BreachedPasswords) Contains(password string) bool {
+
+	sum := sha1.Sum([]byte(password))
+	target := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	file, err := os.Open(list.Path)
+	if err != nil {
+		log.Printf("[BreachedPasswords] Could not open list of breached passwords: %s\n", err)
+		return false
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		log.Printf("[BreachedPasswords] Could not read list of breached passwords: %s\n", err)
+		return false
+	}
+
+	// The line of target, if present, starts within [low, high).
+	low, high := int64(0), info.Size()
+
+	for low < high {
+
+		mid := low + ((high - low) / 2)
+
+		hash, end, ok := breachedLineFrom(file, mid, info.Size())
+		if !ok {
+			high = mid
+			continue
+		}
+
+		if hash == target {
+			return true
+		}
+
+		if hash < target {
+			low = end
+		} else {
+			// No line starts between mid and the line just read,
+			// so the line of target has to start before mid.
+			high = mid
+		}
+	}
+
+	return false
+}
+
+// Reads the first line of the list starting at or after supplied
+// offset. Returns its hash and the offset following it.
+func breachedLineFrom(file *os.File, offset int64, size int64) (string, int64, bool) {
+
+	start := offset
+
+	// Unless at the very beginning, skip the rest of the line offset points into.
+	if offset > 0 {
+
+		reader := bufio.NewReader(io.NewSectionReader(file, (offset - 1), (size - offset + 1)))
+
+		skipped, err := reader.ReadString('\n')
+		if err != nil {
+			return "", 0, false
+		}
+
+		start = offset - 1 + int64(len(skipped))
+	}
+
+	if start >= size {
+		return "", 0, false
+	}
+
+	reader := bufio.NewReader(io.NewSectionReader(file, start, (size - start)))
+
+	line, err := reader.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", 0, false
+	}
+
+	end := start + int64(len(line))
+
+	hash := strings.TrimSpace(line)
+	if i := strings.Index(hash, ":"); i >= 0 {
+		hash = hash[:i]
+	}
+
+	return strings.ToUpper(hash), end, true
+}
+
+// Checks supplied password against our policy. On violation
+// writes a field-level error response and returns false.
+func (app *App) checkPasswordPolicy(c *gin.Context, password string, context ...string) bool {
+
+	if message := app.PasswordPolicy.Check(password, context...); message != "" {
+
+		c.JSON(http.StatusBadRequest, gin.H{
+			"Password": message,
+		})
+
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/caTUstrophy/backend/db"
+)
+
+// Structs
+
+// A user as resolved while authorizing a request, together
+// with all permissions the user's roles grant. Permissions
+// are keyed by region ID, an empty ID means system-wide.
+// Organisations maps the IDs of the user's organisations
+// to the user's role in each of them.
+type Principal struct {
+	User          db.User
+	Permissions   map[string]map[string]bool
+	Organisations map[string]string
+	expiresAt     time.Time
+	element       *list.Element
+}
+
+// Counts the invalidations of a user and the clears of the
+// whole cache. A principal loaded from database is only stored
+// if neither changed while loading it, otherwise it could be
+// outdated already.
+type PrincipalGeneration struct {
+	clears uint64
+	user   uint64
+}
+
+// Keeps recently resolved principals in memory for a short
+// time, so that authorizing a request does not have to load
+// user, groups, regions and permissions from database again.
+// Holds at most MaxEntries principals and evicts the least
+// recently used one when full. Changes to a user or its
+// groups have to invalidate the affected entries. Other
+// instances of our backend only notice after TTL passed.
+type PrincipalCache struct {
+	mutex       sync.Mutex
+	entries     map[string]*Principal
+	recency     *list.List
+	clears      uint64
+	generations map[string]uint64
+	MaxEntries  int
+	TTL         time.Duration
+}
+
+// Functions
+
+func NewPrincipalCache(maxEntries int, ttl time.Duration) *PrincipalCache {
+
+	return &PrincipalCache{
+		entries:     make(map[string]*Principal),
+		recency:     list.New(),
+		generations: make(map[string]uint64),
+		MaxEntries:  maxEntries,
+		TTL:         ttl,
+	}
+}
+
+// Returns the cached principal of supplied user if present
+// and not yet expired. Returned principals must not be modified.
+func (cache *PrincipalCache) Get(userID string) (*Principal, bool) {
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	principal, ok := cache.entries[userID]
+	if !ok {
+		return nil, false
+	}
+
+	if time.Now().After(principal.expiresAt) {
+		cache.remove(principal)
+		return nil, false
+	}
+
+	cache.recency.MoveToFront(principal.element)
+
+	return principal, true
+}
+
+// Returns the current generation of supplied user. Has to be
+// taken before loading the user's principal from database.
+func (cache *PrincipalCache) Generation(userID string) PrincipalGeneration {
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	return PrincipalGeneration{
+		clears: cache.clears,
+		user:   cache.generations[userID],
+	}
+}
+
+// Stores supplied principal, unless the user was invalidated or
+// the cache cleared since supplied generation was taken. A TTL
+// or size of zero disables caching.
+func (cache *PrincipalCache) Put(principal *Principal, generation PrincipalGeneration) {
+
+	if cache.TTL <= 0 || cache.MaxEntries <= 0 {
+		return
+	}
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if generation.clears != cache.clears || generation.user != cache.generations[principal.User.ID] {
+		return
+	}
+
+	if old, ok := cache.entries[principal.User.ID]; ok {
+		cache.remove(old)
+	}
+
+	// Make room by evicting the least recently used principal.
+	for len(cache.entries) >= cache.MaxEntries {
+		cache.remove(cache.recency.Back().Value.(*Principal))
+	}
+
+	principal.expiresAt = time.Now().Add(cache.TTL)
+	principal.element = cache.recency.PushFront(principal)
+	cache.entries[principal.User.ID] = principal
+}
+
+// Removes the principal of supplied user, e.g. after its
+// profile, groups or sessions changed.
+func (cache *PrincipalCache) Invalidate(userID string) {
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	cache.generations[userID]++
+
+	if principal, ok := cache.entries[userID]; ok {
+		cache.remove(principal)
+	}
+}
+
+// Removes all principals, e.g. after permissions of a role
+// changed that any number of users might hold.
+func (cache *PrincipalCache) Clear() {
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	// Bumping the clears outdates all user generations,
+	// so they can start over.
+	cache.clears++
+	cache.generations = make(map[string]uint64)
+
+	cache.entries = make(map[string]*Principal)
+	cache.recency.Init()
+}
+
+// Must be called with locked mutex.
+func (cache *PrincipalCache) remove(principal *Principal) {
+
+	cache.recency.Remove(principal.element)
+	delete(cache.entries, principal.User.ID)
+}
+
+// Returns the principal of supplied user, either from cache
+// or freshly loaded from database. Returns nil if the user
+// does not exist.
+func (app *App) getPrincipal(userID string) *Principal {
+
+	if principal, ok := app.Principals.Get(userID); ok {
+		return principal
+	}
+
+	generation := app.Principals.Generation(userID)
+
+	var User db.User
+	app.DB.Preload("Groups").First(&User, "id = ?", userID)
+
+	if User.ID == "" {
+		return nil
+	}
+
+	for i, _ := range User.Groups {
+		app.DB.Model(&User.Groups[i]).Related(&User.Groups[i].Region)
+	}
+
+	// Resolve all permissions of this user with one query.
+	var Scopes, OrganisationScopes []struct {
+		RegionId       string
+		PermissionName string
+	}
+	app.DB.Table("user_groups").
+		Select("\"groups\".\"region_id\", \"role_permissions\".\"permission_name\"").
+		Joins("JOIN \"groups\" ON \"groups\".\"id\" = \"user_groups\".\"group_id\"").
+		Joins("JOIN \"role_permissions\" ON \"role_permissions\".\"role_id\" = \"groups\".\"role_id\"").
+		Where("\"user_groups\".\"user_id\" = ?", User.ID).
+		Scan(&Scopes)
+
+	// Members also hold all roles granted to their organisations.
+	app.DB.Table("organisation_members").
+		Select("\"groups\".\"region_id\", \"role_permissions\".\"permission_name\"").
+		Joins("JOIN \"organisation_groups\" ON \"organisation_groups\".\"organisation_id\" = \"organisation_members\".\"organisation_id\"").
+		Joins("JOIN \"groups\" ON \"groups\".\"id\" = \"organisation_groups\".\"group_id\"").
+		Joins("JOIN \"role_permissions\" ON \"role_permissions\".\"role_id\" = \"groups\".\"role_id\"").
+		Where("\"organisation_members\".\"user_id\" = ?", User.ID).
+		Scan(&OrganisationScopes)
+
+	var Memberships []db.OrganisationMember
+	app.DB.Find(&Memberships, "\"user_id\" = ?", User.ID)
+
+	principal := &Principal{
+		User:          User,
+		Permissions:   make(map[string]map[string]bool),
+		Organisations: make(map[string]string),
+	}
+
+	Scopes = append(Scopes, OrganisationScopes...)
+
+	for _, scope := range Scopes {
+
+		if _, ok := principal.Permissions[scope.RegionId]; !ok {
+			principal.Permissions[scope.RegionId] = make(map[string]bool)
+		}
+
+		principal.Permissions[scope.RegionId][scope.PermissionName] = true
+	}
+
+	for _, membership := range Memberships {
+		principal.Organisations[membership.OrganisationID] = membership.Role
+	}
+
+	app.Principals.Put(principal, generation)
+
+	return principal
+}
+
+// Returns a copy of the principal's user that handlers
+// may modify without affecting the cache.
+func (principal *Principal) CopyUser() *db.User {
+
+	User := principal.User
+	User.Groups = append([]db.Group(nil), principal.User.Groups...)
+
+	return &User
+}
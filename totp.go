@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+)
+
+// Time-based one-time passwords as specified in RFC 6238,
+// compatible with common authenticator apps: HMAC-SHA1,
+// 30 seconds time step and six digits.
+const (
+	totpStep   int64 = 30
+	totpDigits int   = 6
+)
+
+// Functions
+
+// Generates a random secret for TOTP enrollment, encoded
+// in base32 without padding as expected by authenticator apps.
+func generateTOTPSecret() string {
+
+	secret := make([]byte, 20)
+
+	_, err := rand.Read(secret)
+	if err != nil {
+		log.Fatalf("[generateTOTPSecret] Reading random bytes went wrong: %s.\nTerminating.", err)
+	}
+
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(secret)
+}
+
+// Builds the URI that authenticator apps scan as QR code.
+func totpURI(secret string, account string) string {
+
+	label := url.PathEscape("CaTUstrophy:" + account)
+
+	return fmt.Sprintf("otpauth://totp/%s?secret=%s&issuer=CaTUstrophy&algorithm=SHA1&digits=%d&period=%d", label, secret, totpDigits, totpStep)
+}
+
+// Calculates the one-time password for supplied secret and
+// time step counter as described in RFC 4226.
+func totpCode(secret string, counter int64) (string, bool) {
+
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", false
+	}
+
+	message := make([]byte, 8)
+	binary.BigEndian.PutUint64(message, uint64(counter))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(message)
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation.
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:(offset+4)]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", totpDigits, (value % 1000000)), true
+}
+
+// Checks supplied code against the codes of the current time
+// step and its direct neighbours to tolerate clock drift.
+// Returns the matching time step counter, so that callers can
+// refuse codes that were already used.
+func verifyTOTP(secret string, code string, now time.Time) (int64, bool) {
+
+	current := now.Unix() / totpStep
+	code = strings.Replace(strings.TrimSpace(code), " ", "", -1)
+
+	for counter := (current - 1); counter <= (current + 1); counter++ {
+
+		expected, ok := totpCode(secret, counter)
+		if !ok {
+			return 0, false
+		}
+
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return counter, true
+		}
+	}
+
+	return 0, false
+}
+
+// Generates a recovery code in groups of four
+// characters, e.g. "ABCD-EFGH-IJKL".
+func generateRecoveryCode() string {
+
+	raw := make([]byte, 8)
+
+	_, err := rand.Read(raw)
+	if err != nil {
+		log.Fatalf("[generateRecoveryCode] Reading random bytes went wrong: %s.\nTerminating.", err)
+	}
+
+	code := base32.StdEncoding.EncodeToString(raw)[:12]
+
+	return fmt.Sprintf("%s-%s-%s", code[0:4], code[4:8], code[8:12])
+}
+
+// Normalizes user input of a recovery code before hashing it.
+func normalizeRecoveryCode(code string) string {
+	return strings.ToUpper(strings.Replace(strings.TrimSpace(code), "-", "", -1))
+}
@@ -0,0 +1,465 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"net/http"
+
+	"github.com/caTUstrophy/backend/db"
+	"github.com/gin-gonic/gin"
+	"github.com/satori/go.uuid"
+)
+
+// Structs
+
+type GrantTrustPayload struct {
+	Level     string `conform:"trim,lower" validate:"required"`
+	Note      string `conform:"trim" validate:"required"`
+	ExpiresAt string `conform:"trim" validate:"required"`
+}
+
+type TrustRequirementPayload struct {
+	Tag   string `conform:"trim" validate:"required"`
+	Level string `conform:"trim,lower"`
+}
+
+// Current trust levels of users and trust requirements of
+// tags in one region, loaded at once to calculate many
+// matching scores without querying them pair by pair.
+type regionTrust struct {
+	levels   map[string]string
+	required map[string]string
+}
+
+// Constants
+
+// Rank of the highest trust level.
+const maxTrustRank = 2
+
+// Functions
+
+// Orders trust levels, users without one rank lowest.
+func trustRank(level string) int {
+
+	switch level {
+	case db.TrustLevelVerified:
+		return 1
+	case db.TrustLevelVetted:
+		return 2
+	}
+
+	return 0
+}
+
+// Returns the highest trust level supplied user currently
+// holds in any of supplied regions or an empty string.
+func (app *App) trustLevel(userID string, regionIDs []string) string {
+
+	if len(regionIDs) == 0 {
+		return ""
+	}
+
+	var Grants []db.TrustGrant
+	app.DB.Find(&Grants, "\"user_id\" = ? AND \"region_id\" IN (?) AND \"revoked\" = ? AND \"expires_at\" > ?", userID, regionIDs, false, time.Now())
+
+	level := ""
+
+	for _, Grant := range Grants {
+
+		if trustRank(Grant.Level) > trustRank(level) {
+			level = Grant.Level
+		}
+	}
+
+	return level
+}
+
+// Returns the highest trust level any of supplied tags
+// requires in supplied region or an empty string.
+func (app *App) requiredTrustLevel(regionID string, tags []db.Tag) string {
+
+	if len(tags) == 0 {
+		return ""
+	}
+
+	tagNames := make([]string, len(tags))
+	for i, tag := range tags {
+		tagNames[i] = tag.Name
+	}
+
+	var Requirements []db.TrustRequirement
+	app.DB.Find(&Requirements, "\"region_id\" = ? AND \"tag_name\" IN (?)", regionID, tagNames)
+
+	level := ""
+
+	for _, Requirement := range Requirements {
+
+		if trustRank(Requirement.Level) > trustRank(level) {
+			level = Requirement.Level
+		}
+	}
+
+	return level
+}
+
+// Loads all current trust levels and trust requirements of supplied region.
+func (app *App) loadRegionTrust(regionID string) *regionTrust {
+
+	trust := &regionTrust{
+		levels:   make(map[string]string),
+		required: make(map[string]string),
+	}
+
+	var Grants []db.TrustGrant
+	app.DB.Find(&Grants, "\"region_id\" = ? AND \"revoked\" = ? AND \"expires_at\" > ?", regionID, false, time.Now())
+
+	for _, Grant := range Grants {
+
+		if trustRank(Grant.Level) > trustRank(trust.levels[Grant.UserID]) {
+			trust.levels[Grant.UserID] = Grant.Level
+		}
+	}
+
+	var Requirements []db.TrustRequirement
+	app.DB.Find(&Requirements, "\"region_id\" = ?", regionID)
+
+	for _, Requirement := range Requirements {
+		trust.required[Requirement.TagName] = Requirement.Level
+	}
+
+	return trust
+}
+
+// Returns the trust level supplied user holds in the region.
+func (trust *regionTrust) level(userID string) string {
+	return trust.levels[userID]
+}
+
+// Returns the highest trust level any of supplied tags requires in the region.
+func (trust *regionTrust) requiredLevel(tags []db.Tag) string {
+
+	level := ""
+
+	for _, tag := range tags {
+
+		if trustRank(trust.required[tag.Name]) > trustRank(level) {
+			level = trust.required[tag.Name]
+		}
+	}
+
+	return level
+}
+
+// Sets the trust level of the user of supplied offer in supplied
+// regions or, if none are supplied, in the regions of the offer.
+func (app *App) loadTrustLevel(offer *db.Offer, regionIDs ...string) {
+
+	if len(regionIDs) == 0 {
+
+		for _, region := range offer.Regions {
+			regionIDs = append(regionIDs, region.ID)
+		}
+	}
+
+	offer.TrustLevel = app.trustLevel(offer.UserID, regionIDs)
+}
+
+// Recalculates matching scores of all offers supplied
+// user currently has in supplied region.
+func (app *App) recalculateOffersOfUser(regionID string, userID string) {
+
+	var Offers []db.Offer
+	app.DB.Preload("Tags").Preload("Regions").
+		Joins("JOIN \"region_offers\" ON \"region_offers\".\"offer_id\" = \"offers\".\"id\"").
+		Find(&Offers, "\"region_offers\".\"region_id\" = ? AND \"offers\".\"user_id\" = ? AND \"offers\".\"expired\" = ? AND \"offers\".\"matched\" = ?", regionID, userID, false, false)
+
+	for _, Offer := range Offers {
+		app.CalcMatchScoreForOffer(Offer)
+	}
+}
+
+// Periodically recalculates matching scores of users whose trust
+// level expired, so that their offers neither rank higher nor get
+// recommended for requests requiring that level anymore. Trust
+// levels that expired while the backend was down are handled on
+// the first run.
+func (app *App) TrustExpiryReaper(sleepOffset time.Duration) {
+
+	log.Printf("Trust expiry reaper started.\n")
+
+	var checkedUntil time.Time
+
+	for {
+
+		nowTime := time.Now()
+
+		var Grants []db.TrustGrant
+		app.DB.Find(&Grants, "\"revoked\" = ? AND \"expires_at\" > ? AND \"expires_at\" <= ?", false, checkedUntil, nowTime)
+
+		for _, Grant := range Grants {
+			app.recalculateOffersOfUser(Grant.RegionID, Grant.UserID)
+		}
+
+		checkedUntil = nowTime
+
+		time.Sleep(sleepOffset)
+	}
+}
+
+// Lists all users currently holding a trust level in a region.
+func (app *App) ListTrustInRegion(c *gin.Context) {
+
+	// Check authorization for this function.
+	User := app.AuthorizeShort(c)
+	if User == nil {
+		return
+	}
+
+	Region := app.getRegionWithPermission(c, User, db.PermissionItemRead)
+	if Region == nil {
+		return
+	}
+
+	var Grants []db.TrustGrant
+	app.DB.Order("\"expires_at\"").Find(&Grants, "\"region_id\" = ? AND \"revoked\" = ? AND \"expires_at\" > ?", Region.ID, false, time.Now())
+
+	model := CopyNestedModel(Grants, fieldsTrustGrant)
+
+	c.JSON(http.StatusOK, model)
+}
+
+// Grants a trust level in a region to a user until supplied
+// date. Replaces the current trust level of the user there.
+func (app *App) GrantTrustInRegion(c *gin.Context) {
+
+	// Check authorization for this function.
+	User := app.AuthorizeShort(c)
+	if User == nil {
+		return
+	}
+
+	Region := app.getRegionWithPermission(c, User, db.PermissionRegionTrustManage)
+	if Region == nil {
+		return
+	}
+
+	userID := app.getUUID(c, "userID")
+	if userID == "" {
+		return
+	}
+
+	var Payload GrantTrustPayload
+
+	// Expect level, note and expiry in JSON request body.
+	if ok := app.ValidatePayloadShort(c, &Payload); !ok {
+		return
+	}
+
+	if trustRank(Payload.Level) == 0 {
+
+		c.JSON(http.StatusBadRequest, gin.H{
+			"Level": "Has to be verified or vetted",
+		})
+
+		return
+	}
+
+	ExpiresAt, err := time.Parse(time.RFC3339, Payload.ExpiresAt)
+	if err != nil {
+
+		c.JSON(http.StatusBadRequest, gin.H{
+			"ExpiresAt": "Has to be a RFC3339 compliant date",
+		})
+
+		return
+	}
+
+	if !ExpiresAt.After(time.Now()) {
+
+		c.JSON(http.StatusBadRequest, gin.H{
+			"ExpiresAt": "Has to be a date in the future",
+		})
+
+		return
+	}
+
+	var trustedUser db.User
+	app.DB.First(&trustedUser, "\"id\" = ? AND \"deleted\" = ? AND \"service_account\" = ?", userID, false, false)
+
+	if trustedUser.ID == "" {
+
+		c.JSON(http.StatusNotFound, gin.H{
+			"Error": "The user you requested does not exist.",
+		})
+
+		return
+	}
+
+	Grant := db.TrustGrant{
+		ID:          fmt.Sprintf("%s", uuid.NewV4()),
+		UserID:      trustedUser.ID,
+		RegionID:    Region.ID,
+		Level:       Payload.Level,
+		Note:        Payload.Note,
+		GrantedByID: User.ID,
+		CreatedAt:   time.Now(),
+		ExpiresAt:   ExpiresAt,
+		Revoked:     false,
+	}
+
+	model := CopyNestedModel(Grant, fieldsTrustGrant)
+
+	tx := app.DB.Begin()
+	tx.Model(&db.TrustGrant{}).Where("\"user_id\" = ? AND \"region_id\" = ? AND \"revoked\" = ?", trustedUser.ID, Region.ID, false).Update("revoked", true)
+	tx.Create(&Grant)
+	app.audit(tx, c, User, db.AuditUserTrustGrant, "user", trustedUser.ID, Region.ID, nil, model)
+	tx.Commit()
+
+	// Trust counts towards matching scores of the user's offers.
+	go app.recalculateOffersOfUser(Region.ID, trustedUser.ID)
+
+	c.JSON(http.StatusOK, model)
+}
+
+func (app *App) RevokeTrustInRegion(c *gin.Context) {
+
+	// Check authorization for this function.
+	User := app.AuthorizeShort(c)
+	if User == nil {
+		return
+	}
+
+	Region := app.getRegionWithPermission(c, User, db.PermissionRegionTrustManage)
+	if Region == nil {
+		return
+	}
+
+	userID := app.getUUID(c, "userID")
+	if userID == "" {
+		return
+	}
+
+	var Grant db.TrustGrant
+	app.DB.First(&Grant, "\"user_id\" = ? AND \"region_id\" = ? AND \"revoked\" = ? AND \"expires_at\" > ?", userID, Region.ID, false, time.Now())
+
+	if Grant.ID == "" {
+
+		c.JSON(http.StatusNotFound, gin.H{
+			"Error": "The user you requested holds no trust level in this region.",
+		})
+
+		return
+	}
+
+	app.DB.Model(&Grant).Update("revoked", true)
+
+	app.audit(app.DB, c, User, db.AuditUserTrustRevoke, "user", userID, Region.ID, gin.H{"Level": Grant.Level}, nil)
+
+	go app.recalculateOffersOfUser(Region.ID, userID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"ID": Grant.ID,
+	})
+}
+
+func (app *App) ListTrustRequirementsForRegion(c *gin.Context) {
+
+	// Check authorization for this function.
+	User := app.AuthorizeShort(c)
+	if User == nil {
+		return
+	}
+
+	Region := app.getRegionWithPermission(c, User, db.PermissionItemRead)
+	if Region == nil {
+		return
+	}
+
+	var Requirements []db.TrustRequirement
+	app.DB.Order("\"tag_name\"").Find(&Requirements, "\"region_id\" = ?", Region.ID)
+
+	model := CopyNestedModel(Requirements, fieldsTrustRequirement)
+
+	c.JSON(http.StatusOK, model)
+}
+
+// Requires a minimum trust level in a region from users offering
+// for requests with supplied tag. An empty level drops the
+// requirement again.
+func (app *App) SetTrustRequirementInRegion(c *gin.Context) {
+
+	// Check authorization for this function.
+	User := app.AuthorizeShort(c)
+	if User == nil {
+		return
+	}
+
+	Region := app.getRegionWithPermission(c, User, db.PermissionRegionTrustManage)
+	if Region == nil {
+		return
+	}
+
+	var Payload TrustRequirementPayload
+
+	// Expect tag and level in JSON request body.
+	if ok := app.ValidatePayloadShort(c, &Payload); !ok {
+		return
+	}
+
+	if Payload.Level != "" && trustRank(Payload.Level) == 0 {
+
+		c.JSON(http.StatusBadRequest, gin.H{
+			"Level": "Has to be verified, vetted or empty",
+		})
+
+		return
+	}
+
+	var Tag db.Tag
+	app.DB.First(&Tag, "\"name\" = ?", Payload.Tag)
+
+	if Tag.Name == "" {
+
+		c.JSON(http.StatusNotFound, gin.H{
+			"Error": "The tag you requested does not exist.",
+		})
+
+		return
+	}
+
+	var Requirement db.TrustRequirement
+	app.DB.First(&Requirement, "\"region_id\" = ? AND \"tag_name\" = ?", Region.ID, Tag.Name)
+
+	before := gin.H{"Tag": Tag.Name, "Level": Requirement.Level}
+
+	app.DB.Where("\"region_id\" = ? AND \"tag_name\" = ?", Region.ID, Tag.Name).Delete(&db.TrustRequirement{})
+
+	Requirement = db.TrustRequirement{
+		RegionID: Region.ID,
+		TagName:  Tag.Name,
+		Level:    Payload.Level,
+	}
+
+	if Requirement.Level != "" {
+		app.DB.Create(&Requirement)
+	}
+
+	app.audit(app.DB, c, User, db.AuditRegionTrustRequirement, "region", Region.ID, Region.ID, before, gin.H{"Tag": Tag.Name, "Level": Requirement.Level})
+
+	// Requests with this tag need new matching scores.
+	var Requests []db.Request
+	app.DB.Preload("Tags").Preload("Regions").
+		Joins("JOIN \"region_requests\" ON \"region_requests\".\"request_id\" = \"requests\".\"id\"").
+		Joins("JOIN \"request_tags\" ON \"request_tags\".\"request_id\" = \"requests\".\"id\"").
+		Find(&Requests, "\"region_requests\".\"region_id\" = ? AND \"request_tags\".\"tag_name\" = ? AND \"requests\".\"expired\" = ? AND \"requests\".\"matched\" = ?", Region.ID, Tag.Name, false, false)
+
+	for _, Request := range Requests {
+		go app.CalcMatchScoreForRequest(Request)
+	}
+
+	model := CopyNestedModel(Requirement, fieldsTrustRequirement)
+
+	c.JSON(http.StatusOK, model)
+}
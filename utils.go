@@ -5,7 +5,12 @@ import (
 	"fmt"
 	"log"
 	"math"
+	"time"
 
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"net/http"
 	"reflect"
@@ -152,6 +157,92 @@ func (app *App) MapLocationToRegions(item interface{}) {
 	}
 }
 
+// Generates a random, URL-safe token that can be handed
+// out to clients, e.g. as refresh token. Only its hash
+// should be stored in our database.
+func generateOpaqueToken() string {
+
+	tokenBytes := make([]byte, 32)
+
+	_, err := rand.Read(tokenBytes)
+	if err != nil {
+		log.Fatalf("[generateOpaqueToken] Reading random bytes went wrong: %s.\nTerminating.", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(tokenBytes)
+}
+
+// Hashes an opaque token for storing and looking it up
+// in our database. Tokens carry enough entropy so that
+// a fast hash function without salt is sufficient.
+func hashOpaqueToken(token string) string {
+
+	hash := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(hash[:])
+}
+
+// Returns a SQL condition for preloading offers or requests
+// that only selects items of users that are not suspended.
+func enabledUsersOnly(table string) string {
+	return fmt.Sprintf("\"%s\".\"user_id\" IN (SELECT \"id\" FROM \"users\" WHERE \"enabled\" = true)", table)
+}
+
+// Creates a new one-time token of supplied type for supplied
+// user, stores its hash and returns the plaintext token.
+// The token is bound to the user's current mail address.
+func (app *App) makeOneTimeToken(user db.User, tokenType string, validFor time.Duration) (string, time.Time) {
+
+	token := generateOpaqueToken()
+	nowTime := time.Now()
+
+	OneTimeToken := db.OneTimeToken{
+		TokenHash: hashOpaqueToken(token),
+		Type:      tokenType,
+		UserID:    user.ID,
+		Mail:      user.Mail,
+		Used:      false,
+		CreatedAt: nowTime,
+		ExpiresAt: nowTime.Add(validFor),
+	}
+	app.DB.Create(&OneTimeToken)
+
+	return token, OneTimeToken.ExpiresAt
+}
+
+// Looks up supplied one-time token of supplied type, checks
+// that it is still valid and belongs to the current mail address
+// of its user, and marks it as used. Returns the user the token
+// was issued to or nil if the token can not be used.
+func (app *App) useOneTimeToken(token string, tokenType string) *db.User {
+
+	// Find token in database.
+	var OneTimeToken db.OneTimeToken
+	app.DB.First(&OneTimeToken, "\"token_hash\" = ? AND \"type\" = ?", hashOpaqueToken(token), tokenType)
+
+	if OneTimeToken.TokenHash == "" || OneTimeToken.Used || OneTimeToken.ExpiresAt.Before(time.Now()) {
+		return nil
+	}
+
+	// Find user this token was issued to.
+	var User db.User
+	app.DB.First(&User, "\"id\" = ?", OneTimeToken.UserID)
+
+	// Token has to belong to the current mail address of the user.
+	if User.ID == "" || User.Mail != OneTimeToken.Mail {
+		return nil
+	}
+
+	// Mark token as used. Only one request can succeed here.
+	result := app.DB.Model(&db.OneTimeToken{}).Where("\"token_hash\" = ? AND \"used\" = ?", OneTimeToken.TokenHash, false).Update("used", true)
+
+	if result.RowsAffected == 0 {
+		return nil
+	}
+
+	return &User
+}
+
 // haversin(θ) function
 func hsin(theta float64) float64 {
 	return math.Pow(math.Sin((theta / 2)), 2)
@@ -432,6 +523,8 @@ func CheckErrors(errs validator.ValidationErrors, c *gin.Context) {
 				errResp[err.Field] = "Does not contain numbers and special characters"
 			} else if err.Tag == "email" {
 				errResp[err.Field] = "Is not a valid mail address"
+			} else if err.Tag == "uuid4" {
+				errResp[err.Field] = "Needs to be an UUID version 4"
 			}
 		}
 
@@ -453,6 +546,19 @@ func (app *App) RequestWithJWT(method string, url string, body interface{}, jwt
 	return resp
 }
 
+// USED FOR TESTING ONLY!
+// Creates http.Request authenticated by an API key, requests url and returns a response
+func (app *App) RequestWithAPIKey(method string, url string, body interface{}, apiKey string) *httptest.ResponseRecorder {
+
+	resp := httptest.NewRecorder()
+	req := NewRequest(method, url, body)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", apiKey)
+	app.Router.ServeHTTP(resp, req)
+
+	return resp
+}
+
 // USED FOR TESTING ONLY!
 // Creates http.Request, requests url and returns a response
 func (app *App) Request(method string, url string, body interface{}) *httptest.ResponseRecorder {